@@ -0,0 +1,48 @@
+package main
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to sign the requests sent to the
+admin API of the proxy, e.g. with curl.
+*/
+
+import (
+	"fmt"
+	"os"
+	"semester-project/controller/sender"
+	"semester-project/wire"
+	"strings"
+)
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// runSignRequest prints the Authorization header signing a request of the
+// admin API with the credentials. The URI is the path of the request with
+// its query, and the body is read from the file if any.
+// It returns the exit code of the controller.
+func runSignRequest(credentials sender.Credentials, method string, uri string, bodyPath string) int {
+	if credentials.Identity == "" {
+		fmt.Fprintln(os.Stderr, "The identity and the key must be given with -identity and -key")
+		return EXIT_ERROR
+	}
+	var body []byte
+	if bodyPath != "" {
+		var err error
+		body, err = os.ReadFile(bodyPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_ERROR
+		}
+	}
+	message := wire.NewRequestMessage(strings.ToUpper(method), uri, body)
+	err := message.Sign(credentials.Identity, credentials.Key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+	fmt.Println("Authorization: " + message.Auth.Header())
+	return 0
+}
@@ -0,0 +1,79 @@
+package main
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to run a batch of commands on a single
+session with the proxy.
+*/
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"semester-project/controller/messages"
+	"semester-project/controller/sender"
+	"strings"
+)
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// runBatch runs the commands read from the file, or from the standard input
+// if no file is given, one per line. Empty lines and lines starting with '#'
+// are ignored. All the commands are sent on the same session, in order.
+// It returns the exit code of the first command that failed, or 0.
+func runBatch(proxyAddr string, credentials sender.Credentials, path string) int {
+	var input io.Reader = os.Stdin
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Println(err)
+			return EXIT_ERROR
+		}
+		defer file.Close()
+		input = file
+	}
+	// open the session
+	session, err := sender.Dial(proxyAddr, credentials)
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	defer session.Close()
+	// run the commands
+	exitCode := 0
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fmt.Println(">", line)
+		command, fs, err := messages.ParseCommand(strings.Fields(line))
+		if err != nil {
+			fmt.Println(err)
+			return EXIT_ERROR
+		}
+		message, err := command.BuildMessage(fs)
+		if err != nil {
+			fmt.Println(err)
+			return EXIT_ERROR
+		}
+		reply, err := session.Request(message)
+		if err != nil {
+			fmt.Println(err)
+			return EXIT_ERROR
+		}
+		if code := printReply(command, fs, reply); code != 0 && exitCode == 0 {
+			exitCode = code
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	return exitCode
+}
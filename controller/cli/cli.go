@@ -0,0 +1,269 @@
+package cli
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains a tree of subcommands, each with its own flags
+and help text.
+*/
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A Command is a node of the tree of subcommands.
+// A command with subcommands runs the subcommand named by its first argument.
+// If it has a fallback, the fallback handles the arguments whose first one is
+// not the name of a subcommand: this argument is the operand of the fallback,
+// e.g. the address of the proxy, and the remaining ones are run by it.
+type Command struct {
+	// Name is the name of the command, or the name of the operand of a
+	// fallback.
+	Name string
+	// Args is the synopsis of the arguments of the command.
+	Args string
+	// Summary is a one-line description of the command.
+	Summary string
+	// Description is the text shown by --help after the usage, if any.
+	Description string
+	// MinArgs and MaxArgs bound the number of arguments left after the flags.
+	// MaxArgs is UNLIMITED if there is no bound.
+	MinArgs int
+	MaxArgs int
+	// Flags defines the flags of the command on the flag set. The flags of a
+	// command without subcommands can be given among its arguments, the flags
+	// of the others must precede their subcommand.
+	Flags func(fs *flag.FlagSet)
+	// Run runs the command with its parsed flags, the arguments left after
+	// the flags being fs.Args(), and returns the exit code. It is not called
+	// for commands with subcommands.
+	Run      func(fs *flag.FlagSet) int
+	Commands []*Command
+	Fallback *Command
+	// SetOperand is called with the operand of a fallback.
+	SetOperand func(operand string)
+}
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// UNLIMITED is the MaxArgs of the commands without bound on their arguments.
+const UNLIMITED = -1
+
+// EXIT_USAGE is returned when the command line is invalid.
+const EXIT_USAGE = 1
+
+//------------------------------------------------------------------------------
+// Private variables
+//------------------------------------------------------------------------------
+
+// output is where the help and usage errors are printed.
+var output io.Writer = os.Stdout
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// isGroup returns true if the command runs subcommands.
+func (c *Command) isGroup() bool {
+	return len(c.Commands) > 0 || c.Fallback != nil
+}
+
+// find returns the subcommand of the given name, or nil.
+func (c *Command) find(name string) *Command {
+	for _, command := range c.Commands {
+		if command.Name == name {
+			return command
+		}
+	}
+	return nil
+}
+
+// flagSet returns the flag set of the command, whose errors are returned
+// without being printed.
+func (c *Command) flagSet(path string) *flag.FlagSet {
+	fs := flag.NewFlagSet(path, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if c.Flags != nil {
+		c.Flags(fs)
+	}
+	return fs
+}
+
+// usage returns the usage lines of the command, called by the given path.
+func (c *Command) usage(path string) string {
+	hasFlags := false
+	c.flagSet(path).VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		path += " [options]"
+	}
+	var lines []string
+	if len(c.Commands) > 0 {
+		lines = append(lines, path+" <command>")
+	}
+	if c.Fallback != nil {
+		lines = append(lines, path+" "+c.Fallback.Name+" <command>")
+	}
+	if len(lines) == 0 {
+		lines = append(lines, path)
+	}
+	if c.Args != "" {
+		lines[len(lines)-1] += " " + c.Args
+	}
+	return strings.Join(lines, "\n       ") + "\n"
+}
+
+// help returns the help text of the command, called by the given path.
+func (c *Command) help(path string) string {
+	var b strings.Builder
+	b.WriteString("Usage: " + c.usage(path))
+	if c.Summary != "" || c.Description != "" {
+		b.WriteString("\n")
+	}
+	if c.Summary != "" {
+		b.WriteString(c.Summary + "\n")
+	}
+	if c.Description != "" {
+		b.WriteString(strings.TrimRight(c.Description, "\n") + "\n")
+	}
+	fs := c.flagSet(path)
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		b.WriteString("\nOptions:\n")
+		fs.SetOutput(&b)
+		fs.PrintDefaults()
+	}
+	writeCommands := func(title string, commands []*Command) {
+		if len(commands) == 0 {
+			return
+		}
+		b.WriteString("\n" + title + ":\n")
+		w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		for _, command := range commands {
+			fmt.Fprintf(w, "  %s\t%s\n", command.Name, command.Summary)
+		}
+		w.Flush()
+	}
+	writeCommands("Commands", c.Commands)
+	if c.Fallback != nil {
+		writeCommands("Commands on "+c.Fallback.Name, c.Fallback.Commands)
+	}
+	if c.isGroup() {
+		b.WriteString("\nRun '" + path + " <command> --help' for the help of a command.\n")
+	}
+	return b.String()
+}
+
+// printHelp prints the help of the command found by following the names from
+// the command, or an error if there is none.
+func (c *Command) printHelp(path string, names []string) int {
+	for _, name := range names {
+		if command := c.find(name); command != nil {
+			c, path = command, path+" "+name
+		} else if c.Fallback != nil {
+			c, path = c.Fallback, path+" "+c.Fallback.Name
+			if command := c.find(name); command != nil {
+				c, path = command, path+" "+name
+			}
+		} else {
+			fmt.Fprintln(output, "unknown command:", name)
+			return EXIT_USAGE
+		}
+	}
+	fmt.Fprint(output, c.help(path))
+	return 0
+}
+
+// execute parses the flags of the command and runs it, called by the given
+// path.
+func (c *Command) execute(path string, args []string) int {
+	fs := c.flagSet(path)
+	var err error
+	if c.isGroup() {
+		err = fs.Parse(args)
+	} else {
+		err = ParseFlags(fs, args)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(output, c.help(path))
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(output, err)
+		fmt.Fprint(output, "usage: "+c.usage(path))
+		return EXIT_USAGE
+	}
+	args = fs.Args()
+	if c.isGroup() {
+		if len(args) == 0 {
+			fmt.Fprint(output, c.help(path))
+			return EXIT_USAGE
+		}
+		if args[0] == "help" {
+			return c.printHelp(path, args[1:])
+		}
+		if command := c.find(args[0]); command != nil {
+			return command.execute(path+" "+args[0], args[1:])
+		}
+		if c.Fallback != nil {
+			if c.Fallback.SetOperand != nil {
+				c.Fallback.SetOperand(args[0])
+			}
+			return c.Fallback.execute(path+" "+args[0], args[1:])
+		}
+		fmt.Fprintln(output, "unknown command:", args[0])
+		fmt.Fprint(output, "usage: "+c.usage(path))
+		return EXIT_USAGE
+	}
+	if len(args) < c.MinArgs || (c.MaxArgs != UNLIMITED && len(args) > c.MaxArgs) {
+		fmt.Fprint(output, "usage: "+c.usage(path))
+		return EXIT_USAGE
+	}
+	return c.Run(fs)
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// ParseFlags parses the flags of the flag set, which can be given among the
+// other arguments. The arguments following "--" are not parsed.
+func ParseFlags(fs *flag.FlagSet, args []string) error {
+	var positional []string
+	for len(args) > 0 {
+		err := fs.Parse(args)
+		if err != nil {
+			return err
+		}
+		rest := fs.Args()
+		parsed := len(args) - len(rest)
+		if parsed > 0 && args[parsed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	return fs.Parse(append([]string{"--"}, positional...))
+}
+
+// Execute runs the command with the arguments of the command line, and returns
+// the exit code.
+func (c *Command) Execute(args []string) int {
+	return c.execute(c.Name, args)
+}
@@ -0,0 +1,125 @@
+package cli
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the tree of subcommands.
+*/
+
+import (
+	"bytes"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Helpers
+//------------------------------------------------------------------------------
+
+// testTree returns a tree with a subcommand and a fallback, and records the
+// arguments it runs.
+func testTree(ran *[]string) *Command {
+	var verbose, asJSON bool
+	var operand string
+	return &Command{
+		Name:  "tool",
+		Flags: func(fs *flag.FlagSet) { fs.BoolVar(&verbose, "v", false, "verbose") },
+		Commands: []*Command{{
+			Name:    "validate",
+			Args:    "<files...>",
+			MinArgs: 1,
+			MaxArgs: UNLIMITED,
+			Run: func(fs *flag.FlagSet) int {
+				*ran = append([]string{"validate"}, fs.Args()...)
+				return 0
+			},
+		}},
+		Fallback: &Command{
+			Name:       "<addr>",
+			SetOperand: func(o string) { operand = o },
+			Commands: []*Command{{
+				Name:    "get",
+				Summary: "get the value",
+				Flags:   func(fs *flag.FlagSet) { fs.BoolVar(&asJSON, "json", false, "print as JSON") },
+				MaxArgs: 1,
+				Run: func(fs *flag.FlagSet) int {
+					*ran = append([]string{operand, "get"}, fs.Args()...)
+					if asJSON {
+						*ran = append(*ran, "json")
+					}
+					if verbose {
+						*ran = append(*ran, "verbose")
+					}
+					return 0
+				},
+			}},
+		},
+	}
+}
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestParseFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := fs.String("f", "", "file")
+	json := fs.Bool("json", false, "JSON")
+	err := ParseFlags(fs, []string{"a", "-f", "x.json", "b", "--json", "--", "-c"})
+	if err != nil {
+		t.Fatal("Error parsing flags:", err)
+	}
+	if *f != "x.json" || !*json || !reflect.DeepEqual(fs.Args(), []string{"a", "b", "-c"}) {
+		t.Errorf("Error parsing flags: got -f %q, -json %t and arguments %v", *f, *json, fs.Args())
+	}
+}
+
+func TestExecute(t *testing.T) {
+	var buffer bytes.Buffer
+	output = &buffer
+	tests := []struct {
+		args     []string
+		exitCode int
+		ran      []string
+	}{
+		{[]string{"validate", "a", "b"}, 0, []string{"validate", "a", "b"}},
+		{[]string{"validate"}, EXIT_USAGE, nil},
+		{[]string{"-v", "127.0.0.1:1", "get", "key", "-json"}, 0, []string{"127.0.0.1:1", "get", "key", "json", "verbose"}},
+		{[]string{"127.0.0.1:1", "get", "a", "b"}, EXIT_USAGE, nil},
+		{[]string{"127.0.0.1:1", "set"}, EXIT_USAGE, nil},
+		{[]string{"127.0.0.1:1"}, EXIT_USAGE, nil},
+		{[]string{}, EXIT_USAGE, nil},
+		{[]string{"127.0.0.1:1", "get", "--help"}, 0, nil},
+		{[]string{"help", "127.0.0.1:1", "get"}, 0, nil},
+	}
+	for _, test := range tests {
+		var ran []string
+		exitCode := testTree(&ran).Execute(test.args)
+		if exitCode != test.exitCode || !reflect.DeepEqual(ran, test.ran) {
+			t.Errorf("Error executing %v: got exit code %d running %v, expected %d running %v", test.args, exitCode, ran, test.exitCode, test.ran)
+		}
+	}
+	buffer.Reset()
+	testTree(new([]string)).Execute([]string{"help", "127.0.0.1:1", "get"})
+	if !strings.HasPrefix(buffer.String(), "Usage: tool <addr> get [options]\n") || !strings.Contains(buffer.String(), "-json") {
+		t.Error("Error printing help:\n" + buffer.String())
+	}
+}
+
+func TestBashCompletion(t *testing.T) {
+	var buffer bytes.Buffer
+	testTree(new([]string)).WriteBashCompletion(&buffer)
+	script := buffer.String()
+	for _, expected := range []string{
+		`"") case "$word" in validate|help) path="$path/$word" ;; *) path="$path/*" ;; esac ;;`,
+		`"/*") words="get help" ;;`,
+		`"/*/get") case "$cur" in -*) words="-json" ;;`,
+		"complete -F _tool tool",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("Error writing completion: %q not found in\n%s", expected, script)
+		}
+	}
+}
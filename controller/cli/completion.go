@@ -0,0 +1,134 @@
+package cli
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to generate the bash and zsh
+completion scripts of a tree of subcommands.
+*/
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// completionNode is a command of the tree, identified by the path of the
+// names of the commands leading to it, "*" standing for the operand of a
+// fallback.
+type completionNode struct {
+	path string
+	// commands are the names of the subcommands, and fallback is true if any
+	// other word is the operand of a fallback.
+	commands []string
+	fallback bool
+	// flags are the flags of the command, and valueFlags those taking a value.
+	flags      []string
+	valueFlags []string
+}
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// completionNodes returns the nodes of the tree of the command, in depth-first
+// order.
+func (c *Command) completionNodes(path string) []completionNode {
+	node := completionNode{path: path, fallback: c.Fallback != nil}
+	c.flagSet(path).VisitAll(func(f *flag.Flag) {
+		node.flags = append(node.flags, "-"+f.Name)
+		if boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !boolFlag.IsBoolFlag() {
+			node.valueFlags = append(node.valueFlags, "-"+f.Name, "--"+f.Name)
+		}
+	})
+	for _, command := range c.Commands {
+		node.commands = append(node.commands, command.Name)
+	}
+	if c.isGroup() {
+		node.commands = append(node.commands, "help")
+	}
+	nodes := []completionNode{node}
+	for _, command := range c.Commands {
+		nodes = append(nodes, command.completionNodes(path+"/"+command.Name)...)
+	}
+	if c.Fallback != nil {
+		nodes = append(nodes, c.Fallback.completionNodes(path+"/*")...)
+	}
+	return nodes
+}
+
+// writeBashFunction writes the bash function completing the command line of
+// the command.
+func (c *Command) writeBashFunction(w io.Writer) {
+	nodes := c.completionNodes("")
+	fmt.Fprintf(w, "_%s() {\n", c.Name)
+	fmt.Fprintln(w, `	local cur="${COMP_WORDS[COMP_CWORD]}" path="" skip=0 files=0 word i words`)
+	// follow the commands typed before the current word
+	fmt.Fprintln(w, `	for ((i = 1; i < COMP_CWORD; i++)); do`)
+	fmt.Fprintln(w, `		word="${COMP_WORDS[i]}"`)
+	fmt.Fprintln(w, `		if [ "$skip" = 1 ]; then skip=0; continue; fi`)
+	fmt.Fprintln(w, `		case "$path" in`)
+	for _, node := range nodes {
+		if len(node.valueFlags) > 0 {
+			fmt.Fprintf(w, "\t\t%q) case \"$word\" in %s) skip=1; continue ;; esac ;;\n", node.path, strings.Join(node.valueFlags, "|"))
+		}
+	}
+	fmt.Fprintln(w, `		esac`)
+	fmt.Fprintln(w, `		case "$word" in -*) continue ;; esac`)
+	fmt.Fprintln(w, `		case "$path" in`)
+	for _, node := range nodes {
+		if len(node.commands) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\t\t%q) case \"$word\" in %s) path=\"$path/$word\" ;;", node.path, strings.Join(node.commands, "|"))
+		if node.fallback {
+			fmt.Fprint(w, " *) path=\"$path/*\" ;;")
+		}
+		fmt.Fprintln(w, " esac ;;")
+	}
+	fmt.Fprintln(w, `		esac`)
+	fmt.Fprintln(w, `	done`)
+	// complete the value of a flag and the arguments of a command with files
+	fmt.Fprintln(w, `	if [ "$skip" = 1 ]; then COMPREPLY=($(compgen -f -- "$cur")); return; fi`)
+	fmt.Fprintln(w, `	case "$path" in`)
+	for _, node := range nodes {
+		words := append(append([]string{}, node.commands...), node.flags...)
+		if len(node.commands) == 0 {
+			fmt.Fprintf(w, "\t%q) case \"$cur\" in -*) words=%q ;; *) COMPREPLY=($(compgen -f -- \"$cur\")); return ;; esac ;;\n", node.path, strings.Join(words, " "))
+		} else if node.fallback && len(node.commands) == 1 {
+			// the operand is completed as a file, e.g. an inventory file
+			fmt.Fprintf(w, "\t%q) words=%q; files=1 ;;\n", node.path, strings.Join(words, " "))
+		} else {
+			fmt.Fprintf(w, "\t%q) words=%q ;;\n", node.path, strings.Join(words, " "))
+		}
+	}
+	fmt.Fprintln(w, `	esac`)
+	fmt.Fprintln(w, `	COMPREPLY=($(compgen -W "$words" -- "$cur"))`)
+	fmt.Fprintln(w, `	if [ "$files" = 1 ]; then COMPREPLY+=($(compgen -f -- "$cur")); fi`)
+	fmt.Fprintln(w, "}")
+	fmt.Fprintf(w, "complete -F _%s %s\n", c.Name, c.Name)
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// WriteBashCompletion writes the bash completion script of the command, to be
+// sourced by bash.
+func (c *Command) WriteBashCompletion(w io.Writer) {
+	fmt.Fprintf(w, "# bash completion for %s\n", c.Name)
+	c.writeBashFunction(w)
+}
+
+// WriteZshCompletion writes the zsh completion script of the command, which
+// runs the bash completion through bashcompinit.
+func (c *Command) WriteZshCompletion(w io.Writer) {
+	fmt.Fprintf(w, "#compdef %s\n", c.Name)
+	fmt.Fprintln(w, "autoload -U +X bashcompinit && bashcompinit")
+	c.writeBashFunction(w)
+}
@@ -0,0 +1,298 @@
+package main
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tree of the commands of the controller.
+*/
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"semester-project/controller/cli"
+	"semester-project/controller/messages"
+	"semester-project/controller/sender"
+	"semester-project/wire"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// options are the options of the controller shared by its commands.
+type options struct {
+	identity string
+	key      string
+	dryRun   bool
+	// proxyAddr is the address of the proxy the commands are sent to.
+	proxyAddr string
+	// inventory is the file listing the proxies of a rollout.
+	inventory string
+}
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// credentials returns the credentials signing the messages.
+func (o *options) credentials() sender.Credentials {
+	return sender.Credentials{Identity: o.identity, Key: []byte(o.key)}
+}
+
+// withoutDryRun returns the run function of a command that does not support
+// --dry-run, which rejects the flag instead of running the command for real.
+func (o *options) withoutDryRun(name string, run func(fs *flag.FlagSet) int) func(fs *flag.FlagSet) int {
+	return func(fs *flag.FlagSet) int {
+		if o.dryRun {
+			fmt.Fprintf(os.Stderr, "--dry-run is not supported by %s, nothing was sent\n", name)
+			return EXIT_ERROR
+		}
+		return run(fs)
+	}
+}
+
+// runMessage sends the message of the command to the proxy, or prints it
+// with --dry-run, and prints the reply.
+// It returns the exit code of the controller.
+func runMessage(o *options, command *messages.Command, fs *flag.FlagSet) int {
+	message, err := command.BuildMessage(fs)
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	// print the message instead of sending it
+	if o.dryRun {
+		return dryRun(o.credentials(), message)
+	}
+	reply, err := sender.Send(o.proxyAddr, o.credentials(), message)
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	return printReply(command, fs, reply)
+}
+
+// messageCommand returns the command sending the message of the command to
+// the proxy.
+func messageCommand(command *messages.Command, run func(fs *flag.FlagSet) int) *cli.Command {
+	return &cli.Command{
+		Name:    command.Name,
+		Args:    command.Args,
+		Summary: command.Summary,
+		MinArgs: command.MinArgs,
+		MaxArgs: command.MaxArgs,
+		Flags:   command.Flags,
+		Run:     run,
+	}
+}
+
+// proxyCommands returns the commands sent to the proxy whose address is the
+// operand of the command.
+func proxyCommands(o *options) *cli.Command {
+	proxy := &cli.Command{
+		Name:       "<proxy address:port>",
+		SetOperand: func(operand string) { o.proxyAddr = operand },
+	}
+	for _, command := range messages.Commands {
+		command := command
+		if command.Name == "watch" {
+			// the events are streamed on the session
+			proxy.Commands = append(proxy.Commands, messageCommand(command, o.withoutDryRun(command.Name, func(fs *flag.FlagSet) int {
+				return runWatch(o.proxyAddr, o.credentials())
+			})))
+			continue
+		}
+		proxy.Commands = append(proxy.Commands, messageCommand(command, func(fs *flag.FlagSet) int {
+			return runMessage(o, command, fs)
+		}))
+	}
+	proxy.Commands = append(proxy.Commands, &cli.Command{
+		Name:        "batch",
+		Args:        "[file]",
+		Summary:     "run the commands of a file, or of the standard input, on a single session",
+		Description: "The commands are read one per line. Empty lines and lines starting with '#' are ignored.",
+		MaxArgs:     1,
+		Run: o.withoutDryRun("batch", func(fs *flag.FlagSet) int {
+			return runBatch(o.proxyAddr, o.credentials(), fs.Arg(0))
+		}),
+	})
+	return proxy
+}
+
+// rolloutCommand returns the command rolling a config out to the proxies of
+// an inventory.
+func rolloutCommand(o *options) *cli.Command {
+	inventory := &cli.Command{
+		Name:       "<inventory file>",
+		SetOperand: func(operand string) { o.inventory = operand },
+	}
+	for _, name := range []string{"change-flow", "set-config"} {
+		command := messages.FindCommand(name)
+		inventory.Commands = append(inventory.Commands, messageCommand(command, o.withoutDryRun("rollout", func(fs *flag.FlagSet) int {
+			message, err := command.BuildMessage(fs)
+			if err != nil {
+				fmt.Println(err)
+				return EXIT_ERROR
+			}
+			var config wire.Config
+			err = message.DecodePayload(&config)
+			if err != nil {
+				fmt.Println(err)
+				return EXIT_ERROR
+			}
+			return runRollout(o.credentials(), o.inventory, config)
+		})))
+	}
+	return &cli.Command{
+		Name:    "rollout",
+		Summary: "apply a config on all the proxies of an inventory, or on none of them",
+		Description: `The inventory lists the addresses of the proxies, one per line. The config
+is prepared on every proxy, then committed on all of them, or aborted if any
+proxy rejected it.`,
+		Fallback: inventory,
+	}
+}
+
+// newRootCommand returns the tree of the commands of the controller.
+func newRootCommand() *cli.Command {
+	o := &options{}
+	root := &cli.Command{
+		Name: "controller",
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&o.identity, "identity", os.Getenv("CONTROLLER_IDENTITY"), "identity signing the messages, defaults to $CONTROLLER_IDENTITY (messages are not signed if empty)")
+			fs.StringVar(&o.key, "key", os.Getenv("CONTROLLER_KEY"), "secret key signing the messages, defaults to $CONTROLLER_KEY")
+			fs.BoolVar(&o.dryRun, "dry-run", false, "validate the config and print the message instead of sending it (single messages only)")
+		},
+		Fallback: proxyCommands(o),
+	}
+	var reportPath string
+	var topInterval time.Duration
+	var topChain, topToken string
+	var demoFrom, demoTo, demoAmount string
+	var demoTimeout time.Duration
+	root.Commands = []*cli.Command{
+		rolloutCommand(o),
+		{
+			Name:    "scenario",
+			Summary: "run experiments described by scenario files",
+			Commands: []*cli.Command{{
+				Name:    "run",
+				Args:    "<scenario file>",
+				Summary: "run the steps of a scenario and report which passed",
+				MinArgs: 1,
+				MaxArgs: 1,
+				Flags: func(fs *flag.FlagSet) {
+					fs.StringVar(&reportPath, "report", "", "file the report is written to, as JSON if it ends with .json")
+				},
+				Run: o.withoutDryRun("scenario run", func(fs *flag.FlagSet) int {
+					return runScenario(o.credentials(), fs.Arg(0), reportPath)
+				}),
+			}},
+		},
+		{
+			Name:    "demo",
+			Summary: "run the twin attack end to end and show whether it deceived the client",
+			Commands: []*cli.Command{{
+				Name:    "quorum",
+				Args:    "<proxy address:port> <twin node address:port> <honest node address:port>",
+				Summary: "send a transfer on the twin chain and compare the proxy with the honest chain",
+				Description: `Sends a transfer from Alice to Bob on the twin node, waits for it to be
+included, then queries the transfer and the balance of Bob through the client
+port of the proxy and directly on the honest node. Alice must be unlocked on
+the twin node. Exits with 3 if the deception did not work.`,
+				MinArgs: 3,
+				MaxArgs: 3,
+				Flags: func(fs *flag.FlagSet) {
+					fs.StringVar(&demoFrom, "from", "", "account of Alice, unlocked on the twin node")
+					fs.StringVar(&demoTo, "to", "", "account of Bob")
+					fs.StringVar(&demoAmount, "amount", "1", "amount of the transfer, in ether")
+					fs.DurationVar(&demoTimeout, "timeout", time.Minute, "time to wait for the transfer to be included")
+				},
+				Run: o.withoutDryRun("demo quorum", func(fs *flag.FlagSet) int {
+					if demoFrom == "" || demoTo == "" {
+						fmt.Fprintln(os.Stderr, "The accounts of Alice and Bob must be given with -from and -to")
+						return EXIT_ERROR
+					}
+					return runDemoQuorum(fs.Arg(0), fs.Arg(1), fs.Arg(2), demoFrom, demoTo, demoAmount, demoTimeout)
+				}),
+			}},
+		},
+		{
+			Name:    "shell",
+			Args:    "<proxy address:port>",
+			Summary: "type commands interactively on a single session with the proxy",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Run: o.withoutDryRun("shell", func(fs *flag.FlagSet) int {
+				return runShell(o.credentials(), fs.Arg(0))
+			}),
+		},
+		{
+			Name:    "top",
+			Args:    "<proxy address:port>",
+			Summary: "show the flows, sessions and config changes of the proxy live",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Flags: func(fs *flag.FlagSet) {
+				fs.DurationVar(&topInterval, "interval", time.Second, "refresh interval")
+				fs.StringVar(&topChain, "chain", "", "chain of the nodes whose height is shown, quorum or algorand (by default only the nodes of the triggers)")
+				fs.StringVar(&topToken, "token", "", "API token of the Algorand nodes")
+			},
+			Run: o.withoutDryRun("top", func(fs *flag.FlagSet) int {
+				if topChain != "" && topChain != wire.ChainQuorum && topChain != wire.ChainAlgorand {
+					fmt.Fprintln(os.Stderr, "Invalid chain:", topChain)
+					return EXIT_ERROR
+				}
+				return runTop(fs.Arg(0), o.credentials(), topInterval, topChain, topToken)
+			}),
+		},
+		{
+			Name:    "sign-request",
+			Args:    "<method> <uri> [body file]",
+			Summary: "print the header signing a request of the admin API, e.g. for curl -H",
+			Description: `The URI is the path of the request with its query, e.g. /audit?limit=10,
+and the body of the request is read from the file, if any. The signature can
+only be used once, within the -auth-window of the proxy.`,
+			MinArgs: 2,
+			MaxArgs: 3,
+			Run: func(fs *flag.FlagSet) int {
+				return runSignRequest(o.credentials(), fs.Arg(0), fs.Arg(1), fs.Arg(2))
+			},
+		},
+		{
+			Name:    "validate",
+			Args:    "<config or scenario files...>",
+			Summary: "validate config and scenario files without sending them",
+			MinArgs: 1,
+			MaxArgs: cli.UNLIMITED,
+			Run: func(fs *flag.FlagSet) int {
+				return runValidate(fs.Args())
+			},
+		},
+		{
+			Name:    "completion",
+			Summary: "print the completion script of a shell",
+			Commands: []*cli.Command{
+				{
+					Name:    "bash",
+					Summary: "print the bash completion script, e.g. for . <(controller completion bash)",
+					Run: func(fs *flag.FlagSet) int {
+						root.WriteBashCompletion(os.Stdout)
+						return 0
+					},
+				},
+				{
+					Name:    "zsh",
+					Summary: "print the zsh completion script, e.g. for source <(controller completion zsh)",
+					Run: func(fs *flag.FlagSet) int {
+						root.WriteZshCompletion(os.Stdout)
+						return 0
+					},
+				},
+			},
+		},
+	}
+	return root
+}
@@ -0,0 +1,57 @@
+package main
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the commands of the controller.
+*/
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+// TestDryRunRejected tests that the commands that cannot print their messages
+// instead of sending them reject --dry-run without connecting to the proxy.
+func TestDryRunRejected(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening:", err)
+	}
+	defer listener.Close()
+	connected := make(chan struct{}, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			connected <- struct{}{}
+			conn.Close()
+		}
+	}()
+	batchPath := filepath.Join(t.TempDir(), "batch")
+	err = os.WriteFile(batchPath, []byte("clear-config\n"), 0644)
+	if err != nil {
+		t.Fatal("Error writing batch file:", err)
+	}
+	addr := listener.Addr().String()
+	for _, args := range [][]string{
+		{"--dry-run", addr, "batch", batchPath},
+		{"--dry-run", addr, "watch"},
+		{"--dry-run", "shell", addr},
+	} {
+		if code := newRootCommand().Execute(args); code != EXIT_ERROR {
+			t.Errorf("Error running %v: exit code %d, expected %d", args, code, EXIT_ERROR)
+		}
+	}
+	select {
+	case <-connected:
+		t.Error("Error rejecting --dry-run: the proxy was contacted")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
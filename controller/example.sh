@@ -35,9 +35,12 @@ countdown 10
 ./controller 127.0.0.1:9000 change-flow destination-nodes 127.0.0.1:8001 127.0.0.1:8002 response-node 127.0.0.1:8002
 echo "Configuration sent"
 countdown 10
-# send an invalid confirguration for debugging purpose
-./controller 127.0.0.1:9000 change-flow destination-nodes 127.0.0.1:8001 response-node 127.0.0.1:8002
-echo "Configuration sent"
+# send an invalid confirguration for debugging purpose, the proxy rejects it
+if ./controller 127.0.0.1:9000 change-flow destination-nodes 127.0.0.1:8001 response-node 127.0.0.1:8002; then
+  echo "Invalid configuration applied"
+else
+  echo "Invalid configuration rejected (exit code $?)"
+fi
 countdown 10
 # resend a valid configuration
 ./controller 127.0.0.1:9000 change-flow destination-nodes 127.0.0.1:8001 127.0.0.1:8002 response-node 127.0.0.1:8001
@@ -1,3 +1,13 @@
 module semester-project/controller
 
 go 1.20
+
+require (
+	golang.org/x/term v0.10.0
+	gopkg.in/yaml.v3 v3.0.1
+	semester-project/wire v0.0.0
+)
+
+require golang.org/x/sys v0.10.0 // indirect
+
+replace semester-project/wire => ../wire
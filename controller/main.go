@@ -7,29 +7,57 @@ Description: This file contains the entry point of the controller.
 */
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"semester-project/controller/messages"
-	"semester-project/controller/sender"
+	"semester-project/wire"
 )
 
-func main() {
-	// read arguments
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: controller <proxy address:port> <command> [args...]")
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// Exit codes of the controller.
+const (
+	// EXIT_ERROR is returned when the command line is invalid, when the
+	// message could not be built or sent, or when the reply of the proxy could
+	// not be read.
+	EXIT_ERROR = 1
+	// EXIT_REJECTED is returned when the proxy rejected the message, or when
+	// the config was found invalid before sending it.
+	EXIT_REJECTED = 2
+	// EXIT_FAILED is returned when a step of a scenario failed, or when the
+	// deception of the demo failed.
+	EXIT_FAILED = 3
+)
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// printReply prints the reply of the proxy to the command, given with its
+// parsed arguments, and returns the exit code matching it.
+func printReply(command *messages.Command, fs *flag.FlagSet, reply wire.Reply) int {
+	for _, fieldErr := range reply.Errors {
+		fmt.Println("error:", fieldErr)
 	}
-	proxyAddr := os.Args[1]
-	args := os.Args[2:]
-	// parse command
-	message, err := messages.CreateCommandMessage(args)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	for _, warning := range reply.Warnings {
+		fmt.Println("warning:", warning)
+	}
+	if !reply.Succeeded() {
+		fmt.Println("Rejected by the proxy")
+		return EXIT_REJECTED
 	}
-	// send the message
-	err = sender.Send(proxyAddr, message)
+	text, err := command.FormatReply(fs, reply)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		fmt.Println("Error reading proxy reply:", err)
+		return EXIT_ERROR
 	}
+	fmt.Print(text)
+	return 0
+}
+
+func main() {
+	os.Exit(newRootCommand().Execute(os.Args[1:]))
 }
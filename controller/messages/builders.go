@@ -9,68 +9,147 @@ Description: This file contains the code to build messages to send to the proxy.
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
+	"flag"
+	"os"
+	"semester-project/wire"
+	"strconv"
 )
 
-//------------------------------------------------------------------------------
-// Types
-//------------------------------------------------------------------------------
-
-// A Node is a destination node for the proxy.
-type Node struct {
-	Addr string `json:"addr"`
-}
-
-// A Config is the configuration for the proxy.
-// It contains the list of destination nodes and the node to use for the
-// response.
-type Config struct {
-	Nodes            []Node `json:"nodes"`
-	ResponseNodeAddr string `json:"responseNodeAddr"`
-}
-
 //------------------------------------------------------------------------------
 // Private methods (Message builders)
 //------------------------------------------------------------------------------
 
-// changeFlowMessageBuilder builds the message to change the flow.
-func changeFlowMessageBuilder(args []string) (string, error) {
-	if len(args) < 2 {
-		fmt.Println("A")
-		return "", errors.New("usage: controller change-flow destination-nodes [nodes...] response-node [node]")
-	}
-	// parse the destination nodes
-	if args[0] != "destination-nodes" {
-		fmt.Println("B")
-		return "", errors.New("usage: controller change-flow destination-nodes [nodes...] response-node [node]")
+// parseFlow parses a flow given as
+// destination-nodes [nodes...] response-node [node]
+// ErrUsage is returned if the flow is malformed.
+func parseFlow(args []string) (wire.Config, error) {
+	if len(args) < 2 || args[0] != "destination-nodes" {
+		return wire.Config{}, ErrUsage
 	}
-	destinationNodes := []Node{}
+	destinationNodes := []wire.Node{}
 	for i := 1; i < len(args); i++ {
 		if args[i] == "response-node" {
 			args = args[i:]
 			break
 		}
-		destinationNodes = append(destinationNodes, Node{Addr: args[i]})
+		destinationNodes = append(destinationNodes, wire.Node{Addr: args[i]})
 	}
 	// parse the response node
-	if args[0] != "response-node" {
-		fmt.Println("C")
-		return "", errors.New("usage: controller change-flow destination-nodes [nodes...] response-node [node]")
+	if args[0] != "response-node" || len(args) > 2 {
+		return wire.Config{}, ErrUsage
 	}
 	responseNode := ""
 	if len(args) > 1 {
 		responseNode = args[1]
 	}
 	// create the config
-	config := Config{
+	return wire.Config{
 		Nodes:            destinationNodes,
 		ResponseNodeAddr: responseNode,
+	}, nil
+}
+
+// changeFlowMessageBuilder builds the message to change the flow.
+func changeFlowMessageBuilder(fs *flag.FlagSet) (wire.Message, error) {
+	config, err := parseFlow(fs.Args())
+	if err != nil {
+		return wire.Message{}, err
+	}
+	return wire.NewMessage(wire.TypeSetConfig, config)
+}
+
+// readConfigFile reads the config from the file given by the -f flag.
+func readConfigFile(fs *flag.FlagSet) (wire.Config, error) {
+	path := fs.Lookup("f").Value.String()
+	if path == "" || fs.NArg() != 0 {
+		return wire.Config{}, ErrUsage
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return wire.Config{}, err
+	}
+	var config wire.Config
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return wire.Config{}, errors.New("error parsing " + path + ": " + err.Error())
+	}
+	return config, nil
+}
+
+// setConfigMessageBuilder builds the message to set the config from a file.
+func setConfigMessageBuilder(fs *flag.FlagSet) (wire.Message, error) {
+	config, err := readConfigFile(fs)
+	if err != nil {
+		return wire.Message{}, err
 	}
-	// create the message
-	message, err := json.Marshal(config)
+	return wire.NewMessage(wire.TypeSetConfig, config)
+}
+
+// getConfigMessageBuilder builds the message to read the active config.
+// The -json flag only changes how the reply is printed.
+func getConfigMessageBuilder(fs *flag.FlagSet) (wire.Message, error) {
+	return wire.NewMessage(wire.TypeGetConfig, nil)
+}
+
+// diffMessageBuilder builds the message to compare a config file with the
+// active config.
+func diffMessageBuilder(fs *flag.FlagSet) (wire.Message, error) {
+	config, err := readConfigFile(fs)
 	if err != nil {
-		fmt.Println("D")
-		return "", err
+		return wire.Message{}, err
+	}
+	return wire.NewMessage(wire.TypeDiffConfig, config)
+}
+
+// savePresetMessageBuilder builds the message to save a preset.
+// Without flow, the active config of the proxy is saved.
+func savePresetMessageBuilder(fs *flag.FlagSet) (wire.Message, error) {
+	payload := wire.PresetPayload{Name: fs.Arg(0)}
+	if fs.NArg() > 1 {
+		config, err := parseFlow(fs.Args()[1:])
+		if err != nil {
+			return wire.Message{}, err
+		}
+		payload.Config = &config
+	}
+	return wire.NewMessage(wire.TypeSavePreset, payload)
+}
+
+// presetMessageBuilder returns a builder of the message of the given type,
+// whose only argument is the name of the preset.
+func presetMessageBuilder(messageType string) func(fs *flag.FlagSet) (wire.Message, error) {
+	return func(fs *flag.FlagSet) (wire.Message, error) {
+		return wire.NewMessage(messageType, wire.PresetPayload{Name: fs.Arg(0)})
+	}
+}
+
+// noArgMessageBuilder returns a builder of the message of the given type,
+// without payload.
+func noArgMessageBuilder(messageType string) func(fs *flag.FlagSet) (wire.Message, error) {
+	return func(fs *flag.FlagSet) (wire.Message, error) {
+		return wire.NewMessage(messageType, nil)
+	}
+}
+
+// killMessageBuilder builds the message to kill a client session.
+func killMessageBuilder(fs *flag.FlagSet) (wire.Message, error) {
+	id, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil {
+		return wire.Message{}, ErrUsage
+	}
+	return wire.NewMessage(wire.TypeKillSession, wire.SessionPayload{ID: id})
+}
+
+// auditMessageBuilder builds the message to read the audit log, optionally
+// limited to its last entries.
+func auditMessageBuilder(fs *flag.FlagSet) (wire.Message, error) {
+	var query wire.AuditQuery
+	if fs.NArg() == 1 {
+		limit, err := strconv.Atoi(fs.Arg(0))
+		if err != nil || limit < 0 {
+			return wire.Message{}, ErrUsage
+		}
+		query.Limit = limit
 	}
-	return string(message), nil
+	return wire.NewMessage(wire.TypeAudit, query)
 }
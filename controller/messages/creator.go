@@ -8,33 +8,216 @@ Description: This file contains the code to create messages to send to the proxy
 
 import (
 	"errors"
+	"flag"
+	"io"
+	"semester-project/controller/cli"
+	"semester-project/wire"
 )
 
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A Command is a command sent to the proxy as a single message.
+type Command struct {
+	Name string
+	// Args is the synopsis of the arguments of the command.
+	Args    string
+	Summary string
+	// MinArgs and MaxArgs bound the number of arguments left after the flags.
+	// MaxArgs is cli.UNLIMITED if there is no bound.
+	MinArgs int
+	MaxArgs int
+	// Flags defines the flags of the command, if any.
+	Flags func(fs *flag.FlagSet)
+	// build builds the message from the parsed arguments. It returns
+	// ErrUsage if they are invalid.
+	build func(fs *flag.FlagSet) (wire.Message, error)
+	// format formats the payload of the reply of the proxy, if any.
+	format func(fs *flag.FlagSet, reply wire.Reply) (string, error)
+}
+
+//------------------------------------------------------------------------------
+// Errors
+//------------------------------------------------------------------------------
+
+// ErrUsage is returned by the builders when the arguments are invalid. It is
+// replaced by the usage of the command.
+var ErrUsage = errors.New("invalid arguments")
+
+//------------------------------------------------------------------------------
+// Public variables
+//------------------------------------------------------------------------------
+
+// Commands are the commands sent to the proxy as a single message.
+var Commands = []*Command{
+	{
+		Name:    "change-flow",
+		Args:    "destination-nodes [nodes...] response-node [node]",
+		Summary: "send the client traffic to the nodes and use the responses of the response node",
+		MinArgs: 2,
+		MaxArgs: cli.UNLIMITED,
+		build:   changeFlowMessageBuilder,
+	},
+	{
+		Name:    "set-config",
+		Args:    "-f <config file>",
+		Summary: "apply the config of a JSON file",
+		Flags:   func(fs *flag.FlagSet) { fs.String("f", "", "JSON config file") },
+		build:   setConfigMessageBuilder,
+	},
+	{
+		Name:    "get-config",
+		Summary: "print the active config",
+		Flags:   func(fs *flag.FlagSet) { fs.Bool("json", false, "print the config as JSON") },
+		build:   getConfigMessageBuilder,
+		format:  getConfigReplyFormatter,
+	},
+	{
+		Name:    "diff",
+		Args:    "-f <config file>",
+		Summary: "print what the config of a JSON file would change, without applying it",
+		Flags:   func(fs *flag.FlagSet) { fs.String("f", "", "JSON config file") },
+		build:   diffMessageBuilder,
+		format:  diffReplyFormatter,
+	},
+	{
+		Name:    "save-preset",
+		Args:    "<name> [destination-nodes [nodes...] response-node [node]]",
+		Summary: "save the active config, or the given flow, as a preset",
+		MinArgs: 1,
+		MaxArgs: cli.UNLIMITED,
+		build:   savePresetMessageBuilder,
+	},
+	{
+		Name:    "apply-preset",
+		Args:    "<name>",
+		Summary: "apply a preset",
+		MinArgs: 1,
+		MaxArgs: 1,
+		build:   presetMessageBuilder(wire.TypeApplyPreset),
+	},
+	{
+		Name:    "delete-preset",
+		Args:    "<name>",
+		Summary: "delete a preset",
+		MinArgs: 1,
+		MaxArgs: 1,
+		build:   presetMessageBuilder(wire.TypeDeletePreset),
+	},
+	{
+		Name:    "list-presets",
+		Summary: "list the presets",
+		build:   noArgMessageBuilder(wire.TypeListPresets),
+		format:  listPresetsReplyFormatter,
+	},
+	{
+		Name:    "sessions",
+		Summary: "list the client sessions",
+		build:   noArgMessageBuilder(wire.TypeListSessions),
+		format:  sessionsReplyFormatter,
+	},
+	{
+		Name:    "kill",
+		Args:    "<session id>",
+		Summary: "close a client session",
+		MinArgs: 1,
+		MaxArgs: 1,
+		build:   killMessageBuilder,
+	},
+	{
+		Name:    "audit",
+		Args:    "[limit]",
+		Summary: "print the audit log, or its last entries",
+		MaxArgs: 1,
+		build:   auditMessageBuilder,
+		format:  auditReplyFormatter,
+	},
+	{
+		Name:    "watch",
+		Summary: "print the events of the proxy until it stops",
+		build:   noArgMessageBuilder(wire.TypeWatch),
+	},
+}
+
 //------------------------------------------------------------------------------
 // Public methods
 //------------------------------------------------------------------------------
 
-// CreateCommandMessage creates a message to send to the proxy.
-func CreateCommandMessage(args []string) (string, error) {
-	// initialize message and error
-	var message string
-	var err error
-	// parse command
+// FindCommand returns the command of the given name, or nil.
+func FindCommand(name string) *Command {
+	for _, command := range Commands {
+		if command.Name == name {
+			return command
+		}
+	}
+	return nil
+}
+
+// Usage returns the usage of the command.
+func (c *Command) Usage() error {
+	usage := "usage: controller " + c.Name
+	if c.Args != "" {
+		usage += " " + c.Args
+	}
+	return errors.New(usage)
+}
+
+// FlagSet returns the flag set of the command, whose errors are returned
+// without being printed.
+func (c *Command) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if c.Flags != nil {
+		c.Flags(fs)
+	}
+	return fs
+}
+
+// ParseCommand finds the command of the arguments and parses its flags.
+func ParseCommand(args []string) (*Command, *flag.FlagSet, error) {
 	if len(args) < 1 {
-		return "", errors.New("usage: controller <command> [args...]")
+		return nil, nil, errors.New("usage: controller <command> [args...]")
+	}
+	command := FindCommand(args[0])
+	if command == nil {
+		return nil, nil, errors.New("unknown command: " + args[0])
+	}
+	fs := command.FlagSet()
+	err := cli.ParseFlags(fs, args[1:])
+	if err != nil || fs.NArg() < command.MinArgs || (command.MaxArgs != cli.UNLIMITED && fs.NArg() > command.MaxArgs) {
+		return nil, nil, command.Usage()
+	}
+	return command, fs, nil
+}
+
+// BuildMessage builds the message of the command from its parsed arguments.
+func (c *Command) BuildMessage(fs *flag.FlagSet) (wire.Message, error) {
+	message, err := c.build(fs)
+	if errors.Is(err, ErrUsage) {
+		return wire.Message{}, c.Usage()
 	}
-	command := args[0]
-	args = args[1:]
-	// parse arguments
-	switch command {
-	case "change-flow":
-		message, err = changeFlowMessageBuilder(args)
-	default:
-		return "", errors.New("unknown command: " + command)
+	return message, err
+}
+
+// BuildMessage builds the message of the command to send to the proxy.
+func BuildMessage(args []string) (wire.Message, error) {
+	command, fs, err := ParseCommand(args)
+	if err != nil {
+		return wire.Message{}, err
+	}
+	return command.BuildMessage(fs)
+}
+
+// CreateCommandMessage creates the encoded message to send to the proxy.
+func CreateCommandMessage(args []string) (string, error) {
+	message, err := BuildMessage(args)
+	if err != nil {
+		return "", err
 	}
+	data, err := wire.EncodeMessage(message)
 	if err != nil {
 		return "", err
 	}
-	// return the message
-	return message, nil
+	return string(data), nil
 }
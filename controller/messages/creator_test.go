@@ -0,0 +1,68 @@
+package messages
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the contract tests between the messages created
+by the controller and the wire schema.
+*/
+
+import (
+	"bytes"
+	"os"
+	"semester-project/wire"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestChangeFlowMatchesFixture(t *testing.T) {
+	message, err := CreateCommandMessage([]string{
+		"change-flow",
+		"destination-nodes", "127.0.0.1:8001", "127.0.0.1:8002",
+		"response-node", "127.0.0.1:8001",
+	})
+	if err != nil {
+		t.Fatal("Error creating message:", err)
+	}
+	fixture, err := os.ReadFile("../../wire/testdata/v2-set-config.json")
+	if err != nil {
+		t.Fatal("Error reading fixture:", err)
+	}
+	if !bytes.Equal([]byte(message), bytes.TrimSpace(fixture)) {
+		t.Errorf("Error creating message:\ngot  %s\nwant %s", message, fixture)
+	}
+}
+
+func TestChangeFlowDecodesAsCurrentVersion(t *testing.T) {
+	message, err := CreateCommandMessage([]string{
+		"change-flow", "destination-nodes", "127.0.0.1:8001", "response-node",
+	})
+	if err != nil {
+		t.Fatal("Error creating message:", err)
+	}
+	decoded, err := wire.DecodeMessage([]byte(message))
+	if err != nil {
+		t.Fatal("Error decoding message:", err)
+	}
+	if decoded.Version != wire.SchemaVersion || decoded.Type != wire.TypeSetConfig {
+		t.Errorf("Error decoding message: got version %d and type %q", decoded.Version, decoded.Type)
+	}
+}
+
+func TestKillMessage(t *testing.T) {
+	message, err := BuildMessage([]string{"kill", "42"})
+	if err != nil {
+		t.Fatal("Error building message:", err)
+	}
+	var payload wire.SessionPayload
+	err = message.DecodePayload(&payload)
+	if err != nil || message.Type != wire.TypeKillSession || payload.ID != 42 {
+		t.Errorf("Error building message: got type %q and payload %v (%v)", message.Type, payload, err)
+	}
+	if _, err := BuildMessage([]string{"kill", "first"}); err == nil {
+		t.Error("Error building message: expected an error for a non-numeric ID")
+	}
+}
@@ -0,0 +1,179 @@
+package messages
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to format the replies of the proxy.
+*/
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"semester-project/wire"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+//------------------------------------------------------------------------------
+// Private methods (Reply formatters)
+//------------------------------------------------------------------------------
+
+// listPresetsReplyFormatter formats the presets listed by the proxy.
+func listPresetsReplyFormatter(fs *flag.FlagSet, reply wire.Reply) (string, error) {
+	var presets map[string]wire.Config
+	err := reply.DecodePayload(&presets)
+	if err != nil {
+		return "", err
+	}
+	if len(presets) == 0 {
+		return "No preset\n", nil
+	}
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	str := ""
+	for _, name := range names {
+		config := presets[name]
+		str += name + ":\n" + config.String()
+	}
+	return str, nil
+}
+
+// sessionsReplyFormatter formats the client sessions listed by the proxy.
+func sessionsReplyFormatter(fs *flag.FlagSet, reply wire.Reply) (string, error) {
+	var sessions []wire.ClientSession
+	err := reply.DecodePayload(&sessions)
+	if err != nil {
+		return "", err
+	}
+	if len(sessions) == 0 {
+		return "No session\n", nil
+	}
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCLIENT\tNODES\tRESPONSE NODE\tCONFIG\tSTARTED\tTO NODES\tTO CLIENT")
+	for _, session := range sessions {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%d B\t%d B\n",
+			session.ID,
+			session.ClientAddr,
+			strings.Join(session.Nodes, ","),
+			session.ResponseNodeAddr,
+			session.ConfigVersion,
+			session.StartTime.Format("15:04:05"),
+			session.BytesToNodes,
+			session.BytesToClient,
+		)
+	}
+	w.Flush()
+	return b.String(), nil
+}
+
+// getConfigReplyFormatter formats the active config returned by the proxy, as
+// tables or as JSON with the -json flag.
+func getConfigReplyFormatter(fs *flag.FlagSet, reply wire.Reply) (string, error) {
+	var active wire.ActiveConfig
+	err := reply.DecodePayload(&active)
+	if err != nil {
+		return "", err
+	}
+	if fs.Lookup("json").Value.String() == "true" {
+		data, err := json.MarshalIndent(active, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Config version %d\n\n", active.ConfigVersion)
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tRESPONSE")
+	for _, node := range active.Config.Nodes {
+		response := ""
+		if node.Addr == active.Config.ResponseNodeAddr {
+			response = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", node.Addr, response)
+	}
+	w.Flush()
+	if len(active.Config.Triggers) > 0 {
+		b.WriteString("\n")
+		w = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TRIGGER\tCONDITION\tTARGET NODES\tTARGET RESPONSE")
+		for _, trigger := range active.Config.Triggers {
+			nodes := make([]string, len(trigger.Target.Nodes))
+			for i, node := range trigger.Target.Nodes {
+				nodes[i] = node.Addr
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", trigger.Name, trigger.Condition.String(), strings.Join(nodes, ","), trigger.Target.ResponseNodeAddr)
+		}
+		w.Flush()
+	}
+	if active.Config.Capture != nil {
+		fmt.Fprintf(&b, "\nCapture: %s\n", active.Config.Capture)
+	}
+	return b.String(), nil
+}
+
+// diffReplyFormatter formats the differences computed by the proxy.
+func diffReplyFormatter(fs *flag.FlagSet, reply wire.Reply) (string, error) {
+	var diff wire.ConfigDiff
+	err := reply.DecodePayload(&diff)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Changes from config version %d:\n%s", reply.ConfigVersion, diff.String()), nil
+}
+
+// auditReplyFormatter formats the audit entries returned by the proxy.
+func auditReplyFormatter(fs *flag.FlagSet, reply wire.Reply) (string, error) {
+	var entries []wire.AuditEntry
+	err := reply.DecodePayload(&entries)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "No config change\n", nil
+	}
+	var b strings.Builder
+	for _, entry := range entries {
+		by := entry.Source
+		if entry.Identity != "" {
+			by += " as " + entry.Identity
+		}
+		fmt.Fprintf(&b, "%s version %d -> %d by %s\n", entry.Time.Format("2006-01-02 15:04:05"), entry.PreviousVersion, entry.ConfigVersion, by)
+		for _, line := range strings.Split(strings.TrimSuffix(entry.Diff.String(), "\n"), "\n") {
+			b.WriteString("    " + line + "\n")
+		}
+	}
+	return b.String(), nil
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// FormatReply formats the reply of the proxy to the command, given with its
+// parsed arguments.
+func (c *Command) FormatReply(fs *flag.FlagSet, reply wire.Reply) (string, error) {
+	if len(reply.Payload) == 0 {
+		return fmt.Sprintf("OK (config version %d)\n", reply.ConfigVersion), nil
+	}
+	if c.format == nil {
+		return string(reply.Payload) + "\n", nil
+	}
+	return c.format(fs, reply)
+}
+
+// FormatReply formats the reply of the proxy to the command, given with its
+// arguments.
+func FormatReply(args []string, reply wire.Reply) (string, error) {
+	command, fs, err := ParseCommand(args)
+	if err != nil {
+		return "", err
+	}
+	return command.FormatReply(fs, reply)
+}
@@ -0,0 +1,47 @@
+package messages
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the formatting of the replies of
+the proxy.
+*/
+
+import (
+	"encoding/json"
+	"semester-project/wire"
+	"strings"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestFormatGetConfig(t *testing.T) {
+	active := wire.ActiveConfig{
+		ConfigVersion: 4,
+		Config: wire.Config{
+			Nodes:            []wire.Node{{Addr: "127.0.0.1:8001"}, {Addr: "127.0.0.1:8002"}},
+			ResponseNodeAddr: "127.0.0.1:8002",
+		},
+	}
+	reply := wire.NewReply(active.ConfigVersion, wire.ValidationReport{})
+	reply.SetPayload(active)
+	text, err := FormatReply([]string{"get-config"}, reply)
+	if err != nil {
+		t.Fatal("Error formatting config:", err)
+	}
+	if !strings.Contains(text, "Config version 4") || !strings.Contains(text, "127.0.0.1:8002  yes") {
+		t.Error("Error formatting config as a table:\n" + text)
+	}
+	text, err = FormatReply([]string{"get-config", "-json"}, reply)
+	if err != nil {
+		t.Fatal("Error formatting config:", err)
+	}
+	var decoded wire.ActiveConfig
+	err = json.Unmarshal([]byte(text), &decoded)
+	if err != nil || decoded.ConfigVersion != 4 || decoded.Config.ResponseNodeAddr != "127.0.0.1:8002" {
+		t.Error("Error formatting config as JSON:", err, "\n"+text)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to roll a config out to a fleet of
+proxies in two phases: the config is prepared on every proxy, then committed on
+all of them, or aborted if any proxy rejected it.
+*/
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"semester-project/controller/sender"
+	"semester-project/wire"
+	"strings"
+	"sync"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// rolloutResult is the result of a rollout message sent to a proxy.
+type rolloutResult struct {
+	reply wire.Reply
+	err   error
+}
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// readInventory reads the addresses of the proxies from the file, one per
+// line. Empty lines and lines starting with '#' are ignored.
+func readInventory(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var proxyAddrs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		proxyAddrs = append(proxyAddrs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(proxyAddrs) == 0 {
+		return nil, errors.New("no proxy in " + path)
+	}
+	return proxyAddrs, nil
+}
+
+// newRolloutID returns a random rollout ID.
+func newRolloutID() (string, error) {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// sendAll sends the message to every proxy whose session is set, at the same
+// time, and returns the results in the order of the sessions.
+func sendAll(sessions []*sender.Session, message wire.Message) []rolloutResult {
+	results := make([]rolloutResult, len(sessions))
+	var wg sync.WaitGroup
+	for i, session := range sessions {
+		if session == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, session *sender.Session) {
+			defer wg.Done()
+			reply, err := session.Request(message)
+			results[i] = rolloutResult{reply: reply, err: err}
+		}(i, session)
+	}
+	wg.Wait()
+	return results
+}
+
+// printResult prints the result of a rollout message sent to a proxy, and
+// returns true if the proxy accepted it.
+func printResult(proxyAddr string, result rolloutResult) bool {
+	if result.err != nil {
+		fmt.Println(proxyAddr+":", result.err)
+		return false
+	}
+	for _, fieldErr := range result.reply.Errors {
+		fmt.Println(proxyAddr+": error:", fieldErr)
+	}
+	for _, warning := range result.reply.Warnings {
+		fmt.Println(proxyAddr+": warning:", warning)
+	}
+	return result.reply.Succeeded()
+}
+
+// runRollout rolls the config out to the proxies of the inventory. The
+// sessions with all the proxies are opened first, so that the commit reaches
+// them at the same time.
+// It returns the exit code of the controller.
+func runRollout(credentials sender.Credentials, inventory string, config wire.Config) int {
+	proxyAddrs, err := readInventory(inventory)
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	rolloutID, err := newRolloutID()
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	// open the sessions
+	sessions := make([]*sender.Session, len(proxyAddrs))
+	for i, proxyAddr := range proxyAddrs {
+		session, err := sender.Dial(proxyAddr, credentials)
+		if err != nil {
+			fmt.Println(proxyAddr+":", err)
+			fmt.Println("Rollout", rolloutID, "not started")
+			return EXIT_ERROR
+		}
+		defer session.Close()
+		sessions[i] = session
+	}
+	// prepare the config on every proxy
+	prepare, err := wire.NewMessage(wire.TypePrepareConfig, wire.RolloutPayload{ID: rolloutID, Config: &config})
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	exitCode := 0
+	prepared := make([]*sender.Session, len(sessions))
+	for i, result := range sendAll(sessions, prepare) {
+		if !printResult(proxyAddrs[i], result) {
+			if result.err != nil {
+				exitCode = EXIT_ERROR
+			} else if exitCode == 0 {
+				exitCode = EXIT_REJECTED
+			}
+			continue
+		}
+		prepared[i] = sessions[i]
+	}
+	// abort the rollout if any proxy rejected it
+	if exitCode != 0 {
+		abort, err := wire.NewMessage(wire.TypeAbortConfig, wire.RolloutPayload{ID: rolloutID})
+		if err == nil {
+			for i, result := range sendAll(prepared, abort) {
+				if prepared[i] != nil {
+					printResult(proxyAddrs[i], result)
+				}
+			}
+		}
+		fmt.Println("Rollout", rolloutID, "aborted")
+		return exitCode
+	}
+	// commit the config on every proxy
+	commit, err := wire.NewMessage(wire.TypeCommitConfig, wire.RolloutPayload{ID: rolloutID})
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	committed := 0
+	for i, result := range sendAll(sessions, commit) {
+		if printResult(proxyAddrs[i], result) {
+			fmt.Printf("%s: OK (config version %d)\n", proxyAddrs[i], result.reply.ConfigVersion)
+			committed++
+		}
+	}
+	if committed != len(sessions) {
+		fmt.Printf("Rollout %s committed on %d of %d proxies\n", rolloutID, committed, len(sessions))
+		return EXIT_ERROR
+	}
+	fmt.Printf("Rollout %s committed on %d proxies\n", rolloutID, committed)
+	return 0
+}
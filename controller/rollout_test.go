@@ -0,0 +1,166 @@
+package main
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the rollout of a config to a
+fleet of proxies.
+*/
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"semester-project/controller/sender"
+	"semester-project/wire"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// fakeRolloutProxy is a proxy recording the rollout messages it receives.
+// It rejects the prepare or the commit messages if asked to.
+type fakeRolloutProxy struct {
+	addr          string
+	rejectPrepare bool
+	rejectCommit  bool
+	lock          sync.Mutex
+	received      []string
+}
+
+//------------------------------------------------------------------------------
+// Helpers
+//------------------------------------------------------------------------------
+
+// startRolloutProxies starts the fake proxies, and writes their
+// addresses to an inventory file. The prepare messages are only accepted
+// once every proxy received one, so that a rollout preparing the proxies one
+// after the other is rejected.
+func startRolloutProxies(t *testing.T, proxies []*fakeRolloutProxy) string {
+	t.Helper()
+	var preparing sync.WaitGroup
+	preparing.Add(len(proxies))
+	allPreparing := make(chan struct{})
+	go func() {
+		preparing.Wait()
+		close(allPreparing)
+	}()
+	var addrs []string
+	for _, proxy := range proxies {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal("Error listening:", err)
+		}
+		t.Cleanup(func() { listener.Close() })
+		proxy.addr = listener.Addr().String()
+		addrs = append(addrs, proxy.addr)
+		go func(proxy *fakeRolloutProxy) {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			for {
+				data, err := wire.ReadFrame(reader, wire.DEFAULT_MAX_FRAME_SIZE)
+				if err != nil {
+					return
+				}
+				message, _ := wire.DecodeMessage(data)
+				proxy.lock.Lock()
+				proxy.received = append(proxy.received, message.Type)
+				proxy.lock.Unlock()
+				reply := wire.NewReply(1, wire.ValidationReport{})
+				switch message.Type {
+				case wire.TypePrepareConfig:
+					preparing.Done()
+					select {
+					case <-allPreparing:
+					case <-time.After(time.Second):
+						reply = wire.NewRejection(wire.ValidationReport{Errors: []wire.FieldError{{Message: "prepared alone"}}})
+					}
+					if proxy.rejectPrepare {
+						reply = wire.NewRejection(wire.ValidationReport{Errors: []wire.FieldError{{Message: "invalid config"}}})
+					}
+				case wire.TypeCommitConfig:
+					if proxy.rejectCommit {
+						reply = wire.NewRejection(wire.ValidationReport{Errors: []wire.FieldError{{Message: "no prepared config"}}})
+					}
+				}
+				reply.ID = message.ID
+				data, _ = wire.EncodeReply(reply)
+				wire.WriteFrame(conn, data)
+			}
+		}(proxy)
+	}
+	inventory := filepath.Join(t.TempDir(), "inventory")
+	err := os.WriteFile(inventory, []byte(strings.Join(addrs, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal("Error writing inventory:", err)
+	}
+	return inventory
+}
+
+// receivedMessages returns the types of the messages received by the proxy.
+func (p *fakeRolloutProxy) receivedMessages() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]string(nil), p.received...)
+}
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestRollout(t *testing.T) {
+	config := wire.Config{
+		Nodes:            []wire.Node{{Addr: "127.0.0.1:8001"}},
+		ResponseNodeAddr: "127.0.0.1:8001",
+	}
+	prepareCommit := []string{wire.TypePrepareConfig, wire.TypeCommitConfig}
+	prepareAbort := []string{wire.TypePrepareConfig, wire.TypeAbortConfig}
+	prepareOnly := []string{wire.TypePrepareConfig}
+	tests := []struct {
+		name     string
+		proxies  []*fakeRolloutProxy
+		exitCode int
+		received [][]string
+	}{
+		{
+			name:     "all proxies accept",
+			proxies:  []*fakeRolloutProxy{{}, {}, {}},
+			exitCode: 0,
+			received: [][]string{prepareCommit, prepareCommit, prepareCommit},
+		},
+		{
+			name:     "one proxy rejects the prepare",
+			proxies:  []*fakeRolloutProxy{{}, {rejectPrepare: true}, {}},
+			exitCode: EXIT_REJECTED,
+			received: [][]string{prepareAbort, prepareOnly, prepareAbort},
+		},
+		{
+			name:     "one proxy fails the commit",
+			proxies:  []*fakeRolloutProxy{{}, {}, {rejectCommit: true}},
+			exitCode: EXIT_ERROR,
+			received: [][]string{prepareCommit, prepareCommit, prepareCommit},
+		},
+	}
+	for _, test := range tests {
+		inventory := startRolloutProxies(t, test.proxies)
+		if code := runRollout(sender.Credentials{}, inventory, config); code != test.exitCode {
+			t.Errorf("Error rolling out (%s): exit code %d, expected %d", test.name, code, test.exitCode)
+		}
+		for i, proxy := range test.proxies {
+			if received := proxy.receivedMessages(); !reflect.DeepEqual(received, test.received[i]) {
+				t.Errorf("Error rolling out (%s): proxy %d received %v, expected %v", test.name, i, received, test.received[i])
+			}
+		}
+	}
+}
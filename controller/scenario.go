@@ -0,0 +1,42 @@
+package main
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to run a scenario file and to report
+its result.
+*/
+
+import (
+	"fmt"
+	"os"
+	"semester-project/controller/scenario"
+	"semester-project/controller/sender"
+)
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// runScenario runs the scenario of the file and writes the report to the
+// report file, if any.
+// It returns the exit code of the controller.
+func runScenario(credentials sender.Credentials, path string, reportPath string) int {
+	s, err := scenario.Load(path)
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	report := scenario.Run(s, credentials, os.Stdout)
+	if reportPath != "" {
+		err = report.Write(reportPath)
+		if err != nil {
+			fmt.Println("Error writing report:", err)
+			return EXIT_ERROR
+		}
+	}
+	if !report.Passed {
+		return EXIT_FAILED
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+package scenario
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the pass/fail report of a scenario.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A StepResult is the result of a step of a scenario.
+type StepResult struct {
+	// Index is the position of the step in the scenario, starting at 1.
+	Index   int     `json:"index"`
+	Name    string  `json:"name,omitempty"`
+	Action  string  `json:"action"`
+	Status  string  `json:"status"`
+	Error   string  `json:"error,omitempty"`
+	Seconds float64 `json:"seconds"`
+}
+
+// A Report is the result of a run of a scenario.
+type Report struct {
+	Scenario string       `json:"scenario"`
+	Start    time.Time    `json:"start"`
+	Passed   bool         `json:"passed"`
+	Steps    []StepResult `json:"steps"`
+}
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// Statuses of a step.
+const (
+	STATUS_PASSED  = "passed"
+	STATUS_FAILED  = "failed"
+	STATUS_SKIPPED = "skipped"
+)
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// String returns the result of the step on a single line.
+func (s StepResult) String() string {
+	str := fmt.Sprintf("%-4s %2d %-8s %s", strings.ToUpper(s.Status[:4]), s.Index, s.Action, s.Name)
+	str = strings.TrimRight(str, " ")
+	if s.Status != STATUS_SKIPPED {
+		str += fmt.Sprintf(" (%.2fs)", s.Seconds)
+	}
+	if s.Error != "" {
+		str += ": " + s.Error
+	}
+	return str
+}
+
+// Summary returns the number of steps passed, failed and skipped on a single
+// line.
+func (r Report) Summary() string {
+	counts := make(map[string]int)
+	for _, step := range r.Steps {
+		counts[step.Status]++
+	}
+	result := "PASSED"
+	if !r.Passed {
+		result = "FAILED"
+	}
+	return fmt.Sprintf("Scenario %q %s (%d passed, %d failed, %d skipped)", r.Scenario, result, counts[STATUS_PASSED], counts[STATUS_FAILED], counts[STATUS_SKIPPED])
+}
+
+// String returns the results of the steps followed by the summary.
+func (r Report) String() string {
+	var b strings.Builder
+	for _, step := range r.Steps {
+		b.WriteString(step.String() + "\n")
+	}
+	b.WriteString(r.Summary() + "\n")
+	return b.String()
+}
+
+// Write writes the report to the file, as JSON if its name ends with .json
+// and as text otherwise.
+func (r Report) Write(path string) error {
+	data := []byte(r.String())
+	if strings.HasSuffix(path, ".json") {
+		var err error
+		data, err = json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,278 @@
+package scenario
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to run a scenario, step by step, and
+to report which steps passed.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"os/exec"
+	"semester-project/controller/sender"
+	"semester-project/wire"
+	"semester-project/wire/chains"
+	"strings"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// runner runs the steps of a scenario.
+type runner struct {
+	scenario    *Scenario
+	credentials sender.Credentials
+	// session is the session with the proxy, opened by the first apply step.
+	session *sender.Session
+	// vars are the variables saved by the steps.
+	vars map[string]string
+}
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// expand replaces the ${name} variables of the string by the values saved by
+// the steps, or else by the environment variables.
+func (r *runner) expand(s string) string {
+	return os.Expand(s, func(name string) string {
+		if value, ok := r.vars[name]; ok {
+			return value
+		}
+		return os.Getenv(name)
+	})
+}
+
+// parseAmount parses a decimal amount of the scenario.
+func (r *runner) parseAmount(amount string) (*big.Int, error) {
+	amount = r.expand(amount)
+	value, ok := new(big.Int).SetString(amount, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	return value, nil
+}
+
+// apply changes the config of the proxy.
+func (r *runner) apply(step *ApplyStep) error {
+	var message wire.Message
+	config, err := r.scenario.applyConfig(step, r.expand)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		message, err = wire.NewMessage(wire.TypeApplyPreset, wire.PresetPayload{Name: r.expand(step.Preset)})
+	} else {
+		message, err = wire.NewMessage(wire.TypeSetConfig, config)
+	}
+	if err != nil {
+		return err
+	}
+	if r.session == nil {
+		r.session, err = sender.Dial(r.scenario.Proxy, r.credentials)
+		if err != nil {
+			return err
+		}
+	}
+	reply, err := r.session.Request(message)
+	if err != nil {
+		return err
+	}
+	if !reply.Succeeded() {
+		errs := make([]string, len(reply.Errors))
+		for i, fieldErr := range reply.Errors {
+			errs[i] = fieldErr.String()
+		}
+		return errors.New("rejected by the proxy: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// check returns nil if the check passes, and the reason why otherwise.
+func (r *runner) check(c *Check) error {
+	chain := r.scenario.Chains[c.Chain]
+	switch {
+	case c.Balance != nil:
+		address := r.expand(c.Balance.Address)
+		actual, err := chains.Balance(chain.Kind, chain.Addr, chain.Token, address)
+		if err != nil {
+			return err
+		}
+		for _, bound := range []struct {
+			amount string
+			ok     func(cmp int) bool
+			what   string
+		}{
+			{c.Balance.Equals, func(cmp int) bool { return cmp == 0 }, "equal to"},
+			{c.Balance.AtLeast, func(cmp int) bool { return cmp >= 0 }, "at least"},
+			{c.Balance.AtMost, func(cmp int) bool { return cmp <= 0 }, "at most"},
+		} {
+			if bound.amount == "" {
+				continue
+			}
+			expected, err := r.parseAmount(bound.amount)
+			if err != nil {
+				return err
+			}
+			if !bound.ok(actual.Cmp(expected)) {
+				return fmt.Errorf("balance of %s on %s is %s, expected %s %s", address, c.Chain, actual, bound.what, expected)
+			}
+		}
+		return nil
+	case c.Tx != nil:
+		txID := r.expand(c.Tx.ID)
+		included, err := chains.TxIncluded(chain.Kind, chain.Addr, chain.Token, txID)
+		if err != nil {
+			return err
+		}
+		if included && c.Tx.State == TX_MISSING {
+			return fmt.Errorf("tx %s is included on %s", txID, c.Chain)
+		}
+		if !included && c.Tx.State == TX_INCLUDED {
+			return fmt.Errorf("tx %s is not included on %s", txID, c.Chain)
+		}
+		return nil
+	default:
+		height, err := chains.BlockHeight(chain.Kind, chain.Addr, chain.Token)
+		if err != nil {
+			return err
+		}
+		if height < c.BlockHeight {
+			return fmt.Errorf("block height of %s is %d, expected at least %d", c.Chain, height, c.BlockHeight)
+		}
+		return nil
+	}
+}
+
+// waitFor checks the condition until it passes or the timeout expires.
+func (r *runner) waitFor(step *WaitForStep) error {
+	timeout, interval := DEFAULT_WAIT_TIMEOUT, DEFAULT_WAIT_INTERVAL
+	if step.Timeout != "" {
+		timeout, _ = time.ParseDuration(step.Timeout)
+	}
+	if step.Interval != "" {
+		interval, _ = time.ParseDuration(step.Interval)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		err := r.check(&step.Check)
+		if err == nil {
+			return nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("timeout after %s: %w", timeout, err)
+		}
+		// the condition is checked once more at the deadline
+		if remaining < interval {
+			time.Sleep(remaining)
+		} else {
+			time.Sleep(interval)
+		}
+	}
+}
+
+// sendTx sends the transaction of the step.
+func (r *runner) sendTx(step *SendTxStep) error {
+	value, err := r.parseAmount(step.Value)
+	if err != nil {
+		return err
+	}
+	hash, err := chains.SendTx(r.scenario.Chains[step.Chain].Addr, r.expand(step.From), r.expand(step.To), value)
+	if err != nil {
+		return err
+	}
+	if step.SaveAs != "" {
+		r.vars[step.SaveAs] = hash
+	}
+	return nil
+}
+
+// run runs the command of the step with sh.
+func (r *runner) run(step *RunStep) error {
+	command := exec.Command("sh", "-c", r.expand(step.Command))
+	command.Dir = r.scenario.dir
+	output, err := command.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return err
+	}
+	if step.SaveAs != "" {
+		r.vars[step.SaveAs] = strings.TrimSpace(string(output))
+	}
+	return nil
+}
+
+// runStep runs the step.
+func (r *runner) runStep(step *Step) error {
+	switch {
+	case step.Apply != nil:
+		return r.apply(step.Apply)
+	case step.Wait != "":
+		duration, _ := time.ParseDuration(step.Wait)
+		time.Sleep(duration)
+		return nil
+	case step.WaitFor != nil:
+		return r.waitFor(step.WaitFor)
+	case step.SendTx != nil:
+		return r.sendTx(step.SendTx)
+	case step.Run != nil:
+		return r.run(step.Run)
+	default:
+		return r.check(step.Assert)
+	}
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// Run runs the steps of the scenario in order and prints their results to the
+// output as they complete.
+// A failed assert step does not stop the scenario, so that all the assertions
+// following an attack are reported. Any other failed step skips the remaining
+// steps.
+func Run(scenario *Scenario, credentials sender.Credentials, output io.Writer) Report {
+	r := &runner{
+		scenario:    scenario,
+		credentials: credentials,
+		vars:        make(map[string]string),
+	}
+	defer func() {
+		if r.session != nil {
+			r.session.Close()
+		}
+	}()
+	report := Report{Scenario: scenario.Name, Start: time.Now(), Passed: true}
+	stopped := false
+	for i := range scenario.Steps {
+		step := &scenario.Steps[i]
+		result := StepResult{Index: i + 1, Name: step.Name, Action: step.action(), Status: STATUS_SKIPPED}
+		if !stopped {
+			start := time.Now()
+			err := r.runStep(step)
+			result.Seconds = time.Since(start).Seconds()
+			result.Status = STATUS_PASSED
+			if err != nil {
+				result.Status = STATUS_FAILED
+				result.Error = err.Error()
+				report.Passed = false
+				stopped = step.Assert == nil
+			}
+		}
+		report.Steps = append(report.Steps, result)
+		fmt.Fprintln(output, result.String())
+	}
+	fmt.Fprintln(output, report.Summary())
+	return report
+}
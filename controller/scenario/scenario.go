@@ -0,0 +1,346 @@
+package scenario
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the scenario files, which describe an
+experiment as a list of steps run by the controller.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"semester-project/wire"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A Scenario is a list of steps run against a proxy and the chains behind it.
+type Scenario struct {
+	Name string `yaml:"name"`
+	// Proxy is the address of the configuration port of the proxy.
+	Proxy string `yaml:"proxy"`
+	// Chains are the endpoints the steps send transactions to and check,
+	// by name. The client port of the proxy is a chain like the others.
+	Chains map[string]Chain `yaml:"chains"`
+	Steps  []Step           `yaml:"steps"`
+	// dir is the directory of the scenario file, to which the paths of the
+	// config files are relative.
+	dir string
+}
+
+// A Chain is the endpoint of a node, or of the proxy in front of it.
+type Chain struct {
+	// Kind is wire.ChainQuorum or wire.ChainAlgorand.
+	Kind string `yaml:"kind"`
+	// Addr is the host:port of the HTTP API of the node.
+	Addr string `yaml:"addr"`
+	// Token is the API token of an Algorand node.
+	Token string `yaml:"token"`
+}
+
+// A Step is a single action of a scenario. Exactly one action is set.
+type Step struct {
+	Name    string       `yaml:"name"`
+	Apply   *ApplyStep   `yaml:"apply"`
+	Wait    string       `yaml:"wait"`
+	WaitFor *WaitForStep `yaml:"wait-for"`
+	SendTx  *SendTxStep  `yaml:"send-tx"`
+	Run     *RunStep     `yaml:"run"`
+	Assert  *Check       `yaml:"assert"`
+}
+
+// An ApplyStep changes the config of the proxy, either to the given flow, to a
+// preset or to the config of a JSON file.
+type ApplyStep struct {
+	Nodes        []string `yaml:"nodes"`
+	ResponseNode string   `yaml:"response-node"`
+	Preset       string   `yaml:"preset"`
+	File         string   `yaml:"file"`
+}
+
+// A WaitForStep waits until the check passes, or fails after the timeout.
+type WaitForStep struct {
+	Check    `yaml:",inline"`
+	Timeout  string `yaml:"timeout"`
+	Interval string `yaml:"interval"`
+}
+
+// A SendTxStep sends a transaction from an account unlocked on a Quorum node.
+// The hash of the transaction is saved in the variable SaveAs, if set.
+type SendTxStep struct {
+	Chain  string `yaml:"chain"`
+	From   string `yaml:"from"`
+	To     string `yaml:"to"`
+	Value  string `yaml:"value"`
+	SaveAs string `yaml:"save-as"`
+}
+
+// A RunStep runs a shell command, e.g. a script sending an Algorand
+// transaction. Its trimmed output is saved in the variable SaveAs, if set.
+type RunStep struct {
+	Command string `yaml:"command"`
+	SaveAs  string `yaml:"save-as"`
+}
+
+// A Check is a condition on a chain. Exactly one of Balance, Tx and
+// BlockHeight is set.
+type Check struct {
+	Chain       string        `yaml:"chain"`
+	Balance     *BalanceCheck `yaml:"balance"`
+	Tx          *TxCheck      `yaml:"tx"`
+	BlockHeight uint64        `yaml:"block-height"`
+}
+
+// A BalanceCheck compares the balance of an account, in wei or microalgos.
+type BalanceCheck struct {
+	Address string `yaml:"address"`
+	Equals  string `yaml:"equals"`
+	AtLeast string `yaml:"at-least"`
+	AtMost  string `yaml:"at-most"`
+}
+
+// A TxCheck checks whether a transaction is included.
+type TxCheck struct {
+	ID string `yaml:"id"`
+	// State is TX_INCLUDED or TX_MISSING.
+	State string `yaml:"state"`
+}
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// Transaction states.
+const (
+	TX_INCLUDED = "included"
+	TX_MISSING  = "missing"
+)
+
+// DEFAULT_WAIT_TIMEOUT is the timeout of the wait-for steps that set none.
+const DEFAULT_WAIT_TIMEOUT = time.Minute
+
+// DEFAULT_WAIT_INTERVAL is the interval between two checks of a wait-for step.
+const DEFAULT_WAIT_INTERVAL = time.Second
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// validate checks the check, whose chains must be defined by the scenario.
+func (c *Check) validate(chains map[string]Chain) error {
+	if _, ok := chains[c.Chain]; !ok {
+		return fmt.Errorf("unknown chain %q", c.Chain)
+	}
+	set := 0
+	if c.Balance != nil {
+		set++
+		if c.Balance.Address == "" {
+			return errors.New("balance: address not set")
+		}
+		if c.Balance.Equals == "" && c.Balance.AtLeast == "" && c.Balance.AtMost == "" {
+			return errors.New("balance: one of equals, at-least and at-most must be set")
+		}
+	}
+	if c.Tx != nil {
+		set++
+		if c.Tx.ID == "" {
+			return errors.New("tx: id not set")
+		}
+		if c.Tx.State != TX_INCLUDED && c.Tx.State != TX_MISSING {
+			return fmt.Errorf("tx: state must be %s or %s", TX_INCLUDED, TX_MISSING)
+		}
+	}
+	if c.BlockHeight != 0 {
+		set++
+	}
+	if set != 1 {
+		return errors.New("exactly one of balance, tx and block-height must be set")
+	}
+	return nil
+}
+
+// action returns the name of the action of the step.
+func (s *Step) action() string {
+	switch {
+	case s.Apply != nil:
+		return "apply"
+	case s.Wait != "":
+		return "wait"
+	case s.WaitFor != nil:
+		return "wait-for"
+	case s.SendTx != nil:
+		return "send-tx"
+	case s.Run != nil:
+		return "run"
+	case s.Assert != nil:
+		return "assert"
+	default:
+		return ""
+	}
+}
+
+// validate checks the step of the scenario.
+func (s *Step) validate(scenario *Scenario) error {
+	actions := 0
+	for _, set := range []bool{s.Apply != nil, s.Wait != "", s.WaitFor != nil, s.SendTx != nil, s.Run != nil, s.Assert != nil} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return errors.New("exactly one of apply, wait, wait-for, send-tx, run and assert must be set")
+	}
+	switch {
+	case s.Apply != nil:
+		if scenario.Proxy == "" {
+			return errors.New("apply: proxy not set")
+		}
+		set := 0
+		if len(s.Apply.Nodes) > 0 || s.Apply.ResponseNode != "" {
+			set++
+		}
+		if s.Apply.Preset != "" {
+			set++
+		}
+		if s.Apply.File != "" {
+			set++
+		}
+		if set != 1 {
+			return errors.New("apply: exactly one of nodes, preset and file must be set")
+		}
+	case s.Wait != "":
+		if _, err := time.ParseDuration(s.Wait); err != nil {
+			return fmt.Errorf("wait: %w", err)
+		}
+	case s.WaitFor != nil:
+		for _, duration := range []string{s.WaitFor.Timeout, s.WaitFor.Interval} {
+			if _, err := time.ParseDuration(duration); duration != "" && err != nil {
+				return fmt.Errorf("wait-for: %w", err)
+			}
+		}
+		return s.WaitFor.Check.validate(scenario.Chains)
+	case s.SendTx != nil:
+		chain, ok := scenario.Chains[s.SendTx.Chain]
+		if !ok {
+			return fmt.Errorf("send-tx: unknown chain %q", s.SendTx.Chain)
+		}
+		if chain.Kind != wire.ChainQuorum {
+			return errors.New("send-tx: only supported on quorum chains, use a run step otherwise")
+		}
+		if s.SendTx.From == "" || s.SendTx.To == "" || s.SendTx.Value == "" {
+			return errors.New("send-tx: from, to and value must be set")
+		}
+	case s.Run != nil:
+		if s.Run.Command == "" {
+			return errors.New("run: command not set")
+		}
+	case s.Assert != nil:
+		return s.Assert.validate(scenario.Chains)
+	}
+	return nil
+}
+
+// applyConfig returns the config applied by the step, with its variables
+// expanded, or nil if the step applies a preset.
+func (s *Scenario) applyConfig(step *ApplyStep, expand func(string) string) (*wire.Config, error) {
+	switch {
+	case step.Preset != "":
+		return nil, nil
+	case step.File != "":
+		path := expand(step.File)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var config wire.Config
+		err = json.Unmarshal(data, &config)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", path, err)
+		}
+		return &config, nil
+	default:
+		config := wire.Config{ResponseNodeAddr: expand(step.ResponseNode)}
+		for _, node := range step.Nodes {
+			config.Nodes = append(config.Nodes, wire.Node{Addr: expand(node)})
+		}
+		return &config, nil
+	}
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// Parse parses and checks a scenario.
+func Parse(data []byte) (*Scenario, error) {
+	var scenario Scenario
+	err := yaml.Unmarshal(data, &scenario)
+	if err != nil {
+		return nil, err
+	}
+	for name, chain := range scenario.Chains {
+		if chain.Kind != wire.ChainQuorum && chain.Kind != wire.ChainAlgorand {
+			return nil, fmt.Errorf("chains.%s: kind must be %s or %s", name, wire.ChainQuorum, wire.ChainAlgorand)
+		}
+		if chain.Addr == "" {
+			return nil, fmt.Errorf("chains.%s: addr not set", name)
+		}
+	}
+	if len(scenario.Steps) == 0 {
+		return nil, errors.New("no step")
+	}
+	for i := range scenario.Steps {
+		err := scenario.Steps[i].validate(&scenario)
+		if err != nil {
+			return nil, fmt.Errorf("steps[%d]: %w", i, err)
+		}
+	}
+	return &scenario, nil
+}
+
+// Load reads and checks the scenario file.
+func Load(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	scenario, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	scenario.dir = filepath.Dir(path)
+	return scenario, nil
+}
+
+// CheckConfigs validates the configs applied by the steps of the scenario, as
+// the proxy would, and returns the reports of the steps by index, starting at
+// 1. The presets are not checked, since they are stored on the proxy, and the
+// variables are replaced by the environment variables only.
+func (s *Scenario) CheckConfigs() (map[int]wire.ValidationReport, error) {
+	reports := make(map[int]wire.ValidationReport)
+	for i, step := range s.Steps {
+		if step.Apply == nil {
+			continue
+		}
+		config, err := s.applyConfig(step.Apply, os.ExpandEnv)
+		if err != nil {
+			return nil, fmt.Errorf("steps[%d]: %w", i, err)
+		}
+		if config != nil {
+			reports[i+1] = config.Validate()
+		}
+	}
+	return reports, nil
+}
@@ -0,0 +1,209 @@
+package scenario
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the scenarios.
+*/
+
+import (
+	"bufio"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"semester-project/controller/sender"
+	"semester-project/wire"
+	"semester-project/wire/chains/chainstest"
+	"strings"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Helpers
+//------------------------------------------------------------------------------
+
+// fakeProxy accepts the configs sent to it and sends them on the channel.
+func fakeProxy(t *testing.T, configs chan<- wire.Config) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening:", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for version := uint64(1); ; version++ {
+			data, err := wire.ReadFrame(reader, wire.DEFAULT_MAX_FRAME_SIZE)
+			if err != nil {
+				return
+			}
+			message, _ := wire.DecodeMessage(data)
+			var config wire.Config
+			message.DecodePayload(&config)
+			configs <- config
+			reply := wire.NewReply(version, wire.ValidationReport{})
+			reply.ID = message.ID
+			data, _ = wire.EncodeReply(reply)
+			wire.WriteFrame(conn, data)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestParseScenario(t *testing.T) {
+	header := "proxy: 127.0.0.1:9000\nchains:\n  honest: {kind: quorum, addr: 127.0.0.1:8545}\n  algo: {kind: algorand, addr: 127.0.0.1:8080}\nsteps:\n"
+	valid := []string{
+		"  - apply: {nodes: [a, b], response-node: a}\n",
+		"  - apply: {preset: mirror}\n",
+		"  - wait: 10s\n",
+		"  - wait-for: {chain: algo, block-height: 10, timeout: 1m}\n",
+		"  - send-tx: {chain: honest, from: '0x1', to: '0x2', value: '1000', save-as: tx}\n",
+		"  - run: {command: python3 send.py, save-as: tx}\n",
+		"  - assert: {chain: algo, tx: {id: '${tx}', state: missing}}\n",
+		"  - assert: {chain: honest, balance: {address: '0x2', at-least: '1000'}}\n",
+	}
+	for _, step := range valid {
+		if _, err := Parse([]byte(header + step)); err != nil {
+			t.Errorf("Error parsing %q: %v", step, err)
+		}
+	}
+	invalid := []string{
+		"",
+		"  - {}\n",
+		"  - {wait: 10s, run: {command: ls}}\n",
+		"  - wait: ten seconds\n",
+		"  - apply: {preset: mirror, file: config.json}\n",
+		"  - wait-for: {chain: twin, block-height: 10}\n",
+		"  - send-tx: {chain: algo, from: a, to: b, value: '1'}\n",
+		"  - assert: {chain: honest, block-height: 1, tx: {id: a, state: included}}\n",
+		"  - assert: {chain: honest, tx: {id: a, state: pending}}\n",
+		"  - assert: {chain: honest, balance: {address: '0x2'}}\n",
+	}
+	for _, step := range invalid {
+		if _, err := Parse([]byte(header + step)); err == nil {
+			t.Errorf("Error parsing %q: no error returned", step)
+		}
+	}
+	if _, err := Parse([]byte("steps:\n  - apply: {preset: mirror}\n")); err == nil {
+		t.Error("Error parsing an apply step without proxy: no error returned")
+	}
+}
+
+func TestRunScenario(t *testing.T) {
+	honest := chainstest.NewQuorum(t, map[string]*big.Int{"0xa": big.NewInt(5000)})
+	twin := chainstest.NewQuorum(t, map[string]*big.Int{"0xa": big.NewInt(5000)})
+	configs := make(chan wire.Config, 1)
+	proxyAddr := fakeProxy(t, configs)
+	data := `
+name: double spend
+proxy: ` + proxyAddr + `
+chains:
+  honest: {kind: quorum, addr: ` + honest + `}
+  twin: {kind: quorum, addr: ` + twin + `}
+steps:
+  - name: send to the twin only
+    apply: {nodes: [twin], response-node: twin}
+  - send-tx: {chain: twin, from: '0xa', to: '0xb', value: '1000', save-as: tx}
+  - run: {command: 'echo 0xa', save-as: payer}
+  - wait-for: {chain: honest, block-height: 3, interval: 1ms}
+  - assert: {chain: twin, tx: {id: '${tx}', state: included}}
+  - assert: {chain: honest, tx: {id: '${tx}', state: missing}}
+  - assert: {chain: honest, balance: {address: '${payer}', equals: '5000'}}
+  - name: failing assert
+    assert: {chain: twin, balance: {address: '0xb', at-most: '999'}}
+  - assert: {chain: twin, balance: {address: '0xb', at-least: '1000'}}
+  - run: {command: 'exit 1'}
+  - wait: 1h
+`
+	s, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatal("Error parsing scenario:", err)
+	}
+	report := Run(s, sender.Credentials{}, io.Discard)
+	config := <-configs
+	if len(config.Nodes) != 1 || config.Nodes[0].Addr != "twin" || config.ResponseNodeAddr != "twin" {
+		t.Error("Error applying config: got", config)
+	}
+	if report.Passed {
+		t.Error("Error running scenario: passed with failed steps")
+	}
+	expected := []string{
+		STATUS_PASSED, STATUS_PASSED, STATUS_PASSED, STATUS_PASSED, STATUS_PASSED, STATUS_PASSED, STATUS_PASSED,
+		STATUS_FAILED, STATUS_PASSED, STATUS_FAILED, STATUS_SKIPPED,
+	}
+	if len(report.Steps) != len(expected) {
+		t.Fatalf("Error running scenario: got %d results, expected %d", len(report.Steps), len(expected))
+	}
+	for i, status := range expected {
+		if report.Steps[i].Status != status {
+			t.Errorf("Error running step %d: got %s (%s), expected %s", i+1, report.Steps[i].Status, report.Steps[i].Error, status)
+		}
+	}
+	if !strings.Contains(report.Summary(), "(8 passed, 2 failed, 1 skipped)") {
+		t.Error("Error summarizing report:", report.Summary())
+	}
+}
+
+func TestWaitForChecksAtDeadline(t *testing.T) {
+	node := chainstest.NewQuorum(t, nil)
+	r := &runner{scenario: &Scenario{Chains: map[string]Chain{
+		"node": {Kind: wire.ChainQuorum, Addr: node},
+	}}}
+	// the height is 1, then 2 after the interval, then 3 at the deadline
+	step := &WaitForStep{
+		Check:    Check{Chain: "node", BlockHeight: 3},
+		Timeout:  "300ms",
+		Interval: "200ms",
+	}
+	err := r.waitFor(step)
+	if err != nil {
+		t.Error("Error waiting for the condition met at the deadline:", err)
+	}
+}
+
+func TestCheckConfigs(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"nodes": [{"addr": "127.0.0.1:8001"}], "responseNodeAddr": "127.0.0.1:8002"}`), 0644)
+	if err != nil {
+		t.Fatal("Error writing config:", err)
+	}
+	path := filepath.Join(dir, "scenario.yaml")
+	err = os.WriteFile(path, []byte(`
+proxy: 127.0.0.1:9000
+steps:
+  - apply: {nodes: ['127.0.0.1:8001', '${TWIN}'], response-node: '${TWIN}'}
+  - apply: {preset: twin-only}
+  - apply: {file: config.json}
+`), 0644)
+	if err != nil {
+		t.Fatal("Error writing scenario:", err)
+	}
+	t.Setenv("TWIN", "127.0.0.1:8002")
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal("Error loading scenario:", err)
+	}
+	reports, err := s.CheckConfigs()
+	if err != nil {
+		t.Fatal("Error checking configs:", err)
+	}
+	if len(reports) != 2 {
+		t.Fatal("Error checking configs: got reports of steps", reports)
+	}
+	if report := reports[1]; !report.OK() {
+		t.Error("Error checking valid config:", report.Errors)
+	}
+	if report := reports[3]; report.OK() {
+		t.Error("Error checking invalid config: no error returned")
+	}
+}
@@ -6,24 +6,32 @@ Project: EPFL Master Semester Project
 Description: This file contains the code to send messages to the proxy.
 */
 
-import "net"
+import (
+	"semester-project/wire"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// Credentials are used to sign the messages sent to a proxy that requires
+// authentication. Messages are not signed if the identity is empty.
+type Credentials struct {
+	Identity string
+	Key      []byte
+}
 
 //------------------------------------------------------------------------------
 // Public methods
 //------------------------------------------------------------------------------
 
-// Send sends a message to the proxy.
-func Send(proxyAddr string, message string) error {
-	// connect to the proxy
-	conn, err := net.Dial("tcp", proxyAddr)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-	// send the message
-	_, err = conn.Write([]byte(message))
+// Send sends a single message to the proxy and returns its reply.
+// Use a Session to send several messages on the same connection.
+func Send(proxyAddr string, credentials Credentials, message wire.Message) (wire.Reply, error) {
+	session, err := Dial(proxyAddr, credentials)
 	if err != nil {
-		return err
+		return wire.Reply{}, err
 	}
-	return nil
+	defer session.Close()
+	return session.Request(message)
 }
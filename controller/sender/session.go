@@ -0,0 +1,200 @@
+package sender
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to keep a long-lived session with the
+proxy, on which any number of messages can be sent.
+*/
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"semester-project/wire"
+	"strconv"
+	"sync"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A Session is a connection to the proxy carrying any number of messages.
+// Each message is given an ID, which is used to match its reply. The proxy
+// handles the messages of a session one at a time, in the order they are
+// received, so replies only arrive out of order between the events of watch
+// subscriptions. Use several sessions to have messages handled concurrently.
+// A Session is thread-safe.
+type Session struct {
+	conn        net.Conn
+	credentials Credentials
+	writeLock   sync.Mutex
+	lock        sync.Mutex
+	nextID      uint64
+	pending     map[string]chan wire.Reply
+	// streams are the requests receiving any number of replies
+	streams map[string]chan wire.Reply
+	// err is the reason the session ended, once it did
+	err  error
+	done chan struct{}
+}
+
+//------------------------------------------------------------------------------
+// Errors
+//------------------------------------------------------------------------------
+
+// ErrNoReply is returned when the proxy closes the session before replying.
+var ErrNoReply = errors.New("the proxy closed the connection without replying")
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// readReplies reads the replies of the proxy and passes them to the pending
+// requests until the session ends.
+func (s *Session) readReplies() {
+	reader := bufio.NewReader(s.conn)
+	var err error
+	for {
+		var data []byte
+		data, err = wire.ReadFrame(reader, wire.DEFAULT_MAX_FRAME_SIZE)
+		if err != nil {
+			break
+		}
+		var reply wire.Reply
+		reply, err = wire.DecodeReply(data)
+		if err != nil {
+			break
+		}
+		s.lock.Lock()
+		replyChannel, ok := s.pending[reply.ID]
+		delete(s.pending, reply.ID)
+		if !ok {
+			replyChannel, ok = s.streams[reply.ID]
+		}
+		s.lock.Unlock()
+		if ok {
+			replyChannel <- reply
+		}
+	}
+	s.lock.Lock()
+	s.err = err
+	for id, streamChannel := range s.streams {
+		close(streamChannel)
+		delete(s.streams, id)
+	}
+	s.lock.Unlock()
+	close(s.done)
+}
+
+// send registers the reply channel under the next ID, then signs and sends
+// the message with that ID.
+func (s *Session) send(message wire.Message, replyChannel chan wire.Reply, stream bool) error {
+	// register the message
+	s.lock.Lock()
+	if stream && s.err != nil {
+		// the session ended, the stream would never be closed
+		s.lock.Unlock()
+		return ErrNoReply
+	}
+	s.nextID++
+	message.ID = strconv.FormatUint(s.nextID, 10)
+	if stream {
+		s.streams[message.ID] = replyChannel
+	} else {
+		s.pending[message.ID] = replyChannel
+	}
+	s.lock.Unlock()
+	// send the message
+	var err error
+	if s.credentials.Identity != "" {
+		err = message.Sign(s.credentials.Identity, s.credentials.Key)
+	}
+	var data []byte
+	if err == nil {
+		data, err = wire.EncodeMessage(message)
+	}
+	if err == nil {
+		s.writeLock.Lock()
+		err = wire.WriteFrame(s.conn, data)
+		s.writeLock.Unlock()
+	}
+	if err != nil {
+		s.lock.Lock()
+		delete(s.pending, message.ID)
+		delete(s.streams, message.ID)
+		s.lock.Unlock()
+		return err
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// Dial opens a session with the proxy. The messages are signed with the
+// credentials, if any.
+func Dial(proxyAddr string, credentials Credentials) (*Session, error) {
+	conn, err := net.Dial("tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	session := &Session{
+		conn:        conn,
+		credentials: credentials,
+		pending:     make(map[string]chan wire.Reply),
+		streams:     make(map[string]chan wire.Reply),
+		done:        make(chan struct{}),
+	}
+	go session.readReplies()
+	return session, nil
+}
+
+// Request sends the message and waits for its reply.
+// The ID of the message is set by the session, which then signs it.
+func (s *Session) Request(message wire.Message) (wire.Reply, error) {
+	replyChannel := make(chan wire.Reply, 1)
+	err := s.send(message, replyChannel, false)
+	if err != nil {
+		return wire.Reply{}, err
+	}
+	// wait for the reply
+	select {
+	case reply := <-replyChannel:
+		return reply, nil
+	case <-s.done:
+		// the reply may have been received just before the session ended
+		select {
+		case reply := <-replyChannel:
+			return reply, nil
+		default:
+		}
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if s.err != nil && !errors.Is(s.err, io.EOF) && !errors.Is(s.err, net.ErrClosed) {
+			return wire.Reply{}, s.err
+		}
+		return wire.Reply{}, ErrNoReply
+	}
+}
+
+// Subscribe sends the message and returns a channel receiving all its
+// replies, starting with the acknowledgement of the proxy. The channel is
+// closed when the session ends. Replies to the other messages are delayed
+// while the channel is full, so it must be drained.
+func (s *Session) Subscribe(message wire.Message) (<-chan wire.Reply, error) {
+	streamChannel := make(chan wire.Reply, 64)
+	err := s.send(message, streamChannel, true)
+	if err != nil {
+		return nil, err
+	}
+	return streamChannel, nil
+}
+
+// Close ends the session.
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,171 @@
+package sender
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the sessions with the proxy.
+*/
+
+import (
+	"bufio"
+	"net"
+	"semester-project/wire"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestSessionMatchesInterleavedReplies(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening:", err)
+	}
+	defer listener.Close()
+	const count = 2
+	// fake proxy replying to the messages in reverse order, with the ID of
+	// the message as config version
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var ids []string
+		for len(ids) < count {
+			data, err := wire.ReadFrame(reader, wire.DEFAULT_MAX_FRAME_SIZE)
+			if err != nil {
+				return
+			}
+			message, _ := wire.DecodeMessage(data)
+			ids = append(ids, message.ID)
+		}
+		for i := len(ids) - 1; i >= 0; i-- {
+			version, _ := strconv.ParseUint(ids[i], 10, 64)
+			reply := wire.NewReply(version, wire.ValidationReport{})
+			reply.ID = ids[i]
+			data, _ := wire.EncodeReply(reply)
+			wire.WriteFrame(conn, data)
+		}
+	}()
+	session, err := Dial(listener.Addr().String(), Credentials{})
+	if err != nil {
+		t.Fatal("Error dialing:", err)
+	}
+	defer session.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			message, _ := wire.NewMessage(wire.TypeListPresets, nil)
+			reply, err := session.Request(message)
+			if err != nil {
+				t.Error("Error requesting:", err)
+				return
+			}
+			if strconv.FormatUint(reply.ConfigVersion, 10) != reply.ID {
+				t.Errorf("Error matching reply %s with its message", reply.ID)
+			}
+		}()
+	}
+	wg.Wait()
+	// the proxy closed the connection, the session has ended
+	message, _ := wire.NewMessage(wire.TypeListPresets, nil)
+	if _, err := session.Request(message); err == nil {
+		t.Error("Error requesting on a closed session: no error returned")
+	}
+}
+
+func TestSessionSubscribe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening:", err)
+	}
+	defer listener.Close()
+	const count = 3
+	// fake proxy acknowledging the watch message, then sending events
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, err := wire.ReadFrame(bufio.NewReader(conn), wire.DEFAULT_MAX_FRAME_SIZE)
+		if err != nil {
+			return
+		}
+		message, _ := wire.DecodeMessage(data)
+		for i := 0; i <= count; i++ {
+			reply := wire.NewReply(uint64(i), wire.ValidationReport{})
+			reply.ID = message.ID
+			data, _ := wire.EncodeReply(reply)
+			wire.WriteFrame(conn, data)
+		}
+	}()
+	session, err := Dial(listener.Addr().String(), Credentials{})
+	if err != nil {
+		t.Fatal("Error dialing:", err)
+	}
+	defer session.Close()
+	message, _ := wire.NewMessage(wire.TypeWatch, nil)
+	replies, err := session.Subscribe(message)
+	if err != nil {
+		t.Fatal("Error subscribing:", err)
+	}
+	// all the replies are received, then the channel is closed with the
+	// session
+	received := 0
+	for reply := range replies {
+		if reply.ConfigVersion != uint64(received) {
+			t.Error("Error receiving replies: got version", reply.ConfigVersion, "want", received)
+		}
+		received++
+	}
+	if received != count+1 {
+		t.Error("Error receiving replies: got", received, "want", count+1)
+	}
+}
+
+func TestSessionReplyBeforeClose(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening:", err)
+	}
+	defer listener.Close()
+	const count = 50
+	// fake proxy replying to the message and closing the connection at once
+	go func() {
+		for i := 0; i < count; i++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			data, err := wire.ReadFrame(bufio.NewReader(conn), wire.DEFAULT_MAX_FRAME_SIZE)
+			if err == nil {
+				message, _ := wire.DecodeMessage(data)
+				reply := wire.NewReply(1, wire.ValidationReport{})
+				reply.ID = message.ID
+				data, _ = wire.EncodeReply(reply)
+				wire.WriteFrame(conn, data)
+			}
+			conn.Close()
+		}
+	}()
+	for i := 0; i < count; i++ {
+		session, err := Dial(listener.Addr().String(), Credentials{})
+		if err != nil {
+			t.Fatal("Error dialing:", err)
+		}
+		message, _ := wire.NewMessage(wire.TypeListPresets, nil)
+		reply, err := session.Request(message)
+		session.Close()
+		if err != nil || reply.ConfigVersion != 1 {
+			t.Fatal("Error requesting: reply lost when the connection closed:", err)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the interactive shell of the controller, which
+sends the commands typed by the user on a single session with the proxy.
+*/
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"semester-project/controller/messages"
+	"semester-project/controller/sender"
+	"semester-project/wire"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// shell is an interactive session with the proxy.
+type shell struct {
+	proxyAddr string
+	session   *sender.Session
+	// configVersion is the version of the config of the proxy, as of its last
+	// reply.
+	configVersion uint64
+	// words are the node addresses and preset names known to the shell,
+	// completed after the command.
+	words map[string]bool
+}
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// printShellHelp prints the commands of the shell.
+func printShellHelp() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Commands:")
+	for _, command := range messages.Commands {
+		if command.Name == "watch" {
+			continue
+		}
+		usage := command.Name
+		command.FlagSet().VisitAll(func(f *flag.Flag) {
+			if !strings.Contains(command.Args, "-"+f.Name) {
+				usage += " [-" + f.Name + "]"
+			}
+		})
+		fmt.Fprintf(w, "  %s %s\t%s\n", usage, command.Args, command.Summary)
+	}
+	fmt.Fprintln(w, "  help\tprint the commands")
+	fmt.Fprintln(w, "  exit\tclose the session")
+	w.Flush()
+}
+
+// prompt returns the prompt showing the proxy and its config version.
+func (s *shell) prompt() string {
+	return fmt.Sprintf("%s (v%d)> ", s.proxyAddr, s.configVersion)
+}
+
+// learn adds the node addresses of the config to the completed words.
+func (s *shell) learn(config wire.Config) {
+	for _, node := range config.Nodes {
+		s.words[node.Addr] = true
+	}
+	if config.ResponseNodeAddr != "" {
+		s.words[config.ResponseNodeAddr] = true
+	}
+	for _, trigger := range config.Triggers {
+		s.learn(wire.Config{Nodes: trigger.Target.Nodes, ResponseNodeAddr: trigger.Target.ResponseNodeAddr})
+	}
+}
+
+// request sends the message and keeps the config version of the reply, if it
+// succeeded. Rejections do not carry the config version.
+func (s *shell) request(message wire.Message) (wire.Reply, error) {
+	reply, err := s.session.Request(message)
+	if err != nil {
+		return wire.Reply{}, err
+	}
+	if reply.Succeeded() {
+		s.configVersion = reply.ConfigVersion
+	}
+	return reply, nil
+}
+
+// refresh reads the active config and the presets of the proxy, to complete
+// their node addresses and names.
+func (s *shell) refresh() error {
+	message, _ := wire.NewMessage(wire.TypeGetConfig, nil)
+	reply, err := s.request(message)
+	if err != nil {
+		return err
+	}
+	var active wire.ActiveConfig
+	if reply.DecodePayload(&active) == nil {
+		s.learn(active.Config)
+	}
+	message, _ = wire.NewMessage(wire.TypeListPresets, nil)
+	reply, err = s.request(message)
+	if err != nil {
+		return err
+	}
+	var presets map[string]wire.Config
+	if reply.DecodePayload(&presets) == nil {
+		for name, config := range presets {
+			s.words[name] = true
+			s.learn(config)
+		}
+	}
+	return nil
+}
+
+// execute runs the command of the line and prints the reply of the proxy.
+// It returns false if the shell must exit.
+func (s *shell) execute(line string) bool {
+	args := strings.Fields(line)
+	if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+		return true
+	}
+	switch args[0] {
+	case "exit", "quit":
+		return false
+	case "help":
+		printShellHelp()
+		return true
+	case "watch", "batch":
+		fmt.Println(args[0], "is not supported in the shell")
+		return true
+	}
+	command, fs, err := messages.ParseCommand(args)
+	if err != nil {
+		fmt.Println(err)
+		return true
+	}
+	message, err := command.BuildMessage(fs)
+	if err != nil {
+		fmt.Println(err)
+		return true
+	}
+	reply, err := s.request(message)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	if printReply(command, fs, reply) != 0 {
+		return true
+	}
+	// complete the nodes and presets changed by the command
+	switch args[0] {
+	case "delete-preset":
+		delete(s.words, args[1])
+	case "change-flow", "set-config", "save-preset", "apply-preset":
+		err = s.refresh()
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+	}
+	return true
+}
+
+// complete completes the word before the cursor: the command if it is the
+// first word, or else a flow keyword, a node address or a preset name.
+// If several words match, the common prefix is completed and the matches are
+// returned.
+func complete(line string, pos int, commands []string, words []string) (string, int, []string) {
+	start := strings.LastIndex(line[:pos], " ") + 1
+	prefix := line[start:pos]
+	candidates := words
+	if strings.TrimSpace(line[:start]) == "" {
+		candidates = commands
+	}
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		return line, pos, nil
+	}
+	sort.Strings(matches)
+	completion := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match, completion) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	if len(matches) == 1 {
+		completion += " "
+	}
+	newLine := line[:start] + completion + line[pos:]
+	if len(matches) == 1 {
+		return newLine, start + len(completion), nil
+	}
+	return newLine, start + len(completion), matches
+}
+
+// completer returns the tab completion callback of the terminal.
+func (s *shell) completer(terminal *term.Terminal) func(line string, pos int, key rune) (string, int, bool) {
+	return func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		commands := []string{"help", "exit"}
+		for _, command := range messages.Commands {
+			if command.Name != "watch" {
+				commands = append(commands, command.Name)
+			}
+		}
+		words := []string{"destination-nodes", "response-node"}
+		for word := range s.words {
+			words = append(words, word)
+		}
+		newLine, newPos, matches := complete(line, pos, commands, words)
+		if len(matches) > 0 {
+			fmt.Fprintln(terminal, strings.Join(matches, "  "))
+		}
+		return newLine, newPos, true
+	}
+}
+
+// readTerminal reads the commands from the terminal, with line editing,
+// history and completion, until the user exits.
+func (s *shell) readTerminal() error {
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, s.prompt())
+	terminal.AutoCompleteCallback = s.completer(terminal)
+	for {
+		// the terminal is raw only while the line is read, so that the
+		// replies are printed as usual
+		state, err := term.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			return err
+		}
+		terminal.SetPrompt(s.prompt())
+		line, err := terminal.ReadLine()
+		term.Restore(int(os.Stdin.Fd()), state)
+		if err == io.EOF {
+			fmt.Println()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !s.execute(line) {
+			return nil
+		}
+	}
+}
+
+// readLines reads the commands from the input, one per line, without prompt.
+func (s *shell) readLines(input io.Reader) error {
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		if !s.execute(scanner.Text()) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// runShell runs the interactive shell on a session with the proxy.
+// It returns the exit code of the controller.
+func runShell(credentials sender.Credentials, proxyAddr string) int {
+	session, err := sender.Dial(proxyAddr, credentials)
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	defer session.Close()
+	s := &shell{proxyAddr: proxyAddr, session: session, words: make(map[string]bool)}
+	err = s.refresh()
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println("Connected to", proxyAddr+", type help for the commands")
+		err = s.readTerminal()
+	} else {
+		err = s.readLines(os.Stdin)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	return 0
+}
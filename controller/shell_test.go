@@ -0,0 +1,89 @@
+package main
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the shell.
+*/
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"semester-project/controller/sender"
+	"semester-project/wire"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestComplete(t *testing.T) {
+	commands := []string{"change-flow", "apply-preset", "audit"}
+	words := []string{"destination-nodes", "response-node", "127.0.0.1:8001", "127.0.0.1:8002"}
+	tests := []struct {
+		line    string
+		newLine string
+		matches []string
+	}{
+		{"ch", "change-flow ", nil},
+		{"a", "a", []string{"apply-preset", "audit"}},
+		{"change-flow d", "change-flow destination-nodes ", nil},
+		{"change-flow destination-nodes 127", "change-flow destination-nodes 127.0.0.1:800", []string{"127.0.0.1:8001", "127.0.0.1:8002"}},
+		{"change-flow x", "change-flow x", nil},
+		{"destination-", "destination-", nil},
+	}
+	for _, test := range tests {
+		newLine, newPos, matches := complete(test.line, len(test.line), commands, words)
+		if newLine != test.newLine || newPos != len(test.newLine) || !reflect.DeepEqual(matches, test.matches) {
+			t.Errorf("Error completing %q: got %q at %d with %v, expected %q with %v", test.line, newLine, newPos, matches, test.newLine, test.matches)
+		}
+	}
+}
+
+func TestShellKeepsVersionOnRejection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening:", err)
+	}
+	defer listener.Close()
+	// fake proxy accepting the first message and rejecting the second one
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		replies := []wire.Reply{
+			wire.NewReply(4, wire.ValidationReport{}),
+			wire.NewRejection(wire.ValidationReport{Errors: []wire.FieldError{{Message: "unknown preset"}}}),
+		}
+		for _, reply := range replies {
+			data, err := wire.ReadFrame(reader, wire.DEFAULT_MAX_FRAME_SIZE)
+			if err != nil {
+				return
+			}
+			message, _ := wire.DecodeMessage(data)
+			reply.ID = message.ID
+			data, _ = wire.EncodeReply(reply)
+			wire.WriteFrame(conn, data)
+		}
+	}()
+	session, err := sender.Dial(listener.Addr().String(), sender.Credentials{})
+	if err != nil {
+		t.Fatal("Error dialing:", err)
+	}
+	defer session.Close()
+	s := &shell{proxyAddr: listener.Addr().String(), session: session, words: make(map[string]bool)}
+	for _, expected := range []uint64{4, 4} {
+		message, _ := wire.NewMessage(wire.TypeListPresets, nil)
+		if _, err := s.request(message); err != nil {
+			t.Fatal("Error requesting:", err)
+		}
+		if s.configVersion != expected {
+			t.Errorf("Error keeping the config version: got %d, expected %d", s.configVersion, expected)
+		}
+	}
+}
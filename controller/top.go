@@ -0,0 +1,452 @@
+package main
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the dashboard of the controller, a full-screen
+view of the proxy refreshed live.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"semester-project/controller/sender"
+	"semester-project/wire"
+	"semester-project/wire/chains"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// nodeTraffic counts the bytes forwarded to and from a node.
+type nodeTraffic struct {
+	toNode   uint64
+	toClient uint64
+}
+
+// dashboard is the state of the proxy shown by top.
+type dashboard struct {
+	lock      sync.Mutex
+	proxyAddr string
+	// chain and token are used to poll the height of the nodes whose chain is
+	// not given by a trigger.
+	chain string
+	token string
+	// the state polled on the control channel
+	active      wire.ActiveConfig
+	sessions    []wire.ClientSession
+	changes     []string
+	auditFailed bool
+	pollErr     error
+	// traffic is the traffic of the nodes since the first poll, counted from
+	// the bytes forwarded by the sessions between two polls.
+	traffic map[string]nodeTraffic
+	// polledSessions are the sessions of the previous poll, by ID, or nil
+	// before the first poll.
+	polledSessions map[uint64]wire.ClientSession
+	// previous and previousTime are the traffic at the previous frame, to
+	// compute the throughput.
+	previous     map[string]nodeTraffic
+	previousTime time.Time
+	// the state built from the event stream
+	streaming bool
+	events    []string
+	// heights are the heights of the chains of the nodes, or the errors
+	// getting them.
+	heights map[string]string
+	// pollingHeights is true while the heights are polled.
+	pollingHeights atomic.Bool
+}
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// TOP_CHANGES is the number of recent config changes shown by top.
+const TOP_CHANGES = 5
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// formatBytes formats a number of bytes with a binary unit.
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	unit := 0
+	for n >= 1024 && unit < len(units)-1 {
+		n /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[unit])
+}
+
+// newDashboard returns an empty dashboard of the proxy.
+func newDashboard(proxyAddr string, chain string, token string) *dashboard {
+	return &dashboard{
+		proxyAddr: proxyAddr,
+		chain:     chain,
+		token:     token,
+		traffic:   make(map[string]nodeTraffic),
+		previous:  make(map[string]nodeTraffic),
+		heights:   make(map[string]string),
+	}
+}
+
+// record updates the dashboard with an event of the proxy.
+func (d *dashboard) record(event wire.Event) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	switch event.Kind {
+	case wire.EventConfigApplied, wire.EventConfigRejected:
+		// the config changes are only known from the events if the audit log
+		// is not enabled
+		d.events = append(d.events, event.String())
+		if len(d.events) > TOP_CHANGES {
+			d.events = d.events[len(d.events)-TOP_CHANGES:]
+		}
+	}
+}
+
+// countTraffic adds the bytes forwarded by the sessions since the previous
+// poll to the traffic of their nodes. The bytes sent by a client are sent to
+// every node of its session. The bytes of the sessions closed since the
+// previous poll, after it, are not counted.
+// It must be called with the lock held.
+func (d *dashboard) countTraffic(sessions []wire.ClientSession) {
+	first := d.polledSessions == nil
+	polledSessions := make(map[uint64]wire.ClientSession, len(sessions))
+	for _, session := range sessions {
+		polledSessions[session.ID] = session
+		if first {
+			continue
+		}
+		// the counters of a new session started after the previous poll
+		previous := d.polledSessions[session.ID]
+		for _, nodeAddr := range session.Nodes {
+			traffic := d.traffic[nodeAddr]
+			traffic.toNode += session.BytesToNodes - previous.BytesToNodes
+			if nodeAddr == session.ResponseNodeAddr {
+				traffic.toClient += session.BytesToClient - previous.BytesToClient
+			}
+			d.traffic[nodeAddr] = traffic
+		}
+	}
+	d.polledSessions = polledSessions
+}
+
+// poll reads the active config, the sessions and the recent config changes
+// of the proxy on the session.
+func (d *dashboard) poll(session *sender.Session) error {
+	request := func(messageType string, payload interface{}, result interface{}) error {
+		message, err := wire.NewMessage(messageType, payload)
+		if err != nil {
+			return err
+		}
+		reply, err := session.Request(message)
+		if err != nil {
+			return err
+		}
+		if !reply.Succeeded() {
+			return errors.New("rejected by the proxy")
+		}
+		return reply.DecodePayload(result)
+	}
+	var active wire.ActiveConfig
+	err := request(wire.TypeGetConfig, nil, &active)
+	if err != nil {
+		return err
+	}
+	var sessions []wire.ClientSession
+	err = request(wire.TypeListSessions, nil, &sessions)
+	if err != nil {
+		return err
+	}
+	var entries []wire.AuditEntry
+	auditErr := request(wire.TypeAudit, wire.AuditQuery{Limit: TOP_CHANGES}, &entries)
+	changes := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		by := entry.Source
+		if entry.Identity != "" {
+			by += " as " + entry.Identity
+		}
+		diff := strings.ReplaceAll(strings.TrimSuffix(entry.Diff.String(), "\n"), "\n", ", ")
+		changes = append(changes, fmt.Sprintf("%s version %d -> %d by %s: %s", entry.Time.Format("15:04:05"), entry.PreviousVersion, entry.ConfigVersion, by, diff))
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.active = active
+	d.sessions = sessions
+	d.changes = changes
+	d.auditFailed = auditErr != nil
+	d.countTraffic(sessions)
+	return nil
+}
+
+// nodeChains returns the chain and the token of each node of the active
+// config whose chain is known, from the conditions of the triggers or else
+// from the chain given to top.
+func (d *dashboard) nodeChains() map[string][2]string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	nodeChains := make(map[string][2]string)
+	if d.chain != "" {
+		for _, node := range d.active.Config.Nodes {
+			nodeChains[node.Addr] = [2]string{d.chain, d.token}
+		}
+	}
+	for _, trigger := range d.active.Config.Triggers {
+		condition := trigger.Condition
+		if condition.Chain != "" && condition.NodeAddr != "" {
+			nodeChains[condition.NodeAddr] = [2]string{condition.Chain, condition.Token}
+		}
+	}
+	return nodeChains
+}
+
+// pollHeights reads the heights of the chains of the nodes. It returns at once
+// if the previous poll is still running, e.g. when the nodes are slow.
+func (d *dashboard) pollHeights() {
+	if !d.pollingHeights.CompareAndSwap(false, true) {
+		return
+	}
+	defer d.pollingHeights.Store(false)
+	var wg sync.WaitGroup
+	for nodeAddr, chain := range d.nodeChains() {
+		wg.Add(1)
+		go func(nodeAddr string, chain [2]string) {
+			defer wg.Done()
+			height := ""
+			value, err := chains.BlockHeight(chain[0], nodeAddr, chain[1])
+			if err != nil {
+				height = "unavailable"
+			} else {
+				height = fmt.Sprintf("%d (%s)", value, chain[0])
+			}
+			d.lock.Lock()
+			d.heights[nodeAddr] = height
+			d.lock.Unlock()
+		}(nodeAddr, chain)
+	}
+	wg.Wait()
+}
+
+// render returns the frame of the dashboard, at most height lines of at most
+// width characters, and keeps the traffic to compute the next throughput.
+func (d *dashboard) render(now time.Time, width int, height int) string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "Proxy %s - config version %d - %s - press q to quit\n", d.proxyAddr, d.active.ConfigVersion, now.Format("15:04:05"))
+	if d.pollErr != nil {
+		fmt.Fprintf(&b, "Error polling the proxy: %v\n", d.pollErr)
+	}
+	if !d.streaming && d.auditFailed {
+		b.WriteString("Events and audit log unavailable: the config changes are not shown\n")
+	}
+	// nodes of the active config, and the nodes still forwarding data
+	b.WriteString("\n")
+	nodes := []string{}
+	seen := make(map[string]bool)
+	for _, node := range d.active.Config.Nodes {
+		nodes = append(nodes, node.Addr)
+		seen[node.Addr] = true
+	}
+	var others []string
+	for nodeAddr := range d.traffic {
+		if !seen[nodeAddr] {
+			others = append(others, nodeAddr)
+		}
+	}
+	sort.Strings(others)
+	nodes = append(nodes, others...)
+	elapsed := now.Sub(d.previousTime).Seconds()
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tRESPONSE\tTO NODE\tTO CLIENT\tTOTAL TO NODE\tTOTAL TO CLIENT\tHEIGHT")
+	for _, nodeAddr := range nodes {
+		response := ""
+		if nodeAddr == d.active.Config.ResponseNodeAddr {
+			response = "yes"
+		}
+		if !seen[nodeAddr] {
+			response = "(removed)"
+		}
+		traffic, previous := d.traffic[nodeAddr], d.previous[nodeAddr]
+		toNodeRate, toClientRate := "-", "-"
+		if !d.previousTime.IsZero() && elapsed > 0 {
+			toNodeRate = formatBytes(float64(traffic.toNode-previous.toNode)/elapsed) + "/s"
+			toClientRate = formatBytes(float64(traffic.toClient-previous.toClient)/elapsed) + "/s"
+		}
+		nodeHeight := d.heights[nodeAddr]
+		if nodeHeight == "" {
+			nodeHeight = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", nodeAddr, response, toNodeRate, toClientRate, formatBytes(float64(traffic.toNode)), formatBytes(float64(traffic.toClient)), nodeHeight)
+	}
+	w.Flush()
+	for _, trigger := range d.active.Config.Triggers {
+		fmt.Fprintf(&b, "Trigger %s: %s\n", trigger.Name, trigger.Condition.String())
+	}
+	d.previous = make(map[string]nodeTraffic, len(d.traffic))
+	for nodeAddr, traffic := range d.traffic {
+		d.previous[nodeAddr] = traffic
+	}
+	d.previousTime = now
+	// recent config changes, from the audit log or else from the events
+	b.WriteString("\nRecent config changes:\n")
+	changes := d.changes
+	if d.auditFailed {
+		changes = d.events
+	}
+	if len(changes) == 0 {
+		b.WriteString("  none\n")
+	}
+	for _, change := range changes {
+		b.WriteString("  " + change + "\n")
+	}
+	// sessions, as many as fit on the screen
+	fmt.Fprintf(&b, "\nSessions (%d):\n", len(d.sessions))
+	w = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCLIENT\tNODES\tRESPONSE NODE\tCONFIG\tAGE\tTO NODES\tTO CLIENT")
+	for _, session := range d.sessions {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			session.ID,
+			session.ClientAddr,
+			strings.Join(session.Nodes, ","),
+			session.ResponseNodeAddr,
+			session.ConfigVersion,
+			now.Sub(session.StartTime).Truncate(time.Second),
+			formatBytes(float64(session.BytesToNodes)),
+			formatBytes(float64(session.BytesToClient)),
+		)
+	}
+	w.Flush()
+	// fit the frame to the screen
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if height > 0 && len(lines) > height {
+		lines = lines[:height]
+	}
+	for i, line := range lines {
+		// cut at a character, not at a byte of a multibyte character
+		if width > 0 && utf8.RuneCountInString(line) > width {
+			lines[i] = string([]rune(line)[:width])
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// runTop shows the dashboard of the proxy, refreshed at the given interval,
+// until the user quits. When the output is not a terminal, a single frame is
+// printed after the first interval.
+// It returns the exit code of the controller.
+func runTop(proxyAddr string, credentials sender.Credentials, interval time.Duration, chain string, token string) int {
+	session, err := sender.Dial(proxyAddr, credentials)
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	defer session.Close()
+	d := newDashboard(proxyAddr, chain, token)
+	// follow the events of the proxy, if it streams them
+	watch, _ := wire.NewMessage(wire.TypeWatch, nil)
+	replies, err := session.Subscribe(watch)
+	if err == nil {
+		if reply, ok := <-replies; ok && reply.Succeeded() {
+			d.streaming = true
+			go func() {
+				for reply := range replies {
+					var event wire.Event
+					if reply.DecodePayload(&event) == nil {
+						d.record(event)
+					}
+				}
+			}()
+		}
+	}
+	err = d.poll(session)
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	d.render(time.Now(), 0, 0)
+	// print a single frame if the output is not a terminal
+	outFd := int(os.Stdout.Fd())
+	if !term.IsTerminal(outFd) {
+		time.Sleep(interval)
+		d.poll(session)
+		d.pollHeights()
+		fmt.Print(d.render(time.Now(), 0, 0))
+		return 0
+	}
+	go d.pollHeights()
+	// quit on q, Ctrl-C or a signal
+	quit := make(chan struct{}, 1)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		quit <- struct{}{}
+	}()
+	inFd := int(os.Stdin.Fd())
+	if term.IsTerminal(inFd) {
+		state, err := term.MakeRaw(inFd)
+		if err == nil {
+			defer term.Restore(inFd, state)
+			go func() {
+				key := make([]byte, 1)
+				for {
+					n, err := os.Stdin.Read(key)
+					if err != nil || (n == 1 && (key[0] == 'q' || key[0] == 3)) {
+						quit <- struct{}{}
+						return
+					}
+				}
+			}()
+		}
+	}
+	// use the alternate screen, without cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		width, height, err := term.GetSize(outFd)
+		if err != nil {
+			width, height = 0, 0
+		}
+		frame := d.render(time.Now(), width, height)
+		fmt.Print("\x1b[H\x1b[2J" + strings.ReplaceAll(frame, "\n", "\r\n"))
+		select {
+		case <-quit:
+			return 0
+		case <-ticker.C:
+		}
+		err = d.poll(session)
+		d.lock.Lock()
+		d.pollErr = err
+		d.lock.Unlock()
+		if errors.Is(err, sender.ErrNoReply) {
+			// the proxy closed the session
+			fmt.Print("\x1b[?25h\x1b[?1049l")
+			fmt.Println("The proxy closed the session")
+			return EXIT_ERROR
+		}
+		go d.pollHeights()
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the dashboard of the controller.
+*/
+
+import (
+	"semester-project/wire"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[float64]string{
+		0:       "0 B",
+		1023:    "1023 B",
+		1536:    "1.5 KiB",
+		3 << 20: "3.0 MiB",
+	}
+	for n, expected := range tests {
+		if got := formatBytes(n); got != expected {
+			t.Errorf("Error formatting %v bytes: got %q, expected %q", n, got, expected)
+		}
+	}
+}
+
+func TestDashboardRender(t *testing.T) {
+	d := newDashboard("127.0.0.1:9000", "", "")
+	d.streaming = true
+	d.auditFailed = true
+	d.active = wire.ActiveConfig{
+		ConfigVersion: 3,
+		Config: wire.Config{
+			Nodes:            []wire.Node{{Addr: "127.0.0.1:8001"}, {Addr: "127.0.0.1:8002"}},
+			ResponseNodeAddr: "127.0.0.1:8002",
+		},
+	}
+	nodes := []string{"127.0.0.1:8001", "127.0.0.1:8002"}
+	// the bytes forwarded before the first poll are not counted
+	d.countTraffic([]wire.ClientSession{
+		{ID: 1, Nodes: nodes, ResponseNodeAddr: "127.0.0.1:8002", BytesToNodes: 100, BytesToClient: 50},
+		{ID: 2, Nodes: nodes, ResponseNodeAddr: "127.0.0.1:8002", BytesToNodes: 10, BytesToClient: 10},
+	})
+	start := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	d.render(start, 0, 0)
+	// session 2 closed and session 3 started since the previous poll
+	d.countTraffic([]wire.ClientSession{
+		{ID: 1, Nodes: nodes, ResponseNodeAddr: "127.0.0.1:8002", BytesToNodes: 100 + 2048, BytesToClient: 50 + 512},
+		{ID: 3, Nodes: nodes[:1], ResponseNodeAddr: "127.0.0.1:8001", BytesToClient: 1024},
+	})
+	d.record(wire.Event{Time: start, Kind: wire.EventConfigApplied, ConfigVersion: 3, Source: "controller"})
+	frame := d.render(start.Add(2*time.Second), 0, 0)
+	for _, expected := range []string{
+		"config version 3",
+		"1.0 KiB/s",
+		"256 B/s",
+		"512 B/s",
+		"2.0 KiB",
+		"config-applied version=3 source=controller",
+		"Sessions (0)",
+	} {
+		if !strings.Contains(frame, expected) {
+			t.Errorf("Error rendering the dashboard: %q not found in\n%s", expected, frame)
+		}
+	}
+	// the throughput is computed since the previous frame
+	frame = d.render(start.Add(3*time.Second), 0, 0)
+	if !strings.Contains(frame, "0 B/s") || strings.Contains(frame, "1.0 KiB/s") {
+		t.Error("Error computing the throughput since the previous frame:\n" + frame)
+	}
+	// the frame fits the screen
+	frame = d.render(start.Add(4*time.Second), 20, 3)
+	lines := strings.Split(strings.TrimSuffix(frame, "\n"), "\n")
+	if len(lines) != 3 {
+		t.Errorf("Error fitting the frame: got %d lines, expected 3", len(lines))
+	}
+	for _, line := range lines {
+		if utf8.RuneCountInString(line) > 20 {
+			t.Errorf("Error fitting the frame: line %q is longer than 20", line)
+		}
+	}
+	// the lines are cut at a character, whatever the width
+	d.record(wire.Event{Time: start, Kind: wire.EventConfigApplied, ConfigVersion: 4, Source: "contrôleur équipe ✓✓✓✓"})
+	for width := 20; width < 80; width++ {
+		frame = d.render(start.Add(5*time.Second), width, 0)
+		for _, line := range strings.Split(strings.TrimSuffix(frame, "\n"), "\n") {
+			if !utf8.ValidString(line) || utf8.RuneCountInString(line) > width {
+				t.Errorf("Error fitting the frame: line %q does not fit %d characters", line, width)
+			}
+		}
+	}
+	if !strings.Contains(d.render(start.Add(6*time.Second), 0, 0), "contrôleur équipe ✓✓✓✓") {
+		t.Error("Error rendering the dashboard: multibyte source not found")
+	}
+}
+
+func TestPollHeightsSkipsRunningPoll(t *testing.T) {
+	d := newDashboard("127.0.0.1:9000", wire.ChainQuorum, "")
+	d.active.Config.Nodes = []wire.Node{{Addr: "127.0.0.1:1"}}
+	d.pollingHeights.Store(true)
+	d.pollHeights()
+	if len(d.heights) != 0 {
+		t.Error("Error polling the heights: polled while the previous poll was running")
+	}
+	d.pollingHeights.Store(false)
+	d.pollHeights()
+	if d.heights["127.0.0.1:1"] != "unavailable" || d.pollingHeights.Load() {
+		t.Error("Error polling the heights:", d.heights)
+	}
+}
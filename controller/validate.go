@@ -0,0 +1,166 @@
+package main
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to validate configs locally, with the
+validator of the proxy, before sending them.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"semester-project/controller/scenario"
+	"semester-project/controller/sender"
+	"semester-project/wire"
+	"sort"
+)
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// messageConfig returns the config carried by the message, or nil if it
+// carries none.
+func messageConfig(message wire.Message) (*wire.Config, error) {
+	switch message.Type {
+	case wire.TypeSetConfig, wire.TypeDiffConfig:
+		var config wire.Config
+		err := message.DecodePayload(&config)
+		if err != nil {
+			return nil, err
+		}
+		return &config, nil
+	case wire.TypeSavePreset:
+		var payload wire.PresetPayload
+		err := message.DecodePayload(&payload)
+		if err != nil {
+			return nil, err
+		}
+		return payload.Config, nil
+	default:
+		return nil, nil
+	}
+}
+
+// printReport prints the errors and warnings of the report, each line
+// starting with the prefix.
+func printReport(w io.Writer, prefix string, report wire.ValidationReport) {
+	for _, fieldErr := range report.Errors {
+		fmt.Fprintln(w, prefix+"error:", fieldErr)
+	}
+	for _, warning := range report.Warnings {
+		fmt.Fprintln(w, prefix+"warning:", warning)
+	}
+}
+
+// dryRun validates the config of the message and prints the JSON that would
+// be sent to the proxy, on the first message of a session. The errors and
+// warnings are printed to the standard error, so that only the JSON is printed
+// to the standard output.
+// It returns the exit code of the controller.
+func dryRun(credentials sender.Credentials, message wire.Message) int {
+	config, err := messageConfig(message)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+	exitCode := 0
+	if config != nil {
+		report := config.Validate()
+		printReport(os.Stderr, "", report)
+		if !report.OK() {
+			exitCode = EXIT_REJECTED
+		}
+	}
+	message.ID = "1"
+	if credentials.Identity != "" {
+		err = message.Sign(credentials.Identity, credentials.Key)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_ERROR
+		}
+	}
+	data, err := wire.EncodeMessage(message)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+	fmt.Println(string(data))
+	return exitCode
+}
+
+// validateFile validates the config file, or the configs applied by the
+// scenario file if its extension is .yaml or .yml.
+// It returns the exit code of the controller.
+func validateFile(path string) int {
+	reports := make(map[int]wire.ValidationReport)
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		s, err := scenario.Load(path)
+		if err != nil {
+			fmt.Println(err)
+			return EXIT_ERROR
+		}
+		reports, err = s.CheckConfigs()
+		if err != nil {
+			fmt.Println(path+":", err)
+			return EXIT_ERROR
+		}
+	default:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Println(err)
+			return EXIT_ERROR
+		}
+		var config wire.Config
+		err = json.Unmarshal(data, &config)
+		if err != nil {
+			fmt.Println(path+":", err)
+			return EXIT_ERROR
+		}
+		reports[0] = config.Validate()
+	}
+	// print the reports in the order of the steps
+	steps := make([]int, 0, len(reports))
+	for step := range reports {
+		steps = append(steps, step)
+	}
+	sort.Ints(steps)
+	exitCode := 0
+	for _, step := range steps {
+		prefix := path + ": "
+		if step > 0 {
+			prefix = fmt.Sprintf("%s: step %d: ", path, step)
+		}
+		report := reports[step]
+		printReport(os.Stdout, prefix, report)
+		if !report.OK() {
+			exitCode = EXIT_REJECTED
+		}
+	}
+	if exitCode == 0 {
+		fmt.Println(path+":", "OK")
+	}
+	return exitCode
+}
+
+// runValidate validates the config and scenario files.
+// It returns the exit code of the first invalid file, or 0.
+func runValidate(args []string) int {
+	if len(args) == 0 {
+		fmt.Println("usage: controller validate [config or scenario files...]")
+		return EXIT_ERROR
+	}
+	exitCode := 0
+	for _, path := range args {
+		code := validateFile(path)
+		if code != 0 && exitCode == 0 {
+			exitCode = code
+		}
+	}
+	return exitCode
+}
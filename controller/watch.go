@@ -0,0 +1,64 @@
+package main
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to show the events of the proxy live.
+*/
+
+import (
+	"fmt"
+	"semester-project/controller/messages"
+	"semester-project/controller/sender"
+	"semester-project/wire"
+)
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// runWatch subscribes to the events of the proxy and prints them, one per
+// line, until the proxy closes the session.
+// It returns the exit code of the controller.
+func runWatch(proxyAddr string, credentials sender.Credentials) int {
+	command := messages.FindCommand("watch")
+	message, err := messages.BuildMessage([]string{command.Name})
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	// open the session
+	session, err := sender.Dial(proxyAddr, credentials)
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	defer session.Close()
+	replies, err := session.Subscribe(message)
+	if err != nil {
+		fmt.Println(err)
+		return EXIT_ERROR
+	}
+	// the first reply acknowledges the subscription
+	reply, ok := <-replies
+	if !ok {
+		fmt.Println(sender.ErrNoReply)
+		return EXIT_ERROR
+	}
+	if !reply.Succeeded() {
+		return printReply(command, command.FlagSet(), reply)
+	}
+	fmt.Printf("Watching the events of %s (config version %d)\n", proxyAddr, reply.ConfigVersion)
+	// print the events
+	for reply := range replies {
+		var event wire.Event
+		err := reply.DecodePayload(&event)
+		if err != nil {
+			fmt.Println("Error reading event:", err)
+			continue
+		}
+		fmt.Println(event)
+	}
+	fmt.Println("The proxy closed the session")
+	return 0
+}
@@ -0,0 +1,263 @@
+package admin
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the HTTP/JSON admin API of the proxy. It is
+backed by the same configuration manager as the configuration port.
+*/
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"semester-project/proxy/auth"
+	"semester-project/proxy/configuration"
+	"semester-project/proxy/connection"
+	"semester-project/proxy/logs"
+	"semester-project/proxy/sessions"
+	"semester-project/wire"
+	"strconv"
+	"strings"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A Server serves the admin API.
+type Server struct {
+	configManager *configuration.ConfigManager
+	registry      *sessions.Registry
+	logger        *logs.Logger
+	mux           *http.ServeMux
+	// verifier authenticates the requests, if set
+	verifier *auth.Verifier
+	// maxBodySize is the maximum size of the body of a request, in bytes.
+	maxBodySize int64
+}
+
+// identityKey is the key of the identity of an authenticated request in its
+// context.
+type identityKey struct{}
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// writeJSON writes the value as the JSON body of the response.
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		s.logger.Error("Error writing admin response", "error", err)
+	}
+}
+
+// writeReply writes the reply to a control message. Rejected messages are
+// answered with 422 Unprocessable Entity.
+func (s *Server) writeReply(w http.ResponseWriter, reply wire.Reply) {
+	status := http.StatusOK
+	if !reply.Succeeded() {
+		status = http.StatusUnprocessableEntity
+	}
+	s.writeJSON(w, status, reply)
+}
+
+// writeError writes an error as a rejection.
+func (s *Server) writeError(w http.ResponseWriter, status int, message string) {
+	s.writeJSON(w, status, wire.NewRejection(wire.ValidationReport{
+		Errors: []wire.FieldError{{Message: message}},
+	}))
+}
+
+// readBody reads the body of the request, up to the maximum size. If it
+// cannot be read, the error is written as the response.
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			s.writeError(w, http.StatusRequestEntityTooLarge, "request larger than "+strconv.FormatInt(s.maxBodySize, 10)+" bytes")
+		} else {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+// authenticate checks the signature of the request, which covers its method,
+// its URI and its body, and returns the identity that signed it.
+func (s *Server) authenticate(r *http.Request, body []byte) (string, error) {
+	requestAuth, err := wire.ParseAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return "", err
+	}
+	message := wire.NewRequestMessage(r.Method, r.URL.RequestURI(), body)
+	message.Auth = requestAuth
+	return s.verifier.Verify(message)
+}
+
+// handleControl handles a message as if it was received on the configuration
+// port.
+func (s *Server) handleControl(w http.ResponseWriter, r *http.Request, messageType string, payload interface{}) {
+	message, err := wire.NewMessage(messageType, payload)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	origin := configuration.Origin{Source: "admin " + r.RemoteAddr}
+	if identity, ok := r.Context().Value(identityKey{}).(string); ok {
+		origin.Identity = identity
+	}
+	s.writeReply(w, connection.HandleControlMessage(message, origin, s.configManager))
+}
+
+// handleConfig handles GET and PUT /config.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.writeJSON(w, http.StatusOK, s.configManager.GetActiveConfig())
+	case http.MethodPut:
+		body, err := s.readBody(w, r)
+		if err != nil {
+			return
+		}
+		var config wire.Config
+		err = json.Unmarshal(body, &config)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "malformed configuration: "+err.Error())
+			return
+		}
+		s.handleControl(w, r, wire.TypeSetConfig, config)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+	}
+}
+
+// handleConnections handles GET /connections.
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, s.registry.List())
+}
+
+// handleHistory handles GET /history.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, s.configManager.GetHistory())
+}
+
+// handleAudit handles GET /audit, whose optional limit parameter is the
+// number of entries to return.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	var query wire.AuditQuery
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		var err error
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "malformed limit: "+limit)
+			return
+		}
+	}
+	s.handleControl(w, r, wire.TypeAudit, query)
+}
+
+// handlePresets handles GET /presets and POST /presets/{name}/apply.
+func (s *Server) handlePresets(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/presets"), "/")
+	if path == "" && r.Method == http.MethodGet {
+		s.writeJSON(w, http.StatusOK, s.configManager.GetPresets())
+		return
+	}
+	name, action, ok := strings.Cut(path, "/")
+	if !ok || name == "" || action != "apply" {
+		s.writeError(w, http.StatusNotFound, "not found: "+r.URL.Path)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	s.handleControl(w, r, wire.TypeApplyPreset, wire.PresetPayload{Name: name})
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// NewServer creates and returns a new Server.
+func NewServer(configManager *configuration.ConfigManager, registry *sessions.Registry, logger *logs.Logger) *Server {
+	s := &Server{
+		configManager: configManager,
+		registry:      registry,
+		logger:        logger,
+		mux:           http.NewServeMux(),
+		maxBodySize:   wire.DEFAULT_MAX_FRAME_SIZE,
+	}
+	s.mux.HandleFunc("/config", s.handleConfig)
+	s.mux.HandleFunc("/connections", s.handleConnections)
+	s.mux.HandleFunc("/history", s.handleHistory)
+	s.mux.HandleFunc("/audit", s.handleAudit)
+	s.mux.HandleFunc("/presets", s.handlePresets)
+	s.mux.HandleFunc("/presets/", s.handlePresets)
+	return s
+}
+
+// RequireAuth requires every request to be signed with a key of the verifier,
+// like the configuration messages. The signature is sent in the
+// Authorization header, so the keys never travel on the network.
+func (s *Server) RequireAuth(verifier *auth.Verifier) {
+	s.verifier = verifier
+}
+
+// LimitBodySize sets the maximum size of the body of a request, in bytes.
+func (s *Server) LimitBodySize(size int64) {
+	s.maxBodySize = size
+}
+
+// ServeHTTP serves the admin API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.verifier != nil {
+		// the body is signed, so it is read before the request is handled
+		body, err := s.readBody(w, r)
+		if err != nil {
+			return
+		}
+		identity, err := s.authenticate(r, body)
+		if err != nil {
+			s.logger.Error("Unauthenticated admin request", "remote", r.RemoteAddr, "error", err)
+			w.Header().Set("WWW-Authenticate", wire.HTTP_AUTH_SCHEME)
+			s.writeError(w, http.StatusUnauthorized, "unauthenticated request: "+err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r = r.WithContext(context.WithValue(r.Context(), identityKey{}, identity))
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves the admin API on the given address.
+func (s *Server) ListenAndServe(addr string) error {
+	s.logger.Info("Listening for admin API requests", "addr", addr)
+	return http.ListenAndServe(addr, s)
+}
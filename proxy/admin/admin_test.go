@@ -0,0 +1,197 @@
+package admin
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the admin API.
+*/
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"semester-project/proxy/auth"
+	"semester-project/proxy/configuration"
+	"semester-project/proxy/connection"
+	"semester-project/proxy/logs"
+	"semester-project/proxy/sessions"
+	"semester-project/wire"
+	"strings"
+	"testing"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Helpers
+//------------------------------------------------------------------------------
+
+// newTestServer creates an admin server backed by a new config manager.
+func newTestServer(t *testing.T) (*httptest.Server, *configuration.ConfigManager) {
+	t.Helper()
+	return newTestServerWith(t, nil)
+}
+
+// newTestServerWith creates an admin server backed by a new config manager,
+// configured by the function if not nil.
+func newTestServerWith(t *testing.T, configure func(server *Server)) (*httptest.Server, *configuration.ConfigManager) {
+	t.Helper()
+	_, logger, err := logs.GetLoggers(logs.Options{Path: os.DevNull})
+	if err != nil {
+		t.Fatal("Error getting loggers:", err)
+	}
+	connection.InitConfigLogger(logger)
+	configManager := configuration.NewConfigManager()
+	adminServer := NewServer(configManager, sessions.NewRegistry(), logger)
+	if configure != nil {
+		configure(adminServer)
+	}
+	server := httptest.NewServer(adminServer)
+	t.Cleanup(server.Close)
+	return server, configManager
+}
+
+// request sends a request to the admin server and decodes the JSON response.
+func request(t *testing.T, method string, url string, body string, v interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal("Error creating request:", err)
+	}
+	return send(t, req, v)
+}
+
+// send sends the request to the admin server and decodes the JSON response.
+func send(t *testing.T, req *http.Request, v interface{}) int {
+	t.Helper()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Error sending request:", err)
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		t.Fatal("Error decoding response:", err)
+	}
+	return resp.StatusCode
+}
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestPutAndGetConfig(t *testing.T) {
+	server, _ := newTestServer(t)
+	var reply wire.Reply
+	status := request(t, http.MethodPut, server.URL+"/config",
+		`{"nodes":[{"addr":"127.0.0.1:8001"}],"responseNodeAddr":"127.0.0.1:8001"}`, &reply)
+	if status != http.StatusOK || !reply.Succeeded() || reply.ConfigVersion != 1 {
+		t.Fatalf("Error putting config: status %d, reply %v", status, reply)
+	}
+	var active wire.ActiveConfig
+	request(t, http.MethodGet, server.URL+"/config", "", &active)
+	if active.ConfigVersion != 1 || active.Config.ResponseNodeAddr != "127.0.0.1:8001" {
+		t.Error("Error getting config: got", active)
+	}
+	var history []wire.HistoryEntry
+	request(t, http.MethodGet, server.URL+"/history", "", &history)
+	if len(history) != 1 || !strings.HasPrefix(history[0].Source, "admin ") {
+		t.Error("Error getting history: got", history)
+	}
+}
+
+func TestPutInvalidConfig(t *testing.T) {
+	server, configManager := newTestServer(t)
+	var reply wire.Reply
+	status := request(t, http.MethodPut, server.URL+"/config", `{"nodes":[],"responseNodeAddr":"127.0.0.1:8001"}`, &reply)
+	if status != http.StatusUnprocessableEntity || reply.Succeeded() {
+		t.Errorf("Error putting invalid config: status %d, reply %v", status, reply)
+	}
+	if configManager.GetVersion() != 0 {
+		t.Error("Error putting invalid config: config was updated")
+	}
+}
+
+func TestApplyPreset(t *testing.T) {
+	server, configManager := newTestServer(t)
+	preset := wire.Config{Nodes: []wire.Node{{Addr: "127.0.0.1:8002"}}, ResponseNodeAddr: "127.0.0.1:8002"}
+	err := configManager.SavePreset("twin-only", preset)
+	if err != nil {
+		t.Fatal("Error saving preset:", err)
+	}
+	var reply wire.Reply
+	status := request(t, http.MethodPost, server.URL+"/presets/twin-only/apply", "", &reply)
+	if status != http.StatusOK || configManager.GetConfig().ResponseNodeAddr != "127.0.0.1:8002" {
+		t.Errorf("Error applying preset: status %d, reply %v", status, reply)
+	}
+	status = request(t, http.MethodPost, server.URL+"/presets/unknown/apply", "", &reply)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("Error applying unknown preset: status %d", status)
+	}
+}
+
+func TestGetConnections(t *testing.T) {
+	server, _ := newTestServer(t)
+	var connections []wire.ClientSession
+	status := request(t, http.MethodGet, server.URL+"/connections", "", &connections)
+	if status != http.StatusOK || len(connections) != 0 {
+		t.Errorf("Error getting connections: status %d, got %v", status, connections)
+	}
+}
+
+func TestSignedRequests(t *testing.T) {
+	key := []byte("secret")
+	server, configManager := newTestServerWith(t, func(server *Server) {
+		server.RequireAuth(auth.NewVerifier(map[string][]byte{"team-a": key}, time.Minute))
+	})
+	body := `{"nodes":[{"addr":"127.0.0.1:8001"}],"responseNodeAddr":"127.0.0.1:8001"}`
+	message := wire.NewRequestMessage(http.MethodPut, "/config", []byte(body))
+	err := message.Sign("team-a", key)
+	if err != nil {
+		t.Fatal("Error signing request:", err)
+	}
+	newRequest := func(body string) *http.Request {
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/config", strings.NewReader(body))
+		if err != nil {
+			t.Fatal("Error creating request:", err)
+		}
+		req.Header.Set("Authorization", message.Auth.Header())
+		return req
+	}
+	var reply wire.Reply
+	status := send(t, newRequest(body), &reply)
+	if status != http.StatusOK || configManager.GetVersion() != 1 {
+		t.Fatalf("Error sending signed request: status %d, reply %v", status, reply)
+	}
+	if history := configManager.GetHistory(); len(history) != 1 || history[0].Identity != "team-a" {
+		t.Error("Error sending signed request: identity not recorded", history)
+	}
+	// the signature cannot be replayed, nor used for another body
+	status = send(t, newRequest(body), &reply)
+	if status != http.StatusUnauthorized {
+		t.Errorf("Error replaying signed request: status %d", status)
+	}
+	status = send(t, newRequest(`{"nodes":[]}`), &reply)
+	if status != http.StatusUnauthorized {
+		t.Errorf("Error sending tampered request: status %d", status)
+	}
+	// the key itself is not accepted
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/config", nil)
+	req.SetBasicAuth("team-a", string(key))
+	status = send(t, req, &reply)
+	if status != http.StatusUnauthorized {
+		t.Errorf("Error sending basic authentication: status %d", status)
+	}
+}
+
+func TestPutLargeConfig(t *testing.T) {
+	server, configManager := newTestServerWith(t, func(server *Server) {
+		server.LimitBodySize(16)
+	})
+	var reply wire.Reply
+	status := request(t, http.MethodPut, server.URL+"/config",
+		`{"nodes":[{"addr":"127.0.0.1:8001"}],"responseNodeAddr":"127.0.0.1:8001"}`, &reply)
+	if status != http.StatusRequestEntityTooLarge || configManager.GetVersion() != 0 {
+		t.Errorf("Error putting large config: status %d, reply %v", status, reply)
+	}
+}
@@ -0,0 +1,96 @@
+package audit
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the append-only audit log of the config changes
+of the proxy.
+*/
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"semester-project/wire"
+	"sync"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A Log is an append-only file of audit entries, one JSON object per line.
+// Entries written by previous runs of the proxy are kept.
+// It is thread-safe.
+type Log struct {
+	lock sync.Mutex
+	path string
+	file *os.File
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// Open opens the audit log at the given path, creating it if needed.
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{path: path, file: file}, nil
+}
+
+// Append writes the entry at the end of the log.
+func (l *Log) Append(entry wire.AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, err = l.file.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+	// the entry must survive a crash of the proxy
+	return l.file.Sync()
+}
+
+// Read returns the last limit entries of the log, oldest first, or all of them
+// if limit is 0.
+func (l *Log) Read(limit int) ([]wire.AuditEntry, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	entries := []wire.AuditEntry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), wire.DEFAULT_MAX_FRAME_SIZE)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		var entry wire.AuditEntry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", l.path, lineNumber, err)
+		}
+		entries = append(entries, entry)
+		if limit > 0 && len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Close closes the log.
+func (l *Log) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.file.Close()
+}
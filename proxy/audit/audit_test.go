@@ -0,0 +1,54 @@
+package audit
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the audit log.
+*/
+
+import (
+	"path/filepath"
+	"semester-project/wire"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := Open(path)
+	if err != nil {
+		t.Fatal("Error opening audit log:", err)
+	}
+	for version := uint64(1); version <= 3; version++ {
+		err = log.Append(wire.AuditEntry{
+			Origin:          wire.Origin{Source: "test", Identity: "team-a"},
+			PreviousVersion: version - 1,
+			ConfigVersion:   version,
+		})
+		if err != nil {
+			t.Fatal("Error appending to audit log:", err)
+		}
+	}
+	log.Close()
+	// the entries of the previous runs are kept
+	log, err = Open(path)
+	if err != nil {
+		t.Fatal("Error reopening audit log:", err)
+	}
+	defer log.Close()
+	log.Append(wire.AuditEntry{PreviousVersion: 3, ConfigVersion: 4})
+	entries, err := log.Read(0)
+	if err != nil || len(entries) != 4 {
+		t.Fatal("Error reading audit log: expected 4 entries, got", len(entries), err)
+	}
+	if entries[0].Identity != "team-a" || entries[3].ConfigVersion != 4 {
+		t.Error("Error reading audit log: wrong entries", entries)
+	}
+	entries, err = log.Read(2)
+	if err != nil || len(entries) != 2 || entries[0].ConfigVersion != 3 {
+		t.Error("Error reading last entries of audit log: got", entries, err)
+	}
+}
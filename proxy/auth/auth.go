@@ -0,0 +1,142 @@
+package auth
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to authenticate the messages received
+on the configuration channel.
+*/
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"semester-project/wire"
+	"strings"
+	"sync"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A Verifier authenticates the messages signed with the keys it knows, and
+// rejects the messages replayed or signed too far from the current time.
+// It is thread-safe.
+type Verifier struct {
+	keys   map[string][]byte
+	window time.Duration
+	lock   sync.Mutex
+	// nonces contains the nonces seen in the window, with their expiry
+	nonces map[string]time.Time
+	// now returns the current time, it is replaced in the tests
+	now func() time.Time
+}
+
+//------------------------------------------------------------------------------
+// Errors
+//------------------------------------------------------------------------------
+
+// ErrUnknownIdentity is returned when a message is signed by an unknown
+// identity.
+var ErrUnknownIdentity = errors.New("unknown identity")
+
+// ErrStale is returned when a message was signed too far from the current
+// time.
+var ErrStale = errors.New("stale message")
+
+// ErrReplay is returned when a message was already received.
+var ErrReplay = errors.New("replayed message")
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// prune forgets the expired nonces.
+// It must be called with the lock held.
+func (v *Verifier) prune(now time.Time) {
+	for nonce, expiry := range v.nonces {
+		if now.After(expiry) {
+			delete(v.nonces, nonce)
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// NewVerifier creates and returns a new Verifier knowing the given keys,
+// indexed by identity. Messages signed more than window away from the current
+// time are rejected.
+func NewVerifier(keys map[string][]byte, window time.Duration) *Verifier {
+	return &Verifier{
+		keys:   keys,
+		window: window,
+		nonces: make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// LoadKeys reads the keys from a file containing one identity:secret pair per
+// line. Empty lines and lines starting with '#' are ignored.
+func LoadKeys(path string) (map[string][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	keys := make(map[string][]byte)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		identity, secret, ok := strings.Cut(line, ":")
+		if !ok || identity == "" || secret == "" {
+			return nil, fmt.Errorf("%s:%d: expected identity:secret", path, lineNumber)
+		}
+		keys[identity] = []byte(secret)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no key", path)
+	}
+	return keys, nil
+}
+
+// Verify authenticates the message and returns the identity that signed it.
+func (v *Verifier) Verify(message wire.Message) (string, error) {
+	if message.Auth == nil {
+		return "", wire.ErrUnsigned
+	}
+	key, ok := v.keys[message.Auth.Identity]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownIdentity, message.Auth.Identity)
+	}
+	err := message.VerifySignature(key)
+	if err != nil {
+		return "", err
+	}
+	// check the freshness of the message
+	now := v.now()
+	signed := time.Unix(message.Auth.Timestamp, 0)
+	if signed.Before(now.Add(-v.window)) || signed.After(now.Add(v.window)) {
+		return "", fmt.Errorf("%w: signed at %s", ErrStale, signed.Format(time.RFC3339))
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.prune(now)
+	nonce := message.Auth.Identity + "/" + message.Auth.Nonce
+	if _, ok := v.nonces[nonce]; ok {
+		return "", ErrReplay
+	}
+	// the nonce can be forgotten once the message is stale
+	v.nonces[nonce] = signed.Add(v.window)
+	return message.Auth.Identity, nil
+}
@@ -0,0 +1,57 @@
+package auth
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the authentication of the
+messages.
+*/
+
+import (
+	"errors"
+	"semester-project/wire"
+	"testing"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestVerify(t *testing.T) {
+	verifier := NewVerifier(map[string][]byte{"team-a": []byte("secret")}, time.Minute)
+	message, _ := wire.NewMessage(wire.TypeListPresets, nil)
+	_, err := verifier.Verify(message)
+	if !errors.Is(err, wire.ErrUnsigned) {
+		t.Error("Error verifying unsigned message: expected ErrUnsigned, got", err)
+	}
+	message.Sign("team-a", []byte("secret"))
+	identity, err := verifier.Verify(message)
+	if err != nil || identity != "team-a" {
+		t.Fatalf("Error verifying signed message: got %q, %v", identity, err)
+	}
+	_, err = verifier.Verify(message)
+	if !errors.Is(err, ErrReplay) {
+		t.Error("Error verifying replayed message: expected ErrReplay, got", err)
+	}
+	message.Sign("team-b", []byte("secret"))
+	_, err = verifier.Verify(message)
+	if !errors.Is(err, ErrUnknownIdentity) {
+		t.Error("Error verifying message of unknown identity: expected ErrUnknownIdentity, got", err)
+	}
+}
+
+func TestVerifyStale(t *testing.T) {
+	key := []byte("secret")
+	verifier := NewVerifier(map[string][]byte{"team-a": key}, time.Minute)
+	// pretend the message is received two minutes after it was signed
+	verifier.now = func() time.Time {
+		return time.Now().Add(2 * time.Minute)
+	}
+	message, _ := wire.NewMessage(wire.TypeListPresets, nil)
+	message.Sign("team-a", key)
+	_, err := verifier.Verify(message)
+	if !errors.Is(err, ErrStale) {
+		t.Error("Error verifying stale message: expected ErrStale, got", err)
+	}
+}
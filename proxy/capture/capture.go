@@ -0,0 +1,388 @@
+package capture
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to capture the streams of a client
+session to a pcapng file, with synthetic IP and TCP headers so that the file
+can be opened with Wireshark.
+*/
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A File is a pcapng capture file of the streams of a session.
+// It is thread-safe, so that the streams can be recorded by the goroutines
+// forwarding their data.
+type File struct {
+	lock    sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	streams []*Stream
+	closed  bool
+	// err is the first error writing the file, after which nothing is
+	// written.
+	err error
+}
+
+// A Stream is a TCP connection captured in a file, between a client side and
+// a server side. The sequence numbers of both sides are synthesized from the
+// data recorded.
+type Stream struct {
+	file   *File
+	client *net.TCPAddr
+	server *net.TCPAddr
+	// clientSeq and serverSeq are the next sequence numbers of the sides.
+	clientSeq uint32
+	serverSeq uint32
+	closed    bool
+}
+
+// streamWriter is a writer recording the data written as sent by a side of
+// the stream.
+type streamWriter struct {
+	stream     *Stream
+	fromClient bool
+}
+
+// teeWriter is a writer writing to the underlying writer and recording the
+// data written as sent by a side of the stream.
+type teeWriter struct {
+	writer     io.Writer
+	stream     *Stream
+	fromClient bool
+}
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// Block types of pcapng.
+const (
+	BLOCK_SECTION_HEADER    = 0x0A0D0D0A
+	BLOCK_INTERFACE         = 0x00000001
+	BLOCK_ENHANCED_PACKET   = 0x00000006
+	BYTE_ORDER_MAGIC        = 0x1A2B3C4D
+	OPTION_END              = 0
+	OPTION_COMMENT          = 1
+	LINKTYPE_RAW            = 101
+	INITIAL_SEQUENCE        = 1
+	MAX_SEGMENT_SIZE        = 65000
+	TCP_HEADER_SIZE         = 20
+	IPV4_HEADER_SIZE        = 20
+	IPV6_HEADER_SIZE        = 40
+	TCP_FLAG_FIN            = 0x01
+	TCP_FLAG_SYN            = 0x02
+	TCP_FLAG_PSH            = 0x08
+	TCP_FLAG_ACK            = 0x10
+	TCP_WINDOW              = 65535
+	IP_TTL                  = 64
+	IP_PROTOCOL_TCP         = 6
+	IPV4_FLAG_DONT_FRAGMENT = 0x4000
+)
+
+// FILE_TIME_FORMAT is the format of the time in the names of the capture
+// files, the start of the session in UTC.
+const FILE_TIME_FORMAT = "20060102T150405.000"
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// pad returns the number of bytes padding n bytes to 32 bits.
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
+
+// checksum returns the Internet checksum of the data.
+func checksum(sum uint32, data []byte) uint16 {
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+// tcpAddr returns the address as a TCP address.
+func tcpAddr(addr net.Addr) *net.TCPAddr {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp
+	}
+	tcp, err := net.ResolveTCPAddr("tcp", addr.String())
+	if err != nil {
+		return &net.TCPAddr{IP: net.IPv4zero}
+	}
+	return tcp
+}
+
+// packet returns an IP packet carrying a TCP segment from src to dst.
+func packet(src *net.TCPAddr, dst *net.TCPAddr, seq uint32, ack uint32, flags byte, payload []byte) []byte {
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	ipv4 := srcIP != nil && dstIP != nil
+	if !ipv4 {
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+	}
+	tcpLength := TCP_HEADER_SIZE + len(payload)
+	// pseudo header of the TCP checksum
+	var pseudo []byte
+	pseudo = append(pseudo, srcIP...)
+	pseudo = append(pseudo, dstIP...)
+	if ipv4 {
+		pseudo = append(pseudo, 0, IP_PROTOCOL_TCP, byte(tcpLength>>8), byte(tcpLength))
+	} else {
+		pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(tcpLength))
+		pseudo = append(pseudo, 0, 0, 0, IP_PROTOCOL_TCP)
+	}
+	tcp := make([]byte, tcpLength)
+	binary.BigEndian.PutUint16(tcp[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(tcp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	binary.BigEndian.PutUint32(tcp[8:], ack)
+	tcp[12] = TCP_HEADER_SIZE / 4 << 4
+	tcp[13] = flags
+	binary.BigEndian.PutUint16(tcp[14:], TCP_WINDOW)
+	copy(tcp[TCP_HEADER_SIZE:], payload)
+	var sum uint32
+	for i := 0; i+1 < len(pseudo); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(pseudo[i:]))
+	}
+	binary.BigEndian.PutUint16(tcp[16:], checksum(sum, tcp))
+	if ipv4 {
+		ip := make([]byte, IPV4_HEADER_SIZE, IPV4_HEADER_SIZE+tcpLength)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(IPV4_HEADER_SIZE+tcpLength))
+		binary.BigEndian.PutUint16(ip[6:], IPV4_FLAG_DONT_FRAGMENT)
+		ip[8] = IP_TTL
+		ip[9] = IP_PROTOCOL_TCP
+		copy(ip[12:], srcIP)
+		copy(ip[16:], dstIP)
+		binary.BigEndian.PutUint16(ip[10:], checksum(0, ip))
+		return append(ip, tcp...)
+	}
+	ip := make([]byte, IPV6_HEADER_SIZE, IPV6_HEADER_SIZE+tcpLength)
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:], uint16(tcpLength))
+	ip[6] = IP_PROTOCOL_TCP
+	ip[7] = IP_TTL
+	copy(ip[8:], srcIP)
+	copy(ip[24:], dstIP)
+	return append(ip, tcp...)
+}
+
+// writeBlock writes a pcapng block with the given body.
+// It must be called with the lock held.
+func (f *File) writeBlock(blockType uint32, body []byte) {
+	if f.err != nil {
+		return
+	}
+	length := uint32(12 + len(body))
+	block := make([]byte, 0, length)
+	block = binary.LittleEndian.AppendUint32(block, blockType)
+	block = binary.LittleEndian.AppendUint32(block, length)
+	block = append(block, body...)
+	block = binary.LittleEndian.AppendUint32(block, length)
+	_, f.err = f.writer.Write(block)
+}
+
+// writePacket writes the packet in an enhanced packet block, with the
+// comment if not empty.
+// It must be called with the lock held.
+func (f *File) writePacket(now time.Time, packet []byte, comment string) {
+	timestamp := uint64(now.UnixMicro())
+	body := make([]byte, 0, 20+len(packet)+pad(len(packet))+len(comment)+12)
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, uint32(timestamp>>32))
+	body = binary.LittleEndian.AppendUint32(body, uint32(timestamp))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(packet)))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(packet)))
+	body = append(body, packet...)
+	body = append(body, make([]byte, pad(len(packet)))...)
+	if comment != "" {
+		body = binary.LittleEndian.AppendUint16(body, OPTION_COMMENT)
+		body = binary.LittleEndian.AppendUint16(body, uint16(len(comment)))
+		body = append(body, comment...)
+		body = append(body, make([]byte, pad(len(comment)))...)
+		body = binary.LittleEndian.AppendUint32(body, OPTION_END)
+	}
+	f.writeBlock(BLOCK_ENHANCED_PACKET, body)
+}
+
+// record writes the data sent by a side of the stream as TCP segments.
+// It must be called with the lock of the file held.
+func (s *Stream) record(now time.Time, fromClient bool, data []byte) {
+	for len(data) > 0 {
+		segment := data
+		if len(segment) > MAX_SEGMENT_SIZE {
+			segment = segment[:MAX_SEGMENT_SIZE]
+		}
+		data = data[len(segment):]
+		if fromClient {
+			s.file.writePacket(now, packet(s.client, s.server, s.clientSeq, s.serverSeq, TCP_FLAG_PSH|TCP_FLAG_ACK, segment), "")
+			s.clientSeq += uint32(len(segment))
+		} else {
+			s.file.writePacket(now, packet(s.server, s.client, s.serverSeq, s.clientSeq, TCP_FLAG_PSH|TCP_FLAG_ACK, segment), "")
+			s.serverSeq += uint32(len(segment))
+		}
+	}
+}
+
+// close writes the closing handshake of the stream.
+// It must be called with the lock of the file held.
+func (s *Stream) close(now time.Time) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.file.writePacket(now, packet(s.client, s.server, s.clientSeq, s.serverSeq, TCP_FLAG_FIN|TCP_FLAG_ACK, nil), "")
+	s.file.writePacket(now, packet(s.server, s.client, s.serverSeq, s.clientSeq+1, TCP_FLAG_FIN|TCP_FLAG_ACK, nil), "")
+	s.file.writePacket(now, packet(s.client, s.server, s.clientSeq+1, s.serverSeq+1, TCP_FLAG_ACK, nil), "")
+}
+
+// Write records the data as sent by the side of the stream.
+func (w streamWriter) Write(data []byte) (int, error) {
+	w.stream.Record(w.fromClient, data)
+	return len(data), nil
+}
+
+// Write writes the data to the underlying writer and records the bytes
+// written as sent by the side of the stream.
+func (w teeWriter) Write(data []byte) (int, error) {
+	n, err := w.writer.Write(data)
+	if n > 0 {
+		w.stream.Record(w.fromClient, data[:n])
+	}
+	return n, err
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// Create creates the capture file and writes its header.
+func Create(path string) (*File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{file: file, writer: bufio.NewWriter(file)}
+	// section header, of unknown length
+	header := make([]byte, 0, 16)
+	header = binary.LittleEndian.AppendUint32(header, BYTE_ORDER_MAGIC)
+	header = binary.LittleEndian.AppendUint16(header, 1)
+	header = binary.LittleEndian.AppendUint16(header, 0)
+	header = binary.LittleEndian.AppendUint64(header, ^uint64(0))
+	f.writeBlock(BLOCK_SECTION_HEADER, header)
+	// a single interface carrying raw IP packets, without snapshot length
+	description := make([]byte, 0, 8)
+	description = binary.LittleEndian.AppendUint16(description, LINKTYPE_RAW)
+	description = binary.LittleEndian.AppendUint16(description, 0)
+	description = binary.LittleEndian.AppendUint32(description, 0)
+	f.writeBlock(BLOCK_INTERFACE, description)
+	if f.err != nil {
+		file.Close()
+		return nil, f.err
+	}
+	return f, nil
+}
+
+// NewStream starts the capture of a TCP connection between the client side
+// and the server side, by writing its opening handshake. The comment, e.g.
+// the role of the connection, is attached to the first packet.
+func (f *File) NewStream(client net.Addr, server net.Addr, comment string) *Stream {
+	if f == nil {
+		return nil
+	}
+	s := &Stream{
+		file:      f,
+		client:    tcpAddr(client),
+		server:    tcpAddr(server),
+		clientSeq: INITIAL_SEQUENCE,
+		serverSeq: INITIAL_SEQUENCE,
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		s.closed = true
+		return s
+	}
+	now := time.Now()
+	f.writePacket(now, packet(s.client, s.server, s.clientSeq-1, 0, TCP_FLAG_SYN, nil), comment)
+	f.writePacket(now, packet(s.server, s.client, s.serverSeq-1, s.clientSeq, TCP_FLAG_SYN|TCP_FLAG_ACK, nil), "")
+	f.writePacket(now, packet(s.client, s.server, s.clientSeq, s.serverSeq, TCP_FLAG_ACK, nil), "")
+	f.streams = append(f.streams, s)
+	return s
+}
+
+// Record records the data as sent by the client side of the stream, or by
+// its server side. A nil Stream records nothing.
+func (s *Stream) Record(fromClient bool, data []byte) {
+	if s == nil {
+		return
+	}
+	s.file.lock.Lock()
+	defer s.file.lock.Unlock()
+	if s.closed || s.file.closed {
+		return
+	}
+	s.record(time.Now(), fromClient, data)
+}
+
+// Writer returns a writer recording the data written as sent by the client
+// side of the stream, or by its server side.
+func (s *Stream) Writer(fromClient bool) io.Writer {
+	if s == nil {
+		return io.Discard
+	}
+	return streamWriter{stream: s, fromClient: fromClient}
+}
+
+// Tee returns a writer writing to the writer and recording the data written
+// as sent by the client side of the stream, or by its server side. If the
+// Stream is nil, the writer is returned.
+func (s *Stream) Tee(writer io.Writer, fromClient bool) io.Writer {
+	if s == nil {
+		return writer
+	}
+	return teeWriter{writer: writer, stream: s, fromClient: fromClient}
+}
+
+// Close writes the closing handshake of the streams, and closes the file.
+// The data recorded afterwards is ignored.
+func (f *File) Close() error {
+	if f == nil {
+		return nil
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return nil
+	}
+	now := time.Now()
+	for _, s := range f.streams {
+		s.close(now)
+	}
+	f.closed = true
+	if f.err == nil {
+		f.err = f.writer.Flush()
+	}
+	if err := f.file.Close(); f.err == nil {
+		f.err = err
+	}
+	return f.err
+}
@@ -0,0 +1,202 @@
+package capture
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the capture of the sessions.
+*/
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// testPacket is a packet read back from a capture file.
+type testPacket struct {
+	data    []byte
+	comment string
+}
+
+//------------------------------------------------------------------------------
+// Helpers
+//------------------------------------------------------------------------------
+
+// readPackets checks the blocks of the capture file and returns its packets.
+func readPackets(t *testing.T, path string) []testPacket {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal("Error reading capture:", err)
+	}
+	var packets []testPacket
+	var blockTypes []uint32
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatal("Error reading capture: truncated block")
+		}
+		blockType := binary.LittleEndian.Uint32(data)
+		length := binary.LittleEndian.Uint32(data[4:])
+		if length%4 != 0 || int(length) > len(data) || binary.LittleEndian.Uint32(data[length-4:]) != length {
+			t.Fatal("Error reading capture: invalid block length", length)
+		}
+		body := data[8 : length-4]
+		blockTypes = append(blockTypes, blockType)
+		if blockType == BLOCK_ENHANCED_PACKET {
+			capturedLength := binary.LittleEndian.Uint32(body[12:])
+			p := testPacket{data: body[20 : 20+capturedLength]}
+			options := body[20+capturedLength+uint32(pad(int(capturedLength))):]
+			if len(options) > 0 && binary.LittleEndian.Uint16(options) == OPTION_COMMENT {
+				p.comment = string(options[4 : 4+binary.LittleEndian.Uint16(options[2:])])
+			}
+			packets = append(packets, p)
+		}
+		data = data[length:]
+	}
+	if len(blockTypes) < 2 || blockTypes[0] != BLOCK_SECTION_HEADER || blockTypes[1] != BLOCK_INTERFACE {
+		t.Fatal("Error reading capture: missing header blocks", blockTypes)
+	}
+	return packets
+}
+
+// tcpSegment returns the TCP header and the payload of an IPv4 packet,
+// checking its checksums.
+func tcpSegment(t *testing.T, packet []byte) ([]byte, []byte) {
+	t.Helper()
+	if packet[0] != 0x45 || checksum(0, packet[:IPV4_HEADER_SIZE]) != 0 {
+		t.Fatal("Error reading packet: invalid IPv4 header")
+	}
+	tcp := packet[IPV4_HEADER_SIZE:]
+	var sum uint32
+	for i := 12; i < 20; i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(packet[i:]))
+	}
+	sum += IP_PROTOCOL_TCP + uint32(len(tcp))
+	if checksum(sum, tcp) != 0 {
+		t.Fatal("Error reading packet: invalid TCP checksum")
+	}
+	return tcp[:TCP_HEADER_SIZE], tcp[TCP_HEADER_SIZE:]
+}
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+// TestCaptureStream tests that a stream is captured with its handshakes and
+// its data in order, with consistent sequence numbers.
+func TestCaptureStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.pcapng")
+	file, err := Create(path)
+	if err != nil {
+		t.Fatal("Error creating capture:", err)
+	}
+	client := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000}
+	server := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 8545}
+	stream := file.NewStream(client, server, "client 10.0.0.1:40000")
+	var forwarded bytes.Buffer
+	stream.Tee(&forwarded, true).Write([]byte("request"))
+	stream.Writer(false).Write([]byte("response!"))
+	err = file.Close()
+	if err != nil {
+		t.Fatal("Error closing capture:", err)
+	}
+	stream.Record(true, []byte("ignored"))
+	if forwarded.String() != "request" {
+		t.Error("Error forwarding data:", forwarded.String())
+	}
+	packets := readPackets(t, path)
+	// handshake, two data segments, closing handshake
+	if len(packets) != 8 {
+		t.Fatal("Error capturing stream: expected 8 packets, got", len(packets))
+	}
+	if packets[0].comment != "client 10.0.0.1:40000" {
+		t.Error("Error capturing stream comment:", packets[0].comment)
+	}
+	expectedFlags := []byte{
+		TCP_FLAG_SYN, TCP_FLAG_SYN | TCP_FLAG_ACK, TCP_FLAG_ACK,
+		TCP_FLAG_PSH | TCP_FLAG_ACK, TCP_FLAG_PSH | TCP_FLAG_ACK,
+		TCP_FLAG_FIN | TCP_FLAG_ACK, TCP_FLAG_FIN | TCP_FLAG_ACK, TCP_FLAG_ACK,
+	}
+	for i, p := range packets {
+		header, _ := tcpSegment(t, p.data)
+		if header[13] != expectedFlags[i] {
+			t.Errorf("Error capturing packet %d: flags %#x, expected %#x", i, header[13], expectedFlags[i])
+		}
+	}
+	header, payload := tcpSegment(t, packets[3].data)
+	if string(payload) != "request" || binary.BigEndian.Uint16(header) != 40000 || binary.BigEndian.Uint32(header[4:]) != INITIAL_SEQUENCE {
+		t.Error("Error capturing client data:", string(payload))
+	}
+	header, payload = tcpSegment(t, packets[4].data)
+	if string(payload) != "response!" || binary.BigEndian.Uint16(header) != 8545 || binary.BigEndian.Uint32(header[8:]) != INITIAL_SEQUENCE+7 {
+		t.Error("Error capturing server data:", string(payload))
+	}
+	header, _ = tcpSegment(t, packets[5].data)
+	if binary.BigEndian.Uint32(header[4:]) != INITIAL_SEQUENCE+7 || binary.BigEndian.Uint32(header[8:]) != INITIAL_SEQUENCE+9 {
+		t.Error("Error capturing closing handshake sequence numbers")
+	}
+}
+
+// TestCaptureLargeData tests that data larger than a segment is split.
+func TestCaptureLargeData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.pcapng")
+	file, err := Create(path)
+	if err != nil {
+		t.Fatal("Error creating capture:", err)
+	}
+	client := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000}
+	server := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 8545}
+	data := strings.Repeat("x", MAX_SEGMENT_SIZE+1)
+	file.NewStream(client, server, "").Record(true, []byte(data))
+	file.Close()
+	packets := readPackets(t, path)
+	var captured []byte
+	for _, p := range packets[3:5] {
+		_, payload := tcpSegment(t, p.data)
+		captured = append(captured, payload...)
+	}
+	if string(captured) != data {
+		t.Error("Error capturing large data:", len(captured))
+	}
+}
+
+// TestCaptureIPv6 tests that the streams between IPv6 addresses are captured
+// in IPv6 packets.
+func TestCaptureIPv6(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.pcapng")
+	file, err := Create(path)
+	if err != nil {
+		t.Fatal("Error creating capture:", err)
+	}
+	client := &net.TCPAddr{IP: net.ParseIP("::1"), Port: 40000}
+	server := &net.TCPAddr{IP: net.ParseIP("::1"), Port: 8545}
+	file.NewStream(client, server, "").Record(true, []byte("request"))
+	file.Close()
+	packets := readPackets(t, path)
+	p := packets[3].data
+	if p[0]>>4 != 6 || binary.BigEndian.Uint16(p[4:]) != TCP_HEADER_SIZE+7 || string(p[IPV6_HEADER_SIZE+TCP_HEADER_SIZE:]) != "request" {
+		t.Error("Error capturing IPv6 packet:", p)
+	}
+}
+
+// TestNilCapture tests that a nil capture records nothing.
+func TestNilCapture(t *testing.T) {
+	var file *File
+	stream := file.NewStream(nil, nil, "")
+	var forwarded bytes.Buffer
+	writer := stream.Tee(&forwarded, true)
+	writer.Write([]byte("request"))
+	stream.Writer(false).Write([]byte("response"))
+	stream.Record(true, []byte("data"))
+	if forwarded.String() != "request" || file.Close() != nil {
+		t.Error("Error using nil capture")
+	}
+}
@@ -9,7 +9,11 @@ Description: This file contains the code to handle the proxy configuration.
 import (
 	"encoding/json"
 	"errors"
+	"semester-project/proxy/audit"
+	"semester-project/wire"
+	"strings"
 	"sync"
+	"time"
 )
 
 //------------------------------------------------------------------------------
@@ -17,23 +21,44 @@ import (
 //------------------------------------------------------------------------------
 
 // A Node is a destination node for the proxy.
-type Node struct {
-	Addr string `json:"addr"`
-}
+// It is defined by the wire schema shared with the controller.
+type Node = wire.Node
 
 // A Config is the configuration for the proxy.
-// It contains the list of destination nodes and the node to use for the
-// response.
-type Config struct {
-	Nodes            []Node `json:"nodes"`
-	ResponseNodeAddr string `json:"responseNodeAddr"`
+// It is defined by the wire schema shared with the controller.
+type Config = wire.Config
+
+// An Origin describes who applied a config.
+// It is defined by the wire schema shared with the controller.
+type Origin = wire.Origin
+
+// A ValidationError is returned when a config does not pass validation.
+// It wraps ErrInvalidConfig.
+type ValidationError struct {
+	Report wire.ValidationReport
 }
 
-// A ConfigManager manages the proxy configuration.
+// A ConfigManager manages the proxy configuration and the named presets.
 // It is thread-safe.
 type ConfigManager struct {
 	ConfigLock sync.Mutex
 	Config     Config
+	// Version is incremented each time the config is updated.
+	Version uint64
+	// Changes is the number of configs applied since the proxy started,
+	// whereas Version is restored from the persisted state.
+	Changes uint64
+	Presets map[string]Config
+	// History contains the last configs applied, oldest first.
+	History []wire.HistoryEntry
+	// statePath is the file the state is persisted to, if any.
+	statePath string
+	// prepared is the config prepared by a rollout, if any.
+	prepared *preparedConfig
+	// auditLog records the config changes, if set.
+	auditLog *audit.Log
+	// listeners are called with each config applied.
+	listeners []func(config Config)
 }
 
 //------------------------------------------------------------------------------
@@ -43,6 +68,61 @@ type ConfigManager struct {
 // ErrInvalidConfig is returned when the config is invalid.
 var ErrInvalidConfig = errors.New("invalid config")
 
+// ErrNoAuditLog is returned when the audit log is read but not enabled.
+var ErrNoAuditLog = errors.New("audit log not enabled")
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// HISTORY_SIZE is the number of configs kept in the history.
+const HISTORY_SIZE = 100
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// apply applies the valid config and returns its version.
+// It must be called with the lock held.
+func (cm *ConfigManager) apply(config Config, origin Origin) (uint64, error) {
+	now := time.Now()
+	auditEntry := wire.AuditEntry{
+		Time:            now,
+		Origin:          origin,
+		PreviousVersion: cm.Version,
+		Diff:            wire.DiffConfigs(cm.Config, config),
+	}
+	cm.Config = config
+	cm.Version++
+	cm.Changes++
+	cm.History = append(cm.History, wire.HistoryEntry{
+		ConfigVersion: cm.Version,
+		Time:          now,
+		Origin:        origin,
+		Config:        config,
+	})
+	if len(cm.History) > HISTORY_SIZE {
+		cm.History = cm.History[len(cm.History)-HISTORY_SIZE:]
+	}
+	cm.notify()
+	err := cm.saveState()
+	if cm.auditLog != nil {
+		auditEntry.ConfigVersion = cm.Version
+		if auditErr := cm.auditLog.Append(auditEntry); auditErr != nil && err == nil {
+			err = auditErr
+		}
+	}
+	return cm.Version, err
+}
+
+// notify calls the listeners with the config.
+// It must be called with the lock held.
+func (cm *ConfigManager) notify() {
+	for _, listener := range cm.listeners {
+		listener(cm.Config)
+	}
+}
+
 //------------------------------------------------------------------------------
 // Public methods
 //------------------------------------------------------------------------------
@@ -54,49 +134,105 @@ func NewConfigManager() *ConfigManager {
 			Nodes:            []Node{},
 			ResponseNodeAddr: "",
 		},
+		Presets: make(map[string]Config),
 	}
 }
 
-// IsValid checks if the config is valid.
-func (c *Config) IsValid() bool {
-	// check that the nodes array is set
-	if c.Nodes == nil {
-		return false
-	}
-	// check that if the response node is set, it is in the nodes array
-	if c.ResponseNodeAddr != "" {
-		for _, node := range c.Nodes {
-			if node.Addr == c.ResponseNodeAddr {
-				return true
-			}
-		}
-		return false
-	}
-	return true
-}
-
 // ParseConfig parses the config from a string.
+// If the config is invalid, the returned error is a *ValidationError.
 func (cm *ConfigManager) ParseConfig(configStr string) (Config, error) {
 	var config Config
 	err := json.Unmarshal([]byte(configStr), &config)
 	if err != nil {
 		return Config{}, err
 	}
-	if !config.IsValid() {
-		return Config{}, ErrInvalidConfig
+	if report := config.Validate(); !report.OK() {
+		return Config{}, &ValidationError{Report: report}
 	}
 	return config, nil
 }
 
-// GetConfig updates the config if it is valid.
+// SetConfig updates the config if it is valid.
+// If the config is invalid, the returned error is a *ValidationError.
+// The config is applied even if the state cannot be persisted.
 func (cm *ConfigManager) SetConfig(config Config) error {
-	if !config.IsValid() {
-		return ErrInvalidConfig
+	_, err := cm.UpdateConfig(config, Origin{})
+	return err
+}
+
+// UpdateConfig updates the config if it is valid and returns its version.
+// The origin is kept in the history and in the audit log.
+// If the config is invalid, the returned error is a *ValidationError.
+// The config is applied even if the state cannot be persisted or audited.
+func (cm *ConfigManager) UpdateConfig(config Config, origin Origin) (uint64, error) {
+	if report := config.Validate(); !report.OK() {
+		return 0, &ValidationError{Report: report}
 	}
 	cm.ConfigLock.Lock()
 	defer cm.ConfigLock.Unlock()
-	cm.Config = config
-	return nil
+	return cm.apply(config, origin)
+}
+
+// SetAuditLog records every subsequent config change in the audit log.
+func (cm *ConfigManager) SetAuditLog(auditLog *audit.Log) {
+	cm.ConfigLock.Lock()
+	defer cm.ConfigLock.Unlock()
+	cm.auditLog = auditLog
+}
+
+// GetAudit returns the last limit entries of the audit log, oldest first, or
+// all of them if limit is 0.
+func (cm *ConfigManager) GetAudit(limit int) ([]wire.AuditEntry, error) {
+	cm.ConfigLock.Lock()
+	auditLog := cm.auditLog
+	cm.ConfigLock.Unlock()
+	if auditLog == nil {
+		return nil, ErrNoAuditLog
+	}
+	return auditLog.Read(limit)
+}
+
+// OnChange calls the listener with the current config, then with each config
+// applied. The listener is called with the lock held, so it must return
+// quickly and must not call the ConfigManager.
+func (cm *ConfigManager) OnChange(listener func(config Config)) {
+	cm.ConfigLock.Lock()
+	defer cm.ConfigLock.Unlock()
+	cm.listeners = append(cm.listeners, listener)
+	listener(cm.Config)
+}
+
+// GetActiveConfig returns the config with its version.
+func (cm *ConfigManager) GetActiveConfig() wire.ActiveConfig {
+	cm.ConfigLock.Lock()
+	defer cm.ConfigLock.Unlock()
+	return wire.ActiveConfig{
+		ConfigVersion: cm.Version,
+		Config:        cm.Config,
+	}
+}
+
+// GetHistory returns a copy of the history, oldest first.
+func (cm *ConfigManager) GetHistory() []wire.HistoryEntry {
+	cm.ConfigLock.Lock()
+	defer cm.ConfigLock.Unlock()
+	history := make([]wire.HistoryEntry, len(cm.History))
+	copy(history, cm.History)
+	return history
+}
+
+// GetVersion returns the version of the config.
+func (cm *ConfigManager) GetVersion() uint64 {
+	cm.ConfigLock.Lock()
+	defer cm.ConfigLock.Unlock()
+	return cm.Version
+}
+
+// GetChanges returns the number of configs applied since the proxy started.
+func (cm *ConfigManager) GetChanges() uint64 {
+	cm.ConfigLock.Lock()
+	defer cm.ConfigLock.Unlock()
+	return cm.Changes
 }
 
 // GetConfig returns the config.
@@ -106,12 +242,16 @@ func (cm *ConfigManager) GetConfig() Config {
 	return cm.Config
 }
 
-func (c *Config) String() string {
-	str := "Config:\n"
-	str += "\tNodes:\n"
-	for _, node := range c.Nodes {
-		str += "\t\t" + node.Addr + "\n"
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Report.Errors))
+	for i, fieldErr := range e.Report.Errors {
+		messages[i] = fieldErr.String()
 	}
-	str += "\tUseResponseFrom: " + c.ResponseNodeAddr + "\n"
-	return str
+	return ErrInvalidConfig.Error() + ": " + strings.Join(messages, "; ")
+}
+
+// Unwrap returns ErrInvalidConfig so that errors.Is can be used on a
+// ValidationError.
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidConfig
 }
@@ -7,6 +7,9 @@ Description: This file contains the tests for the configuration of the proxy.
 */
 
 import (
+	"errors"
+	"path/filepath"
+	"semester-project/proxy/audit"
 	"testing"
 )
 
@@ -75,7 +78,7 @@ func TestInvalidParseConfig(t *testing.T) {
 	if err == nil {
 		t.Error("Error parsing invalid config: no error returned")
 	}
-	if err != ErrInvalidConfig {
+	if !errors.Is(err, ErrInvalidConfig) {
 		t.Error("Error parsing invalid config: wrong error returned")
 	}
 }
@@ -103,7 +106,7 @@ func TestInvalidSetConfig(t *testing.T) {
 	if err == nil {
 		t.Error("Error setting invalid config: no error returned")
 	}
-	if err != ErrInvalidConfig {
+	if !errors.Is(err, ErrInvalidConfig) {
 		t.Error("Error setting invalid config: wrong error returned")
 	}
 }
@@ -127,3 +130,219 @@ func TestGetConfig(t *testing.T) {
 		t.Error("Error getting config: wrong config returned")
 	}
 }
+
+func TestValidateReportsFieldErrors(t *testing.T) {
+	config := Config{
+		Nodes: []Node{
+			{Addr: "127.0.0.1:8001"},
+			{Addr: "127.0.0.1"},
+			{Addr: "127.0.0.1:8001"},
+		},
+		ResponseNodeAddr: "127.0.0.1:8003",
+	}
+	report := config.Validate()
+	if report.OK() {
+		t.Fatal("Error validating invalid config: no error reported")
+	}
+	fields := []string{"nodes[1].addr", "nodes[2].addr", "responseNodeAddr"}
+	if len(report.Errors) != len(fields) {
+		t.Fatalf("Error validating invalid config: expected %d errors, got %v", len(fields), report.Errors)
+	}
+	for i, field := range fields {
+		if report.Errors[i].Field != field {
+			t.Errorf("Error validating invalid config: expected error on %s, got %s", field, report.Errors[i])
+		}
+	}
+}
+
+func TestValidateReportsWarnings(t *testing.T) {
+	config := Config{
+		Nodes: []Node{
+			{Addr: "127.0.0.1:8001"},
+		},
+	}
+	report := config.Validate()
+	if !report.OK() {
+		t.Fatal("Error validating valid config:", report.Errors)
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0].Field != "responseNodeAddr" {
+		t.Error("Error validating config without response node: expected a warning, got", report.Warnings)
+	}
+}
+
+func TestParseConfigReturnsValidationError(t *testing.T) {
+	cm := NewConfigManager()
+	configStr := "{" +
+		"\"nodes\":[{\"addr\":\"127.0.0.1:8001\"}]," +
+		"\"responseNodeAddr\":\"127.0.0.1:8002\"" +
+		"}"
+	_, err := cm.ParseConfig(configStr)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatal("Error parsing invalid config: expected a validation error, got", err)
+	}
+	if len(validationErr.Report.Errors) != 1 || validationErr.Report.Errors[0].Field != "responseNodeAddr" {
+		t.Error("Error parsing invalid config: wrong errors reported:", validationErr.Report.Errors)
+	}
+}
+
+func TestPresets(t *testing.T) {
+	cm := NewConfigManager()
+	preset := Config{
+		Nodes:            []Node{{Addr: "127.0.0.1:8002"}},
+		ResponseNodeAddr: "127.0.0.1:8002",
+	}
+	err := cm.SavePreset("twin-only", preset)
+	if err != nil {
+		t.Fatal("Error saving preset:", err)
+	}
+	_, _, err = cm.ApplyPreset("twin-only", Origin{Source: "test"})
+	if err != nil {
+		t.Fatal("Error applying preset:", err)
+	}
+	if !compareConfig(cm.GetConfig(), preset) {
+		t.Error("Error applying preset: wrong config set")
+	}
+	err = cm.DeletePreset("twin-only")
+	if err != nil {
+		t.Fatal("Error deleting preset:", err)
+	}
+	_, _, err = cm.ApplyPreset("twin-only", Origin{Source: "test"})
+	if !errors.Is(err, ErrUnknownPreset) {
+		t.Error("Error applying deleted preset: expected ErrUnknownPreset, got", err)
+	}
+	err = cm.SavePreset("mirror honest", preset)
+	if !errors.Is(err, ErrInvalidPresetName) {
+		t.Error("Error saving preset with a space: expected ErrInvalidPresetName, got", err)
+	}
+}
+
+func TestStatePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	cm := NewConfigManager()
+	err := cm.LoadState(path)
+	if err != nil {
+		t.Fatal("Error loading missing state:", err)
+	}
+	config := Config{
+		Nodes:            []Node{{Addr: "127.0.0.1:8001"}},
+		ResponseNodeAddr: "127.0.0.1:8001",
+	}
+	err = cm.SetConfig(config)
+	if err != nil {
+		t.Fatal("Error setting config:", err)
+	}
+	err = cm.SavePreset("honest", config)
+	if err != nil {
+		t.Fatal("Error saving preset:", err)
+	}
+	restored := NewConfigManager()
+	err = restored.LoadState(path)
+	if err != nil {
+		t.Fatal("Error loading state:", err)
+	}
+	if !compareConfig(restored.GetConfig(), config) {
+		t.Error("Error loading state: wrong config restored")
+	}
+	if _, err := restored.GetPreset("honest"); err != nil {
+		t.Error("Error loading state: preset not restored:", err)
+	}
+	if restored.GetVersion() != cm.GetVersion() {
+		t.Error("Error loading state: wrong version restored")
+	}
+}
+
+func TestUpdateConfigIncrementsVersion(t *testing.T) {
+	cm := NewConfigManager()
+	config := Config{Nodes: []Node{{Addr: "127.0.0.1:8001"}}}
+	for expected := uint64(1); expected <= 2; expected++ {
+		version, err := cm.UpdateConfig(config, Origin{Source: "test"})
+		if err != nil {
+			t.Fatal("Error updating config:", err)
+		}
+		if version != expected || cm.GetVersion() != expected {
+			t.Errorf("Error updating config: expected version %d, got %d", expected, version)
+		}
+	}
+	_, err := cm.UpdateConfig(Config{}, Origin{Source: "test"})
+	if err == nil || cm.GetVersion() != 2 {
+		t.Error("Error updating invalid config: version changed")
+	}
+	history := cm.GetHistory()
+	if len(history) != 2 || history[1].ConfigVersion != 2 || history[1].Source != "test" {
+		t.Error("Error updating config: wrong history", history)
+	}
+}
+
+func TestRollout(t *testing.T) {
+	cm := NewConfigManager()
+	config := Config{Nodes: []Node{{Addr: "127.0.0.1:8001"}}, ResponseNodeAddr: "127.0.0.1:8001"}
+	err := cm.PrepareConfig("r1", config)
+	if err != nil {
+		t.Fatal("Error preparing config:", err)
+	}
+	if cm.GetVersion() != 0 {
+		t.Error("Error preparing config: config applied before commit")
+	}
+	if err := cm.PrepareConfig("r2", config); !errors.Is(err, ErrRolloutPending) {
+		t.Error("Error preparing concurrent rollout: expected ErrRolloutPending, got", err)
+	}
+	if _, err := cm.CommitConfig("r2", Origin{Source: "test"}); !errors.Is(err, ErrUnknownRollout) {
+		t.Error("Error committing unknown rollout: expected ErrUnknownRollout, got", err)
+	}
+	version, err := cm.CommitConfig("r1", Origin{Source: "test"})
+	if err != nil || version != 1 || !compareConfig(cm.GetConfig(), config) {
+		t.Fatal("Error committing config:", err)
+	}
+	// a committed rollout can be neither committed again nor aborted
+	if _, err := cm.CommitConfig("r1", Origin{Source: "test"}); !errors.Is(err, ErrUnknownRollout) {
+		t.Error("Error committing rollout twice: expected ErrUnknownRollout, got", err)
+	}
+	// an aborted rollout is not applied and frees the way for the next one
+	if err := cm.PrepareConfig("r2", Config{Nodes: []Node{}}); err != nil {
+		t.Fatal("Error preparing config:", err)
+	}
+	if err := cm.AbortConfig("r2"); err != nil {
+		t.Fatal("Error aborting rollout:", err)
+	}
+	if err := cm.PrepareConfig("r3", config); err != nil {
+		t.Error("Error preparing config after abort:", err)
+	}
+	if cm.GetVersion() != 1 {
+		t.Error("Error aborting rollout: config applied")
+	}
+	// invalid configs are rejected when prepared
+	var validationErr *ValidationError
+	if err := cm.PrepareConfig("r3", Config{}); !errors.As(err, &validationErr) {
+		t.Error("Error preparing invalid config: expected a ValidationError, got", err)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	cm := NewConfigManager()
+	if _, err := cm.GetAudit(0); !errors.Is(err, ErrNoAuditLog) {
+		t.Error("Error reading disabled audit log: expected ErrNoAuditLog, got", err)
+	}
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal("Error opening audit log:", err)
+	}
+	defer auditLog.Close()
+	cm.SetAuditLog(auditLog)
+	config := Config{Nodes: []Node{{Addr: "127.0.0.1:8001"}}, ResponseNodeAddr: "127.0.0.1:8001"}
+	_, err = cm.UpdateConfig(config, Origin{Source: "controller 127.0.0.1:4000", Identity: "team-a"})
+	if err != nil {
+		t.Fatal("Error updating config:", err)
+	}
+	entries, err := cm.GetAudit(0)
+	if err != nil || len(entries) != 1 {
+		t.Fatal("Error reading audit log: expected 1 entry, got", len(entries), err)
+	}
+	entry := entries[0]
+	if entry.Identity != "team-a" || entry.PreviousVersion != 0 || entry.ConfigVersion != 1 {
+		t.Error("Error reading audit log: wrong entry", entry)
+	}
+	if len(entry.Diff.AddedNodes) != 1 || entry.Diff.ResponseNode == nil || entry.Diff.ResponseNode.To != "127.0.0.1:8001" {
+		t.Error("Error reading audit log: wrong diff", entry.Diff)
+	}
+}
@@ -0,0 +1,104 @@
+package configuration
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to handle the named configuration
+presets of the proxy.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+//------------------------------------------------------------------------------
+// Errors
+//------------------------------------------------------------------------------
+
+// ErrUnknownPreset is returned when a preset does not exist.
+var ErrUnknownPreset = errors.New("unknown preset")
+
+// ErrInvalidPresetName is returned when a preset name is empty or contains
+// spaces.
+var ErrInvalidPresetName = errors.New("invalid preset name")
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// checkPresetName checks that the preset name is not empty and contains no
+// space.
+func checkPresetName(name string) error {
+	if name == "" || strings.IndexFunc(name, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("%w: %q", ErrInvalidPresetName, name)
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// SavePreset saves the config under the given name, replacing any existing
+// preset with the same name.
+// If the config is invalid, the returned error is a *ValidationError.
+func (cm *ConfigManager) SavePreset(name string, config Config) error {
+	if err := checkPresetName(name); err != nil {
+		return err
+	}
+	if report := config.Validate(); !report.OK() {
+		return &ValidationError{Report: report}
+	}
+	cm.ConfigLock.Lock()
+	defer cm.ConfigLock.Unlock()
+	cm.Presets[name] = config
+	return cm.saveState()
+}
+
+// GetPreset returns the preset with the given name.
+func (cm *ConfigManager) GetPreset(name string) (Config, error) {
+	cm.ConfigLock.Lock()
+	defer cm.ConfigLock.Unlock()
+	config, ok := cm.Presets[name]
+	if !ok {
+		return Config{}, fmt.Errorf("%w: %s", ErrUnknownPreset, name)
+	}
+	return config, nil
+}
+
+// ApplyPreset sets the config to the preset with the given name and returns
+// it with its version. The origin describes who applied the preset.
+func (cm *ConfigManager) ApplyPreset(name string, origin Origin) (Config, uint64, error) {
+	config, err := cm.GetPreset(name)
+	if err != nil {
+		return Config{}, 0, err
+	}
+	origin.Source += " (preset " + name + ")"
+	version, err := cm.UpdateConfig(config, origin)
+	return config, version, err
+}
+
+// DeletePreset deletes the preset with the given name.
+func (cm *ConfigManager) DeletePreset(name string) error {
+	cm.ConfigLock.Lock()
+	defer cm.ConfigLock.Unlock()
+	if _, ok := cm.Presets[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownPreset, name)
+	}
+	delete(cm.Presets, name)
+	return cm.saveState()
+}
+
+// GetPresets returns a copy of the presets.
+func (cm *ConfigManager) GetPresets() map[string]Config {
+	cm.ConfigLock.Lock()
+	defer cm.ConfigLock.Unlock()
+	presets := make(map[string]Config, len(cm.Presets))
+	for name, config := range cm.Presets {
+		presets[name] = config
+	}
+	return presets
+}
@@ -0,0 +1,110 @@
+package configuration
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to apply a config in two phases, so
+that a rollout across several proxies can be committed or aborted as a whole.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// preparedConfig is a config prepared by a rollout, waiting to be committed.
+type preparedConfig struct {
+	rolloutID string
+	config    Config
+	expiry    time.Time
+}
+
+//------------------------------------------------------------------------------
+// Errors
+//------------------------------------------------------------------------------
+
+// ErrRolloutPending is returned when a config is prepared while another
+// rollout is pending.
+var ErrRolloutPending = errors.New("another rollout is pending")
+
+// ErrUnknownRollout is returned when a rollout is not prepared, or expired.
+var ErrUnknownRollout = errors.New("unknown rollout")
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// PREPARE_TIMEOUT is the time after which a prepared config is dropped if it
+// was neither committed nor aborted.
+const PREPARE_TIMEOUT = 30 * time.Second
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// pending returns the prepared config if it has not expired.
+// It must be called with the lock held.
+func (cm *ConfigManager) pending() *preparedConfig {
+	if cm.prepared != nil && time.Now().After(cm.prepared.expiry) {
+		cm.prepared = nil
+	}
+	return cm.prepared
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// PrepareConfig validates the config and keeps it until the rollout with the
+// given ID is committed or aborted. Only one rollout can be pending at a time.
+// If the config is invalid, the returned error is a *ValidationError.
+func (cm *ConfigManager) PrepareConfig(rolloutID string, config Config) error {
+	if rolloutID == "" {
+		return fmt.Errorf("%w: missing rollout ID", ErrUnknownRollout)
+	}
+	if report := config.Validate(); !report.OK() {
+		return &ValidationError{Report: report}
+	}
+	cm.ConfigLock.Lock()
+	defer cm.ConfigLock.Unlock()
+	if pending := cm.pending(); pending != nil && pending.rolloutID != rolloutID {
+		return fmt.Errorf("%w: %s", ErrRolloutPending, pending.rolloutID)
+	}
+	cm.prepared = &preparedConfig{
+		rolloutID: rolloutID,
+		config:    config,
+		expiry:    time.Now().Add(PREPARE_TIMEOUT),
+	}
+	return nil
+}
+
+// CommitConfig applies the config prepared by the rollout with the given ID
+// and returns its version. The origin describes who applied the config.
+func (cm *ConfigManager) CommitConfig(rolloutID string, origin Origin) (uint64, error) {
+	cm.ConfigLock.Lock()
+	defer cm.ConfigLock.Unlock()
+	pending := cm.pending()
+	if pending == nil || pending.rolloutID != rolloutID {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownRollout, rolloutID)
+	}
+	cm.prepared = nil
+	origin.Source += " (rollout " + rolloutID + ")"
+	return cm.apply(pending.config, origin)
+}
+
+// AbortConfig drops the config prepared by the rollout with the given ID.
+func (cm *ConfigManager) AbortConfig(rolloutID string) error {
+	cm.ConfigLock.Lock()
+	defer cm.ConfigLock.Unlock()
+	pending := cm.pending()
+	if pending == nil || pending.rolloutID != rolloutID {
+		return fmt.Errorf("%w: %s", ErrUnknownRollout, rolloutID)
+	}
+	cm.prepared = nil
+	return nil
+}
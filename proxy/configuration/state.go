@@ -0,0 +1,98 @@
+package configuration
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to persist the state of the proxy, i.e.
+the active config and the named presets.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A State is the persisted state of the proxy.
+type State struct {
+	Config  Config            `json:"config"`
+	Version uint64            `json:"version"`
+	Presets map[string]Config `json:"presets"`
+}
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// saveState persists the state to the state file, if any.
+// It must be called with the lock held.
+func (cm *ConfigManager) saveState() error {
+	if cm.statePath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(State{
+		Config:  cm.Config,
+		Version: cm.Version,
+		Presets: cm.Presets,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so that a crash never leaves a
+	// truncated state behind
+	tmp, err := os.CreateTemp(filepath.Dir(cm.statePath), filepath.Base(cm.statePath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cm.statePath)
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// LoadState restores the state from the given file and persists every
+// subsequent change to it. A missing file is not an error: it is created on
+// the first change.
+func (cm *ConfigManager) LoadState(path string) error {
+	cm.ConfigLock.Lock()
+	defer cm.ConfigLock.Unlock()
+	cm.statePath = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state State
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return err
+	}
+	if report := state.Config.Validate(); !report.OK() {
+		return &ValidationError{Report: report}
+	}
+	cm.Config = state.Config
+	cm.Version = state.Version
+	if state.Presets != nil {
+		cm.Presets = state.Presets
+	}
+	cm.notify()
+	return nil
+}
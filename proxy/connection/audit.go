@@ -0,0 +1,39 @@
+package connection
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to handle the audit messages.
+*/
+
+import (
+	"semester-project/wire"
+)
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// handleAudit handles an audit message.
+func handleAudit(req controlRequest) wire.Reply {
+	var query wire.AuditQuery
+	if len(req.message.Payload) > 0 {
+		err := req.message.DecodePayload(&query)
+		if err != nil {
+			req.logger.Error("Error parsing audit message", "error", err)
+			return errorReply("malformed audit message: " + err.Error())
+		}
+	}
+	entries, err := req.configManager.GetAudit(query.Limit)
+	if err != nil {
+		req.logger.Error("Error reading audit log", "error", err)
+		return errorReply(err.Error())
+	}
+	reply := wire.NewReply(req.configManager.GetVersion(), wire.ValidationReport{})
+	err = reply.SetPayload(entries)
+	if err != nil {
+		req.logger.Error("Error encoding audit entries", "error", err)
+		return errorReply("error encoding audit entries: " + err.Error())
+	}
+	return reply
+}
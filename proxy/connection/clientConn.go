@@ -7,59 +7,264 @@ Description: This file contains the code to handle client connections.
 */
 
 import (
+	"fmt"
 	"io"
 	"net"
+	"path/filepath"
+	"semester-project/proxy/capture"
 	"semester-project/proxy/configuration"
 	"semester-project/proxy/logs"
+	"semester-project/proxy/metrics"
+	"semester-project/proxy/record"
+	"semester-project/proxy/sessions"
+	"semester-project/wire"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// DIAL_TIMEOUT is the maximum time to connect to a node.
+const DIAL_TIMEOUT = 5 * time.Second
+
+// DRAIN_TIMEOUT is the time the responses of the nodes not forwarded to the
+// client are still captured and recorded after the end of a session.
+const DRAIN_TIMEOUT = 500 * time.Millisecond
+
 //------------------------------------------------------------------------------
 // Private variables
 //------------------------------------------------------------------------------
 
-// loggers is the logger used by the client connection handler.
-var clientLoggers *logs.Loggers
+// clientLogger is the logger used by the client connection handler.
+var clientLogger *logs.Logger
+
+// clientSessionCount is the number of client sessions opened, used to number
+// them when they are not registered.
+var clientSessionCount uint64
+
+// clientObserver returns the writer the data sent by a client is passed to,
+// one per session, if set.
+var clientObserver func() io.Writer
+
+// clientRegistry is the registry of the client sessions, if set.
+var clientRegistry *sessions.Registry
+
+// clientMetrics records the metrics of the client sessions, if set.
+var clientMetrics *metrics.Metrics
+
+// captureDir is the directory the captures of the client sessions are
+// written to, if set.
+var captureDir string
+
+// clientRecorder records the HTTP exchanges of the client sessions, if set.
+var clientRecorder *record.Recorder
+
+// captureWarning warns once that the config captures sessions without a
+// capture directory.
+var captureWarning sync.Once
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// countingWriter is a writer counting the bytes written to the underlying
+// writer in the registry and the metrics, and publishing them as an event.
+type countingWriter struct {
+	writer io.Writer
+	event  wire.Event
+}
+
+// An exchange pairs the data sent by a client, its request, with the data
+// then sent by the response node, its response, to measure the latency.
+type exchange struct {
+	lock sync.Mutex
+	// request is the time of the first data of the client not answered yet,
+	// or zero.
+	request time.Time
+}
+
+// requestWriter is a writer marking the start of a request of the exchange.
+type requestWriter struct {
+	exchange *exchange
+}
+
+// responseWriter is a writer recording the responses of the node in the
+// metrics before writing them to the underlying writer.
+type responseWriter struct {
+	writer   io.Writer
+	exchange *exchange
+	nodeAddr string
+}
 
 //------------------------------------------------------------------------------
 // Private methods
 //------------------------------------------------------------------------------
 
+// Write writes the data to the underlying writer and counts the number of
+// bytes written.
+func (w countingWriter) Write(data []byte) (int, error) {
+	n, err := w.writer.Write(data)
+	if n > 0 {
+		if clientRegistry != nil {
+			clientRegistry.AddBytes(w.event.SessionID, w.event.Direction, n)
+		}
+		clientMetrics.AddBytes(w.event.NodeAddr, w.event.Direction, n)
+		event := w.event
+		event.Bytes = n
+		eventBus.Publish(event)
+	}
+	return n, err
+}
+
+// Write marks the start of a request, unless a request is not answered yet.
+func (w requestWriter) Write(data []byte) (int, error) {
+	w.exchange.lock.Lock()
+	defer w.exchange.lock.Unlock()
+	if w.exchange.request.IsZero() {
+		w.exchange.request = time.Now()
+	}
+	return len(data), nil
+}
+
+// Write records a response if a request is not answered yet, and writes the
+// data to the underlying writer.
+func (w responseWriter) Write(data []byte) (int, error) {
+	w.exchange.lock.Lock()
+	if !w.exchange.request.IsZero() {
+		clientMetrics.ResponseServed(w.nodeAddr, time.Since(w.exchange.request))
+		w.exchange.request = time.Time{}
+	}
+	w.exchange.lock.Unlock()
+	return w.writer.Write(data)
+}
+
 // proxyClientToNodes copies data from the client connection to all nodes.
-func proxyClientToNodes(closeChannel chan bool, dst []io.Writer, src io.Reader) {
+func proxyClientToNodes(logger *logs.Logger, closeChannel chan bool, dst []io.Writer, src io.Reader) {
+	// let the observer see the data sent by the client
+	if clientObserver != nil {
+		src = io.TeeReader(src, clientObserver())
+	}
 	// copy data from client to all destination nodes
 	_, err := io.Copy(io.MultiWriter(dst...), src)
 	if err != nil && !strings.Contains(err.Error(), "use of closed network connection") {
-		clientLoggers.Error.Println("Error transmitting data from client to nodes:", err)
+		logger.Error("Error transmitting data from client to nodes", "error", err)
 	}
 	closeChannel <- true
 }
 
 // proxyNodeToClient copies data from the node connection to the client.
-func proxyNodeToClient(closeChannel chan bool, dst io.Writer, src io.Reader) {
+func proxyNodeToClient(logger *logs.Logger, closeChannel chan bool, dst io.Writer, src io.Reader) {
 	// copy data from Node to client
 	_, err := io.Copy(dst, src)
 	if err != nil && !strings.Contains(err.Error(), "use of closed network connection") {
-		clientLoggers.Warning.Println("Error transmitting data from node to client:", err)
+		logger.Warning("Error transmitting data from node to client", "error", err)
 	}
 	closeChannel <- true
 }
 
+// createCapture creates the capture file of the session if the config
+// captures the client, or returns nil.
+func createCapture(logger *logs.Logger, config configuration.Config, id uint64, clientAddr string) *capture.File {
+	if !config.Capture.CapturesClient(clientAddr) {
+		return nil
+	}
+	if captureDir == "" {
+		captureWarning.Do(func() {
+			logger.Warning("The config captures the sessions but no capture directory is set")
+		})
+		return nil
+	}
+	name := fmt.Sprintf("session-%d-%s.pcapng", id, time.Now().UTC().Format(capture.FILE_TIME_FORMAT))
+	path := filepath.Join(captureDir, name)
+	file, err := capture.Create(path)
+	if err != nil {
+		logger.Error("Error creating the capture of the session", "file", path, "error", err)
+		return nil
+	}
+	logger.Info("Capturing the session", "file", path)
+	return file
+}
+
+// drainNode copies the data sent by a node whose responses are not
+// forwarded to the capture and the recording, until its connection is closed.
+func drainNode(wg *sync.WaitGroup, dst io.Writer, src io.Reader) {
+	defer wg.Done()
+	io.Copy(dst, src)
+}
+
 //------------------------------------------------------------------------------
 // Public methods
 //------------------------------------------------------------------------------
 
-// InitClientLoggers initializes the loggers for the client connection handler.
-func InitClientLoggers(loggers *logs.Loggers) {
-	clientLoggers = loggers
+// InitClientLogger initializes the logger for the client connection handler.
+func InitClientLogger(logger *logs.Logger) {
+	clientLogger = logger
+}
+
+// InitClientObserver sets the function returning the writer the data sent by
+// a client is passed to, called once per session.
+func InitClientObserver(observer func() io.Writer) {
+	clientObserver = observer
+}
+
+// InitClientRegistry sets the registry the client sessions are registered in.
+func InitClientRegistry(registry *sessions.Registry) {
+	clientRegistry = registry
+}
+
+// InitClientMetrics sets the metrics the client sessions are recorded in.
+func InitClientMetrics(m *metrics.Metrics) {
+	clientMetrics = m
+}
+
+// InitCaptureDir sets the directory the captures of the client sessions are
+// written to, when the config captures them.
+func InitCaptureDir(dir string) {
+	captureDir = dir
+}
+
+// InitClientRecorder sets the recorder the HTTP exchanges of the client
+// sessions are recorded in.
+func InitClientRecorder(recorder *record.Recorder) {
+	clientRecorder = recorder
 }
 
-// HandleClientConnection handles a client connection.
-func HandleClientConnection(conn net.Conn, config configuration.Config) {
+// HandleClientConnection handles a client connection with the given config.
+// Every line logged for the session carries its ID.
+func HandleClientConnection(conn net.Conn, config configuration.Config, configVersion uint64) {
 	defer conn.Close()
+	// register the session
+	var id uint64
+	if clientRegistry != nil {
+		id = clientRegistry.Add(conn.RemoteAddr().String(), config, configVersion, conn)
+		defer clientRegistry.Remove(id)
+	} else {
+		id = atomic.AddUint64(&clientSessionCount, 1)
+	}
+	clientAddr := conn.RemoteAddr().String()
+	logger := clientLogger.With("session", id, "client", clientAddr)
+	logger.Info("Connection opened", "version", configVersion)
+	defer logger.Info("Connection closed")
+	clientMetrics.SessionOpened()
+	defer clientMetrics.SessionClosed()
+	eventBus.Publish(wire.Event{
+		Kind:          wire.EventClientConnected,
+		SessionID:     id,
+		ClientAddr:    clientAddr,
+		ConfigVersion: configVersion,
+	})
+	defer eventBus.Publish(wire.Event{
+		Kind:       wire.EventSessionClosed,
+		SessionID:  id,
+		ClientAddr: clientAddr,
+	})
 	// check if the configuration is valid
 	if !config.IsValid() {
-		clientLoggers.Error.Println("Invalid configuration")
+		logger.Error("Invalid configuration", "version", configVersion)
 		return
 	}
 	// connect to nodes if any
@@ -68,37 +273,115 @@ func HandleClientConnection(conn net.Conn, config configuration.Config) {
 	if len(config.Nodes) > 0 {
 		nodeConns = make([]net.Conn, len(config.Nodes))
 		for i, node := range config.Nodes {
-			NodeConn, err := net.Dial("tcp", node.Addr)
+			NodeConn, err := net.DialTimeout("tcp", node.Addr, DIAL_TIMEOUT)
 			if err != nil {
-				clientLoggers.Error.Println("Error connecting to", node.Addr, ":", err)
+				logger.Error("Error connecting to node", "node", node.Addr, "error", err)
+				clientMetrics.DialFailed(node.Addr, err)
 				return
 			}
 			defer NodeConn.Close()
+			logger.Debug("Node dialed", "node", node.Addr)
+			eventBus.Publish(wire.Event{
+				Kind:       wire.EventNodeDialed,
+				SessionID:  id,
+				ClientAddr: clientAddr,
+				NodeAddr:   node.Addr,
+			})
 			nodeConns[i] = NodeConn
 			if node.Addr == config.ResponseNodeAddr {
 				responseNodeConn = NodeConn
 			}
 		}
 	}
+	// capture the client stream and the node streams if needed, the
+	// streams of a nil capture file are nil and record nothing
+	captureFile := createCapture(logger, config, id, clientAddr)
+	defer captureFile.Close()
+	clientStream := captureFile.NewStream(conn.RemoteAddr(), conn.LocalAddr(), "client "+clientAddr)
+	nodeStreams := make([]*capture.Stream, len(nodeConns))
+	// record the HTTP exchanges if needed, a nil recording records nothing
+	nodeAddrs := make([]string, len(nodeConns))
+	for i := range nodeConns {
+		nodeAddrs[i] = config.Nodes[i].Addr
+	}
+	recording := clientRecorder.NewSession(logger, id, clientAddr, configVersion, nodeAddrs, config.ResponseNodeAddr)
+	defer recording.Close()
+	var drained []net.Conn
+	var drains sync.WaitGroup
+	for i, NodeConn := range nodeConns {
+		comment := "node " + config.Nodes[i].Addr
+		if NodeConn == responseNodeConn {
+			comment += " (response node)"
+		}
+		nodeStreams[i] = captureFile.NewStream(NodeConn.LocalAddr(), NodeConn.RemoteAddr(), comment)
+		if (captureFile != nil || recording != nil) && NodeConn != responseNodeConn {
+			drained = append(drained, NodeConn)
+			drains.Add(1)
+			go drainNode(&drains, io.MultiWriter(nodeStreams[i].Writer(false), recording.Responses(i)), NodeConn)
+		}
+	}
 	// start goroutines to handle data transmission in both directions
 	closeChannel := make(chan bool)
 	// if there are nodes, start the goroutine
 	if len(config.Nodes) > 0 {
-		writers := make([]io.Writer, len(nodeConns))
+		// the requests are marked before being forwarded, to measure the
+		// latency of the responses
+		requests := &exchange{}
+		writers := []io.Writer{requestWriter{exchange: requests}, clientStream.Writer(true), recording.Requests()}
 		for i, NodeConn := range nodeConns {
-			writers[i] = NodeConn
+			writers = append(writers, countingWriter{
+				writer: nodeStreams[i].Tee(NodeConn, true),
+				event: wire.Event{
+					Kind:       wire.EventBytesForwarded,
+					SessionID:  id,
+					ClientAddr: clientAddr,
+					NodeAddr:   config.Nodes[i].Addr,
+					Direction:  wire.DirectionToNode,
+				},
+			})
 		}
-		go proxyClientToNodes(closeChannel, writers, conn)
+		go proxyClientToNodes(logger, closeChannel, writers, conn)
 		// if there is a response node, start the goroutine
 		if config.ResponseNodeAddr != "" {
-			go proxyNodeToClient(closeChannel, conn, responseNodeConn)
+			eventBus.Publish(wire.Event{
+				Kind:       wire.EventResponseNode,
+				SessionID:  id,
+				ClientAddr: clientAddr,
+				NodeAddr:   config.ResponseNodeAddr,
+			})
+			clientWriter := countingWriter{
+				writer: clientStream.Tee(conn, false),
+				event: wire.Event{
+					Kind:       wire.EventBytesForwarded,
+					SessionID:  id,
+					ClientAddr: clientAddr,
+					NodeAddr:   config.ResponseNodeAddr,
+					Direction:  wire.DirectionToClient,
+				},
+			}
+			logger.Debug("Forwarding the responses of the node", "node", config.ResponseNodeAddr)
+			responses := responseWriter{
+				writer:   clientWriter,
+				exchange: requests,
+				nodeAddr: config.ResponseNodeAddr,
+			}
+			for i, NodeConn := range nodeConns {
+				if NodeConn == responseNodeConn {
+					responses.writer = recording.TeeResponses(i, nodeStreams[i].Tee(responses.writer, false))
+				}
+			}
+			go proxyNodeToClient(logger, closeChannel, responses, responseNodeConn)
 		}
 	} else {
 		// if there are no nodes, just close the connection
-		clientLoggers.Info.Println("No nodes, closing connection")
+		logger.Info("No nodes, closing connection")
 		return
 	}
 	// wait for the goroutines to finish
 	<-closeChannel
-	clientLoggers.Info.Println("Connection of", conn.RemoteAddr(), "closed")
+	// let the captured and recorded nodes finish their responses
+	for _, NodeConn := range drained {
+		NodeConn.SetReadDeadline(time.Now().Add(DRAIN_TIMEOUT))
+	}
+	drains.Wait()
 }
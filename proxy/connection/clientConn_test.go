@@ -0,0 +1,235 @@
+package connection
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the client connection handler,
+forwarding a session to the nodes while capturing and recording it.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"semester-project/proxy/configuration"
+	"semester-project/proxy/logs"
+	"semester-project/proxy/record"
+	"semester-project/wire"
+	"strings"
+	"testing"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+const (
+	REQUEST_BODY          = `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`
+	RESPONSE_BODY         = `{"jsonrpc":"2.0","id":1,"result":"0x2a"}`
+	RESPONSE_BODY_DIVERGE = `{"jsonrpc":"2.0","id":1,"result":"0x2b"}`
+	// LARGE_RESPONSE_SIZE is larger than the socket buffers of a loopback
+	// connection, so that it is only sent if the node is read.
+	LARGE_RESPONSE_SIZE = 16 << 20
+)
+
+//------------------------------------------------------------------------------
+// Helpers
+//------------------------------------------------------------------------------
+
+// httpResponse returns an HTTP response with the given body.
+func httpResponse(body string) string {
+	return fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// startNode starts a node accepting a single connection. It answers the
+// first request with respond, and keeps the connection open until the proxy
+// closes it.
+func startNode(t *testing.T, respond func(conn net.Conn)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening:", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		request, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, request.Body)
+		respond(conn)
+		io.Copy(io.Discard, reader)
+	}()
+	return listener.Addr().String()
+}
+
+// openSession opens a client session handled with the given config. The
+// returned channel is closed once the handler returns.
+func openSession(t *testing.T, config configuration.Config) (net.Conn, <-chan struct{}) {
+	t.Helper()
+	if clientLogger == nil {
+		_, logger, err := logs.GetLoggers(logs.Options{Path: os.DevNull})
+		if err != nil {
+			t.Fatal("Error getting loggers:", err)
+		}
+		InitClientLogger(logger)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening:", err)
+	}
+	defer listener.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		HandleClientConnection(conn, config, 1)
+	}()
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to the proxy:", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, done
+}
+
+// sendRequest sends a request on the session and returns the body of the
+// response.
+func sendRequest(t *testing.T, client net.Conn) string {
+	t.Helper()
+	request := fmt.Sprintf("POST / HTTP/1.1\r\nHost: proxy\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(REQUEST_BODY), REQUEST_BODY)
+	_, err := client.Write([]byte(request))
+	if err != nil {
+		t.Fatal("Error sending request:", err)
+	}
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, err := http.ReadResponse(bufio.NewReader(client), nil)
+	if err != nil {
+		t.Fatal("Error reading response:", err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal("Error reading response body:", err)
+	}
+	return string(body)
+}
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+// TestClientSessionCaptured tests that a captured and recorded session
+// forwards the response of the response node, records the exchange with the
+// responses of both nodes and captures both directions of the session.
+func TestClientSessionCaptured(t *testing.T) {
+	dir := t.TempDir()
+	recordPath := filepath.Join(dir, "exchanges.jsonl")
+	recorder, err := record.Open(recordPath)
+	if err != nil {
+		t.Fatal("Error opening recorder:", err)
+	}
+	InitCaptureDir(dir)
+	InitClientRecorder(recorder)
+	t.Cleanup(func() {
+		InitCaptureDir("")
+		InitClientRecorder(nil)
+		recorder.Close()
+	})
+	responseNode := startNode(t, func(conn net.Conn) {
+		conn.Write([]byte(httpResponse(RESPONSE_BODY)))
+	})
+	otherNode := startNode(t, func(conn net.Conn) {
+		conn.Write([]byte(httpResponse(RESPONSE_BODY_DIVERGE)))
+	})
+	client, done := openSession(t, configuration.Config{
+		Nodes:            []wire.Node{{Addr: responseNode}, {Addr: otherNode}},
+		ResponseNodeAddr: responseNode,
+		Capture:          &wire.Capture{},
+	})
+	if body := sendRequest(t, client); body != RESPONSE_BODY {
+		t.Error("Error forwarding the response: got", body)
+	}
+	client.Close()
+	<-done
+	// the exchange is recorded with the responses of both nodes
+	data, err := os.ReadFile(recordPath)
+	if err != nil {
+		t.Fatal("Error reading record file:", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatal("Error recording the session: expected 1 exchange, got", len(lines))
+	}
+	var exchange record.Exchange
+	err = json.Unmarshal([]byte(lines[0]), &exchange)
+	if err != nil {
+		t.Fatal("Error decoding exchange:", err)
+	}
+	if len(exchange.Responses) != 2 || !exchange.Divergent || exchange.ReturnedNodeAddr != responseNode {
+		t.Errorf("Error recording the session: got %+v", exchange)
+	}
+	for _, response := range exchange.Responses {
+		if response.Error != "" || len(response.Body) == 0 {
+			t.Errorf("Error recording the response of %s: got %+v", response.NodeAddr, response)
+		}
+	}
+	// the capture holds the request and the responses of both nodes
+	captures, _ := filepath.Glob(filepath.Join(dir, "session-*.pcapng"))
+	if len(captures) != 1 {
+		t.Fatal("Error capturing the session: expected 1 capture, got", captures)
+	}
+	capture, err := os.ReadFile(captures[0])
+	if err != nil {
+		t.Fatal("Error reading capture:", err)
+	}
+	for _, payload := range []string{REQUEST_BODY, RESPONSE_BODY, RESPONSE_BODY_DIVERGE} {
+		if !bytes.Contains(capture, []byte(payload)) {
+			t.Error("Error capturing the session: missing", payload)
+		}
+	}
+}
+
+// TestClientSessionNotDrained tests that the nodes whose responses are not
+// forwarded are not read when the session is neither captured nor recorded.
+func TestClientSessionNotDrained(t *testing.T) {
+	responseNode := startNode(t, func(conn net.Conn) {
+		conn.Write([]byte(httpResponse(RESPONSE_BODY)))
+	})
+	written := make(chan error, 1)
+	otherNode := startNode(t, func(conn net.Conn) {
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		_, err := conn.Write(make([]byte, LARGE_RESPONSE_SIZE))
+		written <- err
+	})
+	client, done := openSession(t, configuration.Config{
+		Nodes:            []wire.Node{{Addr: responseNode}, {Addr: otherNode}},
+		ResponseNodeAddr: responseNode,
+	})
+	if body := sendRequest(t, client); body != RESPONSE_BODY {
+		t.Error("Error forwarding the response: got", body)
+	}
+	// the session is still open, so the write can only time out
+	if err := <-written; !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Error("Error sending the response of the other node: expected a timeout, got", err)
+	}
+	client.Close()
+	<-done
+}
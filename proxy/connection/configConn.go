@@ -7,55 +7,352 @@ Description: This file contains the code to handle configuration updates.
 */
 
 import (
+	"bufio"
+	"errors"
+	"io"
 	"net"
+	"semester-project/proxy/auth"
 	"semester-project/proxy/configuration"
+	"semester-project/proxy/events"
 	"semester-project/proxy/logs"
+	"semester-project/wire"
+	"sync"
+	"sync/atomic"
 )
 
 //------------------------------------------------------------------------------
 // Private variables
 //------------------------------------------------------------------------------
 
-// loggers is the logger used by the configuration connection handler.
-var configLoggers *logs.Loggers
+// configLogger is the logger used by the configuration connection handler.
+var configLogger *logs.Logger
+
+// configSessionCount is the number of configuration sessions opened, used to
+// number them.
+var configSessionCount uint64
+
+// configVerifier authenticates the messages, if set. Unsigned messages are
+// then rejected.
+var configVerifier *auth.Verifier
+
+// eventBus is the bus the events of the proxy are published on, if set.
+var eventBus *events.Bus
 
 //------------------------------------------------------------------------------
-// Constants
+// Types
 //------------------------------------------------------------------------------
 
-// BUFFER_SIZE is the size of the buffer used to read data.
-const BUFFER_SIZE = 1024
+// A controlRequest is a message to handle, with its context.
+type controlRequest struct {
+	message       wire.Message
+	origin        configuration.Origin
+	configManager *configuration.ConfigManager
+	// logger logs the handling of the message, with the session it was
+	// received on.
+	logger *logs.Logger
+}
+
+// A replyWriter sends the replies of a session. It is thread-safe, so that
+// events can be streamed while the other messages are handled.
+type replyWriter struct {
+	conn   net.Conn
+	lock   sync.Mutex
+	logger *logs.Logger
+}
 
 //------------------------------------------------------------------------------
-// Public methods
+// Private methods
 //------------------------------------------------------------------------------
 
-// InitConfigLoggers initializes the loggers for the configuration connection handler.
-func InitConfigLoggers(loggers *logs.Loggers) {
-	configLoggers = loggers
+// send sends the reply back to the controller.
+func (w *replyWriter) send(reply wire.Reply) error {
+	data, err := wire.EncodeReply(reply)
+	if err != nil {
+		w.logger.Error("Error encoding reply", "error", err)
+		return err
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	err = wire.WriteFrame(w.conn, data)
+	if err != nil {
+		w.logger.Error("Error sending reply", "error", err)
+	}
+	return err
 }
 
-// HandleConfigConnection handles a configuration connection.
-func HandleConfigConnection(conn net.Conn, configManager *configuration.ConfigManager) {
-	defer conn.Close()
-	// read data
-	data := make([]byte, BUFFER_SIZE)
-	n, err := conn.Read(data)
-	if err != nil {
-		configLoggers.Error.Println("Error reading data:", err)
+// streamEvents sends the events to the controller as replies to the watch
+// message with the given ID, until the subscription ends or the controller
+// can no longer be reached.
+func streamEvents(writer *replyWriter, id string, subscription <-chan wire.Event, unsubscribe func()) {
+	defer unsubscribe()
+	for event := range subscription {
+		reply := wire.NewReply(0, wire.ValidationReport{})
+		reply.ID = id
+		err := reply.SetPayload(event)
+		if err != nil {
+			writer.logger.Error("Error encoding event", "error", err)
+			continue
+		}
+		if writer.send(reply) != nil {
+			return
+		}
+	}
+}
+
+// publishConfigEvent publishes whether the message changing the config was
+// applied or rejected.
+func publishConfigEvent(req controlRequest, reply wire.Reply) {
+	switch req.message.Type {
+	case wire.TypeSetConfig, wire.TypeApplyPreset, wire.TypePrepareConfig, wire.TypeCommitConfig:
+	default:
+		return
+	}
+	if reply.Succeeded() && req.message.Type == wire.TypePrepareConfig {
+		// the config is only applied once committed
+		return
+	}
+	if reply.Succeeded() {
+		eventBus.Publish(wire.Event{
+			Kind:          wire.EventConfigApplied,
+			ConfigVersion: reply.ConfigVersion,
+			Source:        req.origin.Source,
+		})
 		return
 	}
+	eventBus.Publish(wire.Event{
+		Kind:   wire.EventConfigRejected,
+		Source: req.origin.Source,
+		Errors: reply.Errors,
+	})
+}
+
+// errorReply rejects a message for the given reason.
+func errorReply(message string) wire.Reply {
+	return wire.NewRejection(wire.ValidationReport{
+		Errors: []wire.FieldError{{Message: message}},
+	})
+}
+
+// logReport logs the errors and warnings of the validation report.
+func logReport(logger *logs.Logger, report wire.ValidationReport) {
+	for _, fieldErr := range report.Errors {
+		logger.Error("Invalid configuration", "error", fieldErr)
+	}
+	for _, warning := range report.Warnings {
+		logger.Warning("Configuration warning", "warning", warning)
+	}
+}
+
+// handleGetConfig handles a get-config message.
+func handleGetConfig(req controlRequest) wire.Reply {
+	active := req.configManager.GetActiveConfig()
+	reply := wire.NewReply(active.ConfigVersion, wire.ValidationReport{})
+	err := reply.SetPayload(active)
+	if err != nil {
+		req.logger.Error("Error encoding configuration", "error", err)
+		return errorReply("error encoding configuration: " + err.Error())
+	}
+	return reply
+}
+
+// handleDiffConfig handles a diff-config message.
+func handleDiffConfig(req controlRequest) wire.Reply {
+	config, err := req.configManager.ParseConfig(string(req.message.Payload))
+	var validationErr *configuration.ValidationError
+	if errors.As(err, &validationErr) {
+		return wire.NewRejection(validationErr.Report)
+	}
+	if err != nil {
+		return errorReply("malformed configuration: " + err.Error())
+	}
+	active := req.configManager.GetActiveConfig()
+	reply := wire.NewReply(active.ConfigVersion, config.Validate())
+	err = reply.SetPayload(wire.DiffConfigs(active.Config, config))
+	if err != nil {
+		req.logger.Error("Error encoding diff", "error", err)
+		return errorReply("error encoding diff: " + err.Error())
+	}
+	return reply
+}
+
+// handleSetConfig handles a set-config message.
+func handleSetConfig(req controlRequest) wire.Reply {
 	// parse configuration
-	config, err := configManager.ParseConfig(string(data[:n]))
+	config, err := req.configManager.ParseConfig(string(req.message.Payload))
+	var validationErr *configuration.ValidationError
+	if errors.As(err, &validationErr) {
+		logReport(req.logger, validationErr.Report)
+		return wire.NewRejection(validationErr.Report)
+	}
 	if err != nil {
-		configLoggers.Error.Println("Error parsing configuration:", err)
-		return
+		req.logger.Error("Error parsing configuration", "error", err)
+		return errorReply("malformed configuration: " + err.Error())
 	}
 	// set configuration
-	err = configManager.SetConfig(config)
+	version, err := req.configManager.UpdateConfig(config, req.origin)
 	if err != nil {
-		configLoggers.Error.Println("Error setting configuration:", err)
-		return
+		req.logger.Error("Error setting configuration", "error", err)
+		return errorReply("error setting configuration: " + err.Error())
+	}
+	report := config.Validate()
+	logReport(req.logger, report)
+	req.logger.Info("Configuration updated", "version", version)
+	return wire.NewReply(version, report)
+}
+
+// handleControlRequest handles a message and returns the reply to send back.
+func handleControlRequest(req controlRequest) wire.Reply {
+	message := req.message
+	req.logger.Debug("Message received", "type", message.Type)
+	var reply wire.Reply
+	switch message.Type {
+	case wire.TypeSetConfig:
+		reply = handleSetConfig(req)
+	case wire.TypeGetConfig:
+		reply = handleGetConfig(req)
+	case wire.TypeDiffConfig:
+		reply = handleDiffConfig(req)
+	case wire.TypeSavePreset:
+		reply = handleSavePreset(req)
+	case wire.TypeApplyPreset:
+		reply = handleApplyPreset(req)
+	case wire.TypeDeletePreset:
+		reply = handleDeletePreset(req)
+	case wire.TypeListPresets:
+		reply = handleListPresets(req)
+	case wire.TypeListSessions:
+		reply = handleListSessions(req)
+	case wire.TypeKillSession:
+		reply = handleKillSession(req)
+	case wire.TypePrepareConfig:
+		reply = handlePrepareConfig(req)
+	case wire.TypeCommitConfig:
+		reply = handleCommitConfig(req)
+	case wire.TypeAbortConfig:
+		reply = handleAbortConfig(req)
+	case wire.TypeAudit:
+		reply = handleAudit(req)
+	case wire.TypeWatch:
+		reply = errorReply("watch is only supported on the configuration port")
+	default:
+		req.logger.Error("Unknown message type", "type", message.Type)
+		reply = errorReply(wire.ErrUnknownType.Error() + ": " + message.Type)
+	}
+	reply.ID = message.ID
+	publishConfigEvent(req, reply)
+	return reply
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// InitConfigLogger initializes the logger for the configuration connection
+// handler.
+func InitConfigLogger(logger *logs.Logger) {
+	configLogger = logger
+}
+
+// InitConfigVerifier requires every message to be signed with a key known by
+// the verifier.
+func InitConfigVerifier(verifier *auth.Verifier) {
+	configVerifier = verifier
+}
+
+// InitEventBus sets the bus the events of the proxy are published on, and
+// the watch messages subscribe to.
+func InitEventBus(bus *events.Bus) {
+	eventBus = bus
+}
+
+// HandleControlMessage handles a message and returns the reply to send back.
+// The origin describes who sent the message, e.g. the address of the
+// controller and its authenticated identity.
+func HandleControlMessage(message wire.Message, origin configuration.Origin, configManager *configuration.ConfigManager) wire.Reply {
+	return handleControlRequest(controlRequest{
+		message:       message,
+		origin:        origin,
+		configManager: configManager,
+		logger:        configLogger.With("source", origin.Source, "message", message.ID),
+	})
+}
+
+// HandleConfigConnection handles a configuration connection.
+// A connection is a session: it may carry any number of messages, which are
+// handled one at a time, in the order they are received. A message is only
+// read once the previous one is answered, so the replies come back in the
+// order of the messages, and a slow message delays the ones sent after it on
+// the same session. Each reply also carries the ID of the message it answers.
+// The events of watch subscriptions are the only frames sent in between. The
+// session ends when the controller closes its side of the connection, which
+// also ends its watch subscriptions.
+// Every line logged for the session carries its ID. Messages larger than
+// maxConfigSize bytes are rejected.
+func HandleConfigConnection(conn net.Conn, configManager *configuration.ConfigManager, maxConfigSize int) {
+	defer conn.Close()
+	logger := configLogger.With("session", atomic.AddUint64(&configSessionCount, 1), "controller", conn.RemoteAddr())
+	logger.Info("Session opened")
+	writer := &replyWriter{conn: conn, logger: logger}
+	reader := bufio.NewReader(conn)
+	for {
+		// read the message frame
+		data, err := wire.ReadFrame(reader, maxConfigSize)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, wire.ErrFrameTooLarge) {
+			logger.Error("Error reading message", "error", err)
+			writer.send(errorReply(err.Error()))
+			continue
+		}
+		if err != nil {
+			logger.Error("Error reading message", "error", err)
+			return
+		}
+		// decode message
+		message, err := wire.DecodeMessage(data)
+		if err != nil {
+			logger.Error("Error decoding message", "error", err)
+			writer.send(errorReply("malformed message: " + err.Error()))
+			continue
+		}
+		// authenticate message
+		origin := configuration.Origin{Source: "controller " + conn.RemoteAddr().String()}
+		if configVerifier != nil {
+			identity, err := configVerifier.Verify(message)
+			if err != nil {
+				logger.Error("Error authenticating message", "message", message.ID, "error", err)
+				reply := errorReply("unauthenticated message: " + err.Error())
+				reply.ID = message.ID
+				writer.send(reply)
+				continue
+			}
+			origin.Identity = identity
+		}
+		// subscribe to the events
+		if message.Type == wire.TypeWatch {
+			if eventBus == nil {
+				reply := errorReply("events are not enabled on this proxy")
+				reply.ID = message.ID
+				writer.send(reply)
+				continue
+			}
+			subscription, unsubscribe := eventBus.Subscribe()
+			defer unsubscribe()
+			reply := wire.NewReply(configManager.GetVersion(), wire.ValidationReport{})
+			reply.ID = message.ID
+			writer.send(reply)
+			logger.Info("Subscribed to the events", "message", message.ID)
+			go streamEvents(writer, message.ID, subscription, unsubscribe)
+			continue
+		}
+		// handle message
+		writer.send(handleControlRequest(controlRequest{
+			message:       message,
+			origin:        origin,
+			configManager: configManager,
+			logger:        logger.With("message", message.ID),
+		}))
 	}
-	configLoggers.Info.Println("Configuration updated")
+	logger.Info("Session closed")
 }
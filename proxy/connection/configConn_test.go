@@ -0,0 +1,299 @@
+package connection
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the contract tests between the controller and
+the configuration connection handler.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"semester-project/proxy/auth"
+	"semester-project/proxy/configuration"
+	"semester-project/proxy/events"
+	"semester-project/proxy/logs"
+	"semester-project/wire"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Helpers
+//------------------------------------------------------------------------------
+
+// fixturesDir is the directory containing the wire contract fixtures.
+const fixturesDir = "../../wire/testdata/"
+
+// sendMessage sends the message to a configuration connection handler and
+// returns the reply.
+func sendMessage(t *testing.T, configManager *configuration.ConfigManager, message []byte) wire.Reply {
+	t.Helper()
+	return sendMessageWithMaxSize(t, configManager, message, wire.DEFAULT_MAX_FRAME_SIZE)
+}
+
+// sendMessageWithMaxSize sends the message to a configuration connection
+// handler accepting messages of at most maxConfigSize bytes, and returns the
+// reply.
+func sendMessageWithMaxSize(t *testing.T, configManager *configuration.ConfigManager, message []byte, maxConfigSize int) wire.Reply {
+	t.Helper()
+	if configLogger == nil {
+		_, logger, err := logs.GetLoggers(logs.Options{Path: os.DevNull})
+		if err != nil {
+			t.Fatal("Error getting loggers:", err)
+		}
+		InitConfigLogger(logger)
+	}
+	controllerConn, proxyConn := net.Pipe()
+	defer controllerConn.Close()
+	go HandleConfigConnection(proxyConn, configManager, maxConfigSize)
+	go wire.WriteFrame(controllerConn, message)
+	data, err := wire.ReadFrame(bufio.NewReader(controllerConn), wire.DEFAULT_MAX_FRAME_SIZE)
+	if err != nil {
+		t.Fatal("Error reading reply:", err)
+	}
+	reply, err := wire.DecodeReply(data)
+	if err != nil {
+		t.Fatal("Error decoding reply:", err)
+	}
+	return reply
+}
+
+// readFixture reads a wire contract fixture.
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(fixturesDir + name)
+	if err != nil {
+		t.Fatal("Error reading fixture:", err)
+	}
+	return bytes.TrimSpace(data)
+}
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestHandleFixtures(t *testing.T) {
+	for _, name := range []string{"v1-set-config.json", "v2-set-config.json"} {
+		configManager := configuration.NewConfigManager()
+		reply := sendMessage(t, configManager, readFixture(t, name))
+		if !reply.Succeeded() {
+			t.Errorf("Error handling %s: %v", name, reply.Errors)
+		}
+		if reply.ConfigVersion != 1 {
+			t.Errorf("Error handling %s: expected config version 1, got %d", name, reply.ConfigVersion)
+		}
+		config := configManager.GetConfig()
+		if len(config.Nodes) != 2 || config.ResponseNodeAddr != "127.0.0.1:8001" {
+			t.Errorf("Error handling %s: wrong config set: %v", name, config.String())
+		}
+	}
+}
+
+func TestHandleInvalidConfig(t *testing.T) {
+	configManager := configuration.NewConfigManager()
+	message := []byte(`{"version":2,"type":"set-config","payload":{"nodes":[],"responseNodeAddr":"127.0.0.1:8001"}}`)
+	reply := sendMessage(t, configManager, message)
+	if reply.Succeeded() || reply.OK() {
+		t.Error("Error handling invalid config: no error reported")
+	}
+	if config := configManager.GetConfig(); len(config.Nodes) != 0 {
+		t.Error("Error handling invalid config: config was updated")
+	}
+}
+
+func TestHandleUnknownType(t *testing.T) {
+	configManager := configuration.NewConfigManager()
+	reply := sendMessage(t, configManager, []byte(`{"version":2,"type":"unknown"}`))
+	if reply.Succeeded() {
+		t.Error("Error handling unknown message: no error reported")
+	}
+}
+
+func TestHandleLargeConfig(t *testing.T) {
+	configManager := configuration.NewConfigManager()
+	config := wire.Config{Nodes: []wire.Node{}}
+	for port := 8001; port <= 8200; port++ {
+		config.Nodes = append(config.Nodes, wire.Node{Addr: "127.0.0.1:" + strconv.Itoa(port)})
+	}
+	config.ResponseNodeAddr = config.Nodes[0].Addr
+	message, err := wire.NewMessage(wire.TypeSetConfig, config)
+	if err != nil {
+		t.Fatal("Error creating message:", err)
+	}
+	data, err := wire.EncodeMessage(message)
+	if err != nil {
+		t.Fatal("Error encoding message:", err)
+	}
+	reply := sendMessage(t, configManager, data)
+	if !reply.Succeeded() {
+		t.Fatal("Error handling large config:", reply.Errors)
+	}
+	if len(configManager.GetConfig().Nodes) != len(config.Nodes) {
+		t.Error("Error handling large config: wrong number of nodes set")
+	}
+	// the same config is rejected once the maximum size is lowered
+	reply = sendMessageWithMaxSize(t, configuration.NewConfigManager(), data, len(data)-1)
+	if reply.Succeeded() || !strings.Contains(reply.Errors[0].Message, wire.ErrFrameTooLarge.Error()) {
+		t.Error("Error handling oversized config: expected a frame too large error, got", reply.Errors)
+	}
+}
+
+func TestSessionReplies(t *testing.T) {
+	if configLogger == nil {
+		_, logger, _ := logs.GetLoggers(logs.Options{Path: os.DevNull})
+		InitConfigLogger(logger)
+	}
+	configManager := configuration.NewConfigManager()
+	controllerConn, proxyConn := net.Pipe()
+	defer controllerConn.Close()
+	go HandleConfigConnection(proxyConn, configManager, wire.DEFAULT_MAX_FRAME_SIZE)
+	// send several messages on the same connection without waiting
+	fixture := readFixture(t, "v2-set-config.json")
+	ids := []string{"a", "b", "c"}
+	go func() {
+		for _, id := range ids {
+			message, _ := wire.DecodeMessage(fixture)
+			message.ID = id
+			data, _ := wire.EncodeMessage(message)
+			wire.WriteFrame(controllerConn, data)
+		}
+	}()
+	reader := bufio.NewReader(controllerConn)
+	for i, id := range ids {
+		data, err := wire.ReadFrame(reader, wire.DEFAULT_MAX_FRAME_SIZE)
+		if err != nil {
+			t.Fatal("Error reading reply:", err)
+		}
+		reply, err := wire.DecodeReply(data)
+		if err != nil {
+			t.Fatal("Error decoding reply:", err)
+		}
+		if reply.ID != id || reply.ConfigVersion != uint64(i+1) {
+			t.Errorf("Error handling session: got reply %s for version %d, want %s for version %d", reply.ID, reply.ConfigVersion, id, i+1)
+		}
+	}
+}
+
+func TestAuthenticatedMessages(t *testing.T) {
+	key := []byte("secret")
+	InitConfigVerifier(auth.NewVerifier(map[string][]byte{"team-a": key}, time.Minute))
+	defer InitConfigVerifier(nil)
+	configManager := configuration.NewConfigManager()
+	// unsigned messages are rejected
+	fixture := readFixture(t, "v2-set-config.json")
+	reply := sendMessage(t, configManager, fixture)
+	if reply.Succeeded() || configManager.GetVersion() != 0 {
+		t.Error("Error handling unsigned message: expected a rejection")
+	}
+	// signed messages are accepted
+	message, err := wire.DecodeMessage(fixture)
+	if err != nil {
+		t.Fatal("Error decoding fixture:", err)
+	}
+	err = message.Sign("team-a", key)
+	if err != nil {
+		t.Fatal("Error signing message:", err)
+	}
+	data, err := wire.EncodeMessage(message)
+	if err != nil {
+		t.Fatal("Error encoding message:", err)
+	}
+	reply = sendMessage(t, configManager, data)
+	if !reply.Succeeded() || configManager.GetVersion() != 1 {
+		t.Error("Error handling signed message:", reply.Errors)
+	}
+	// replayed messages are rejected
+	reply = sendMessage(t, configManager, data)
+	if reply.Succeeded() || configManager.GetVersion() != 1 {
+		t.Error("Error handling replayed message: expected a rejection")
+	}
+}
+
+func TestWatchEvents(t *testing.T) {
+	if configLogger == nil {
+		_, logger, _ := logs.GetLoggers(logs.Options{Path: os.DevNull})
+		InitConfigLogger(logger)
+	}
+	InitEventBus(events.NewBus())
+	defer InitEventBus(nil)
+	configManager := configuration.NewConfigManager()
+	controllerConn, proxyConn := net.Pipe()
+	defer controllerConn.Close()
+	go HandleConfigConnection(proxyConn, configManager, wire.DEFAULT_MAX_FRAME_SIZE)
+	reader := bufio.NewReader(controllerConn)
+	readReply := func() wire.Reply {
+		data, err := wire.ReadFrame(reader, wire.DEFAULT_MAX_FRAME_SIZE)
+		if err != nil {
+			t.Fatal("Error reading reply:", err)
+		}
+		reply, err := wire.DecodeReply(data)
+		if err != nil {
+			t.Fatal("Error decoding reply:", err)
+		}
+		return reply
+	}
+	// subscribe to the events
+	watch, _ := wire.NewMessage(wire.TypeWatch, nil)
+	watch.ID = "watch"
+	data, _ := wire.EncodeMessage(watch)
+	go wire.WriteFrame(controllerConn, data)
+	if reply := readReply(); reply.ID != "watch" || !reply.Succeeded() {
+		t.Fatal("Error subscribing to events:", reply.Errors)
+	}
+	// apply a config on the same session
+	message, _ := wire.DecodeMessage(readFixture(t, "v2-set-config.json"))
+	message.ID = "set"
+	data, _ = wire.EncodeMessage(message)
+	go wire.WriteFrame(controllerConn, data)
+	// both the reply and the event are received, in any order
+	var gotReply, gotEvent bool
+	for i := 0; i < 2; i++ {
+		reply := readReply()
+		switch reply.ID {
+		case "set":
+			gotReply = reply.Succeeded()
+		case "watch":
+			var event wire.Event
+			err := reply.DecodePayload(&event)
+			if err != nil {
+				t.Fatal("Error decoding event:", err)
+			}
+			gotEvent = event.Kind == wire.EventConfigApplied && event.ConfigVersion == 1
+		}
+	}
+	if !gotReply || !gotEvent {
+		t.Errorf("Error watching events: got reply %t, got event %t", gotReply, gotEvent)
+	}
+}
+
+func TestDiffConfigDoesNotApply(t *testing.T) {
+	configManager := configuration.NewConfigManager()
+	config := wire.Config{
+		Nodes:            []wire.Node{{Addr: "127.0.0.1:8001"}},
+		ResponseNodeAddr: "127.0.0.1:8001",
+	}
+	message, _ := wire.NewMessage(wire.TypeDiffConfig, config)
+	data, _ := wire.EncodeMessage(message)
+	reply := sendMessage(t, configManager, data)
+	if !reply.Succeeded() || configManager.GetVersion() != 0 {
+		t.Fatal("Error diffing config: expected a success without change, got", reply.Errors)
+	}
+	var diff wire.ConfigDiff
+	err := reply.DecodePayload(&diff)
+	if err != nil || len(diff.AddedNodes) != 1 || diff.ResponseNode == nil {
+		t.Error("Error diffing config: wrong diff", diff, err)
+	}
+	// invalid configs are rejected like by set-config
+	config.ResponseNodeAddr = "127.0.0.1:8002"
+	message, _ = wire.NewMessage(wire.TypeDiffConfig, config)
+	data, _ = wire.EncodeMessage(message)
+	if reply := sendMessage(t, configManager, data); reply.Succeeded() {
+		t.Error("Error diffing invalid config: expected a rejection")
+	}
+}
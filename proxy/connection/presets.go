@@ -0,0 +1,96 @@
+package connection
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to handle the configuration preset
+messages.
+*/
+
+import (
+	"errors"
+	"semester-project/proxy/configuration"
+	"semester-project/wire"
+)
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// decodePresetPayload decodes the payload of a preset message.
+func decodePresetPayload(req controlRequest) (wire.PresetPayload, error) {
+	var payload wire.PresetPayload
+	err := req.message.DecodePayload(&payload)
+	if err != nil {
+		req.logger.Error("Error parsing preset message", "error", err)
+		return wire.PresetPayload{}, errors.New("malformed preset message: " + err.Error())
+	}
+	return payload, nil
+}
+
+// handleSavePreset handles a save-preset message.
+func handleSavePreset(req controlRequest) wire.Reply {
+	payload, err := decodePresetPayload(req)
+	if err != nil {
+		return errorReply(err.Error())
+	}
+	config := req.configManager.GetConfig()
+	if payload.Config != nil {
+		config = *payload.Config
+	}
+	err = req.configManager.SavePreset(payload.Name, config)
+	var validationErr *configuration.ValidationError
+	if errors.As(err, &validationErr) {
+		logReport(req.logger, validationErr.Report)
+		return wire.NewRejection(validationErr.Report)
+	}
+	if err != nil {
+		req.logger.Error("Error saving preset", "preset", payload.Name, "error", err)
+		return errorReply(err.Error())
+	}
+	req.logger.Info("Preset saved", "preset", payload.Name)
+	return wire.NewReply(req.configManager.GetVersion(), config.Validate())
+}
+
+// handleApplyPreset handles an apply-preset message.
+func handleApplyPreset(req controlRequest) wire.Reply {
+	payload, err := decodePresetPayload(req)
+	if err != nil {
+		return errorReply(err.Error())
+	}
+	config, version, err := req.configManager.ApplyPreset(payload.Name, req.origin)
+	if err != nil {
+		req.logger.Error("Error applying preset", "preset", payload.Name, "error", err)
+		return errorReply(err.Error())
+	}
+	report := config.Validate()
+	logReport(req.logger, report)
+	req.logger.Info("Configuration updated", "version", version, "preset", payload.Name)
+	return wire.NewReply(version, report)
+}
+
+// handleDeletePreset handles a delete-preset message.
+func handleDeletePreset(req controlRequest) wire.Reply {
+	payload, err := decodePresetPayload(req)
+	if err != nil {
+		return errorReply(err.Error())
+	}
+	err = req.configManager.DeletePreset(payload.Name)
+	if err != nil {
+		req.logger.Error("Error deleting preset", "preset", payload.Name, "error", err)
+		return errorReply(err.Error())
+	}
+	req.logger.Info("Preset deleted", "preset", payload.Name)
+	return wire.NewReply(req.configManager.GetVersion(), wire.ValidationReport{})
+}
+
+// handleListPresets handles a list-presets message.
+func handleListPresets(req controlRequest) wire.Reply {
+	reply := wire.NewReply(req.configManager.GetVersion(), wire.ValidationReport{})
+	err := reply.SetPayload(req.configManager.GetPresets())
+	if err != nil {
+		req.logger.Error("Error encoding presets", "error", err)
+		return errorReply("error encoding presets: " + err.Error())
+	}
+	return reply
+}
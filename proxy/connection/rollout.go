@@ -0,0 +1,82 @@
+package connection
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to handle the messages of a two-phase
+config rollout.
+*/
+
+import (
+	"errors"
+	"semester-project/proxy/configuration"
+	"semester-project/wire"
+)
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// decodeRolloutPayload decodes the payload of a rollout message.
+func decodeRolloutPayload(req controlRequest) (wire.RolloutPayload, error) {
+	var payload wire.RolloutPayload
+	err := req.message.DecodePayload(&payload)
+	if err != nil {
+		req.logger.Error("Error parsing rollout message", "error", err)
+		return wire.RolloutPayload{}, errors.New("malformed rollout message: " + err.Error())
+	}
+	return payload, nil
+}
+
+// handlePrepareConfig handles a prepare-config message.
+func handlePrepareConfig(req controlRequest) wire.Reply {
+	payload, err := decodeRolloutPayload(req)
+	if err != nil {
+		return errorReply(err.Error())
+	}
+	if payload.Config == nil {
+		return errorReply("malformed rollout message: missing config")
+	}
+	err = req.configManager.PrepareConfig(payload.ID, *payload.Config)
+	var validationErr *configuration.ValidationError
+	if errors.As(err, &validationErr) {
+		logReport(req.logger, validationErr.Report)
+		return wire.NewRejection(validationErr.Report)
+	}
+	if err != nil {
+		req.logger.Error("Error preparing rollout", "rollout", payload.ID, "error", err)
+		return errorReply(err.Error())
+	}
+	req.logger.Info("Rollout prepared", "rollout", payload.ID, "source", req.origin.Source)
+	return wire.NewReply(req.configManager.GetVersion(), payload.Config.Validate())
+}
+
+// handleCommitConfig handles a commit-config message.
+func handleCommitConfig(req controlRequest) wire.Reply {
+	payload, err := decodeRolloutPayload(req)
+	if err != nil {
+		return errorReply(err.Error())
+	}
+	version, err := req.configManager.CommitConfig(payload.ID, req.origin)
+	if err != nil {
+		req.logger.Error("Error committing rollout", "rollout", payload.ID, "error", err)
+		return errorReply(err.Error())
+	}
+	req.logger.Info("Configuration updated", "version", version, "rollout", payload.ID)
+	return wire.NewReply(version, wire.ValidationReport{})
+}
+
+// handleAbortConfig handles an abort-config message.
+func handleAbortConfig(req controlRequest) wire.Reply {
+	payload, err := decodeRolloutPayload(req)
+	if err != nil {
+		return errorReply(err.Error())
+	}
+	err = req.configManager.AbortConfig(payload.ID)
+	if err != nil {
+		req.logger.Error("Error aborting rollout", "rollout", payload.ID, "error", err)
+		return errorReply(err.Error())
+	}
+	req.logger.Info("Rollout aborted", "rollout", payload.ID, "source", req.origin.Source)
+	return wire.NewReply(req.configManager.GetVersion(), wire.ValidationReport{})
+}
@@ -0,0 +1,51 @@
+package connection
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to handle the messages about the
+client sessions.
+*/
+
+import (
+	"semester-project/wire"
+)
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// handleListSessions handles a list-sessions message.
+func handleListSessions(req controlRequest) wire.Reply {
+	sessions := []wire.ClientSession{}
+	if clientRegistry != nil {
+		sessions = clientRegistry.List()
+	}
+	reply := wire.NewReply(req.configManager.GetVersion(), wire.ValidationReport{})
+	err := reply.SetPayload(sessions)
+	if err != nil {
+		req.logger.Error("Error encoding sessions", "error", err)
+		return errorReply("error encoding sessions: " + err.Error())
+	}
+	return reply
+}
+
+// handleKillSession handles a kill-session message.
+func handleKillSession(req controlRequest) wire.Reply {
+	var payload wire.SessionPayload
+	err := req.message.DecodePayload(&payload)
+	if err != nil {
+		req.logger.Error("Error parsing session message", "error", err)
+		return errorReply("malformed session message: " + err.Error())
+	}
+	if clientRegistry == nil {
+		return errorReply("sessions are not tracked by this proxy")
+	}
+	err = clientRegistry.Kill(payload.ID)
+	if err != nil {
+		req.logger.Error("Error killing session", "killedSession", payload.ID, "error", err)
+		return errorReply(err.Error())
+	}
+	req.logger.Info("Client session killed", "killedSession", payload.ID, "source", req.origin.Source)
+	return wire.NewReply(req.configManager.GetVersion(), wire.ValidationReport{})
+}
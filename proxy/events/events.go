@@ -0,0 +1,85 @@
+package events
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the bus on which the proxy publishes its events
+to the subscribers.
+*/
+
+import (
+	"semester-project/wire"
+	"sync"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// BUFFER_SIZE is the number of events buffered for each subscriber.
+const BUFFER_SIZE = 256
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A Bus passes the published events to all its subscribers. A subscriber that
+// does not keep up misses events rather than slowing down the proxy.
+// It is thread-safe. A nil Bus drops all the events.
+type Bus struct {
+	lock        sync.Mutex
+	nextID      uint64
+	subscribers map[uint64]chan wire.Event
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// NewBus creates and returns a new Bus.
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[uint64]chan wire.Event),
+	}
+}
+
+// Publish passes the event to the subscribers. The time of the event is set
+// if it is not.
+func (b *Bus) Publish(event wire.Event) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, subscriber := range b.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			// the subscriber is too slow, drop the event
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the events published from now on, and
+// a function to call to unsubscribe, which closes the channel.
+func (b *Bus) Subscribe() (<-chan wire.Event, func()) {
+	subscriber := make(chan wire.Event, BUFFER_SIZE)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.nextID++
+	id := b.nextID
+	b.subscribers[id] = subscriber
+	var once sync.Once
+	return subscriber, func() {
+		once.Do(func() {
+			b.lock.Lock()
+			defer b.lock.Unlock()
+			delete(b.subscribers, id)
+			close(subscriber)
+		})
+	}
+}
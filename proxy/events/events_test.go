@@ -0,0 +1,54 @@
+package events
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the event bus.
+*/
+
+import (
+	"semester-project/wire"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	first, unsubscribeFirst := bus.Subscribe()
+	second, unsubscribeSecond := bus.Subscribe()
+	defer unsubscribeSecond()
+	bus.Publish(wire.Event{Kind: wire.EventClientConnected})
+	for _, subscriber := range []<-chan wire.Event{first, second} {
+		event := <-subscriber
+		if event.Kind != wire.EventClientConnected || event.Time.IsZero() {
+			t.Error("Error receiving event: got", event)
+		}
+	}
+	// unsubscribed channels are closed and receive no more events
+	unsubscribeFirst()
+	bus.Publish(wire.Event{Kind: wire.EventSessionClosed})
+	if _, ok := <-first; ok {
+		t.Error("Error unsubscribing: channel still open")
+	}
+	if event := <-second; event.Kind != wire.EventSessionClosed {
+		t.Error("Error receiving event: got", event)
+	}
+}
+
+func TestBusDropsEventsOfSlowSubscribers(t *testing.T) {
+	bus := NewBus()
+	subscriber, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+	for i := 0; i < BUFFER_SIZE+10; i++ {
+		bus.Publish(wire.Event{Kind: wire.EventBytesForwarded, Bytes: i + 1})
+	}
+	if len(subscriber) != BUFFER_SIZE {
+		t.Error("Error publishing events: expected", BUFFER_SIZE, "buffered events, got", len(subscriber))
+	}
+	// a nil bus drops the events
+	var nilBus *Bus
+	nilBus.Publish(wire.Event{Kind: wire.EventClientConnected})
+}
@@ -1,3 +1,7 @@
 module semester-project/proxy
 
 go 1.20
+
+require semester-project/wire v0.0.0
+
+replace semester-project/wire => ../wire
@@ -7,38 +7,363 @@ Description: This file contains the code to log messages.
 */
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-// Loggers contains all the loggers.
-type Loggers struct {
-	Info    *log.Logger
-	Warning *log.Logger
-	Error   *log.Logger
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A Level is the severity of a log message.
+type Level int
+
+// Options configure the loggers returned by GetLoggers.
+type Options struct {
+	// Path is the file the messages are appended to, or stdout if empty.
+	Path string
+	// ClientPath and ConfigPath are the files the messages of the client
+	// connections and of the configuration are appended to, if they are not
+	// appended to Path.
+	ClientPath string
+	ConfigPath string
+	// Rotation configures the rotation of the files.
+	Rotation RotationOptions
+	// Format is FORMAT_TEXT or FORMAT_JSON. It defaults to FORMAT_TEXT.
+	Format string
+	// Level is the minimum level of the messages logged.
+	Level Level
+}
+
+// output is the destination shared by the loggers of a file.
+type output struct {
+	lock   sync.Mutex
+	writer io.Writer
+	format string
+	level  Level
+	// color is true if the messages are colored, i.e. if the writer is a
+	// terminal and the format is FORMAT_TEXT.
+	color bool
+}
+
+// A Logger logs leveled messages of a component of the proxy, with
+// key-value fields. It is thread-safe. A nil Logger discards the messages.
+type Logger struct {
+	out       *output
+	component string
+	// fields are logged with every message, e.g. the ID of a session.
+	fields []interface{}
+}
+
+//------------------------------------------------------------------------------
+// Errors
+//------------------------------------------------------------------------------
+
+// ErrUnknownLevel is returned when a level cannot be parsed.
+var ErrUnknownLevel = errors.New("unknown log level")
+
+// ErrUnknownFormat is returned when a format is not supported.
+var ErrUnknownFormat = errors.New("unknown log format")
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// Levels of the messages, from the most verbose.
+const (
+	DEBUG Level = iota - 1
+	INFO
+	WARNING
+	ERROR
+)
+
+// Formats of the messages.
+const (
+	// FORMAT_TEXT is one human-readable line per message, with the fields as
+	// key=value pairs.
+	FORMAT_TEXT = "text"
+	// FORMAT_JSON is one JSON object per message.
+	FORMAT_JSON = "json"
+)
+
+// TIME_FORMAT is the format of the time of the messages.
+const TIME_FORMAT = "2006-01-02T15:04:05.000Z07:00"
+
+//------------------------------------------------------------------------------
+// Private variables
+//------------------------------------------------------------------------------
+
+// levelColors are the ANSI colors of the levels.
+var levelColors = map[Level]string{
+	DEBUG:   "\033[0;90m",
+	INFO:    "\033[0m",
+	WARNING: "\033[0;33m",
+	ERROR:   "\033[0;31m",
+}
+
+// componentColors are the ANSI colors of the components.
+var componentColors = map[string]string{
+	"client": "\033[44;37m",
+	"config": "\033[43;37m",
+}
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// isTerminal returns true if the writer is a terminal.
+func isTerminal(writer io.Writer) bool {
+	file, ok := writer.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
-// GetLoggers returns all the loggers.
-func GetLoggers(filepath string) (*Loggers, *Loggers, error) {
-	var output io.Writer
-	// if the filepath is empty, use stdout
-	if filepath == "" {
-		output = os.Stdout
+// fieldValue returns the value of a field as it is encoded in JSON.
+func fieldValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	case json.Marshaler:
+		return v
+	}
+	if _, err := json.Marshal(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return value
+}
+
+// formatText returns the value of a field as it is written in the text
+// format, quoted if needed.
+func formatText(value interface{}) string {
+	text := fmt.Sprint(fieldValue(value))
+	if text == "" || strings.ContainsAny(text, " =\"\t\n") {
+		return strconv.Quote(text)
+	}
+	return text
+}
+
+// encodeText returns the message in the text format.
+func (l *Logger) encodeText(now time.Time, level Level, message string, fields []interface{}) string {
+	var b strings.Builder
+	b.WriteString(now.Format(TIME_FORMAT) + " ")
+	if l.out.color {
+		componentColor, ok := componentColors[l.component]
+		if !ok {
+			componentColor = "\033[47;30m"
+		}
+		fmt.Fprintf(&b, "%s[%s]\033[0m %s%-7s\033[0m ", componentColor, strings.ToUpper(l.component), levelColors[level], level)
 	} else {
-		file, err := os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+		fmt.Fprintf(&b, "[%s] %-7s ", strings.ToUpper(l.component), level)
+	}
+	b.WriteString(message)
+	for i := 0; i+1 < len(fields); i += 2 {
+		fmt.Fprintf(&b, " %v=%s", fields[i], formatText(fields[i+1]))
+	}
+	return b.String() + "\n"
+}
+
+// encodeJSON returns the message in the JSON format. The fields are written
+// in order, after the time, level, component and message.
+func (l *Logger) encodeJSON(now time.Time, level Level, message string, fields []interface{}) string {
+	var b strings.Builder
+	write := func(key string, value interface{}) {
+		data, err := json.Marshal(value)
 		if err != nil {
-			return nil, nil, err
+			data, _ = json.Marshal(fmt.Sprint(value))
+		}
+		keyData, _ := json.Marshal(key)
+		if b.Len() > 0 {
+			b.WriteString(",")
+		}
+		b.Write(keyData)
+		b.WriteString(":")
+		b.Write(data)
+	}
+	write("time", now.Format(TIME_FORMAT))
+	write("level", strings.ToLower(level.String()))
+	write("component", l.component)
+	write("msg", message)
+	for i := 0; i+1 < len(fields); i += 2 {
+		write(fmt.Sprint(fields[i]), fieldValue(fields[i+1]))
+	}
+	return "{" + b.String() + "}\n"
+}
+
+// log writes the message if its level is enabled.
+func (l *Logger) log(level Level, message string, keyvals []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	fields := append(append([]interface{}{}, l.fields...), keyvals...)
+	now := time.Now()
+	var line string
+	if l.out.format == FORMAT_JSON {
+		line = l.encodeJSON(now, level, message, fields)
+	} else {
+		line = l.encodeText(now, level, message, fields)
+	}
+	l.out.lock.Lock()
+	defer l.out.lock.Unlock()
+	io.WriteString(l.out.writer, line)
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// String returns the name of the level.
+func (level Level) String() string {
+	switch level {
+	case DEBUG:
+		return "DEBUG"
+	case INFO:
+		return "INFO"
+	case WARNING:
+		return "WARNING"
+	case ERROR:
+		return "ERROR"
+	default:
+		return "LEVEL" + strconv.Itoa(int(level))
+	}
+}
+
+// ParseLevel parses the name of a level, e.g. info.
+func ParseLevel(name string) (Level, error) {
+	for _, level := range []Level{DEBUG, INFO, WARNING, ERROR} {
+		if strings.EqualFold(name, level.String()) {
+			return level, nil
 		}
-		output = file
-	}
-	return &Loggers{
-			Info:    log.New(output, "\033[44;37m[CLIENT]\033[0m INFO:    \033[0m", log.Ldate|log.Ltime),
-			Warning: log.New(output, "\033[44;37m[CLIENT]\033[0;33m WARNING: \033[0m", log.Ldate|log.Ltime),
-			Error:   log.New(output, "\033[44;37m[CLIENT]\033[0;31m ERROR:   \033[0m", log.Ldate|log.Ltime),
-		}, &Loggers{
-			Info:    log.New(output, "\033[43;37m[CONFIG]\033[0m INFO:    \033[0m", log.Ldate|log.Ltime),
-			Warning: log.New(output, "\033[43;37m[CONFIG]\033[0;33m WARNING: \033[0m", log.Ldate|log.Ltime),
-			Error:   log.New(output, "\033[43;37m[CONFIG]\033[0;31m ERROR:   \033[0m", log.Ldate|log.Ltime),
-		}, nil
+	}
+	if strings.EqualFold(name, "warn") {
+		return WARNING, nil
+	}
+	return INFO, fmt.Errorf("%w: %s", ErrUnknownLevel, name)
+}
+
+// New returns a logger of the component writing to the writer in the given
+// format. The messages are colored if the writer is a terminal and the
+// format is FORMAT_TEXT.
+func New(writer io.Writer, component string, format string, level Level) (*Logger, error) {
+	if format == "" {
+		format = FORMAT_TEXT
+	}
+	if format != FORMAT_TEXT && format != FORMAT_JSON {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+	return &Logger{
+		out: &output{
+			writer: writer,
+			format: format,
+			level:  level,
+			color:  format == FORMAT_TEXT && isTerminal(writer),
+		},
+		component: component,
+	}, nil
+}
+
+// GetLoggers returns the loggers of the client connections and of the
+// configuration. Both write to the same output, unless they are given their
+// own file.
+func GetLoggers(options Options) (*Logger, *Logger, error) {
+	// the loggers writing to the same file share its output
+	writers := make(map[string]io.Writer)
+	getWriter := func(path string) (io.Writer, error) {
+		if path == "" {
+			path = options.Path
+		}
+		if writer, ok := writers[path]; ok {
+			return writer, nil
+		}
+		// if the path is empty, use stdout
+		var writer io.Writer = os.Stdout
+		if path != "" {
+			file, err := OpenRotatingFile(path, options.Rotation)
+			if err != nil {
+				return nil, err
+			}
+			writer = file
+		}
+		writers[path] = writer
+		return writer, nil
+	}
+	clientWriter, err := getWriter(options.ClientPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	configWriter, err := getWriter(options.ConfigPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	clientLogger, err := New(clientWriter, "client", options.Format, options.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+	if configWriter == clientWriter {
+		return clientLogger, clientLogger.Component("config"), nil
+	}
+	configLogger, err := New(configWriter, "config", options.Format, options.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+	return clientLogger, configLogger, nil
+}
+
+// Component returns a logger of another component writing to the same
+// output, with the same fields.
+func (l *Logger) Component(component string) *Logger {
+	if l == nil {
+		return nil
+	}
+	return &Logger{out: l.out, component: component, fields: l.fields}
+}
+
+// With returns a logger adding the key-value pairs to the fields of every
+// message, e.g. With("session", id).
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(append(fields, l.fields...), keyvals...)
+	return &Logger{out: l.out, component: l.component, fields: fields}
+}
+
+// Enabled returns true if the messages of the level are logged.
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level >= l.out.level
+}
+
+// Debug logs a message with the key-value pairs, e.g.
+// Debug("Message received", "type", message.Type).
+func (l *Logger) Debug(message string, keyvals ...interface{}) {
+	l.log(DEBUG, message, keyvals)
+}
+
+// Info logs a message with the key-value pairs.
+func (l *Logger) Info(message string, keyvals ...interface{}) {
+	l.log(INFO, message, keyvals)
+}
+
+// Warning logs a message with the key-value pairs.
+func (l *Logger) Warning(message string, keyvals ...interface{}) {
+	l.log(WARNING, message, keyvals)
+}
+
+// Error logs a message with the key-value pairs.
+func (l *Logger) Error(message string, keyvals ...interface{}) {
+	l.log(ERROR, message, keyvals)
 }
@@ -0,0 +1,87 @@
+package logs
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the loggers.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestTextLogger(t *testing.T) {
+	var b strings.Builder
+	logger, err := New(&b, "client", FORMAT_TEXT, INFO)
+	if err != nil {
+		t.Fatal("Error creating logger:", err)
+	}
+	session := logger.With("session", 7, "client", "127.0.0.1:5000")
+	session.Debug("Node dialed", "node", "127.0.0.1:8001")
+	session.Error("Error connecting to node", "node", "127.0.0.1:8001", "error", errors.New("connection refused"))
+	output := b.String()
+	if strings.Contains(output, "Node dialed") {
+		t.Error("Error filtering the levels: debug message logged\n" + output)
+	}
+	if strings.Contains(output, "\033[") {
+		t.Error("Error logging to a file: message colored\n" + output)
+	}
+	expected := `[CLIENT] ERROR   Error connecting to node session=7 client=127.0.0.1:5000 node=127.0.0.1:8001 error="connection refused"`
+	if !strings.Contains(output, expected) || strings.Count(output, "\n") != 1 {
+		t.Errorf("Error logging: got %q, expected a line with %q", output, expected)
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	var b strings.Builder
+	logger, err := New(&b, "client", FORMAT_JSON, DEBUG)
+	if err != nil {
+		t.Fatal("Error creating logger:", err)
+	}
+	logger.Component("config").With("session", 3).Warning("Configuration warning", "warning", "no response node")
+	var line map[string]interface{}
+	err = json.Unmarshal([]byte(b.String()), &line)
+	if err != nil {
+		t.Fatal("Error decoding the message:", err)
+	}
+	expected := map[string]interface{}{
+		"level":     "warning",
+		"component": "config",
+		"msg":       "Configuration warning",
+		"session":   float64(3),
+		"warning":   "no response node",
+	}
+	for key, value := range expected {
+		if line[key] != value {
+			t.Errorf("Error logging %s: got %v, expected %v", key, line[key], value)
+		}
+	}
+	if _, ok := line["time"]; !ok {
+		t.Error("Error logging: no time")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, expected := range map[string]Level{"debug": DEBUG, "INFO": INFO, "warn": WARNING, "error": ERROR} {
+		level, err := ParseLevel(name)
+		if err != nil || level != expected {
+			t.Errorf("Error parsing level %q: got %v, %v", name, level, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); !errors.Is(err, ErrUnknownLevel) {
+		t.Error("Error parsing unknown level: got", err)
+	}
+	if _, err := New(nil, "client", "xml", INFO); !errors.Is(err, ErrUnknownFormat) {
+		t.Error("Error creating logger with unknown format: got", err)
+	}
+	// a nil logger discards the messages
+	var logger *Logger
+	logger.With("session", 1).Info("Discarded")
+}
@@ -0,0 +1,286 @@
+package logs
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to rotate the log files.
+*/
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// RotationOptions configure when a log file is rotated and how many rotated
+// files are kept. The zero value never rotates the file.
+type RotationOptions struct {
+	// MaxSize is the size, in bytes, above which the file is rotated, or 0.
+	MaxSize int64
+	// Interval is the time after which the file is rotated, or 0.
+	Interval time.Duration
+	// Compress compresses the rotated files with gzip.
+	Compress bool
+	// Keep is the number of rotated files kept, or 0 to keep all of them.
+	Keep int
+}
+
+// A RotatingFile is a log file that is rotated according to its options.
+// The rotated files are named after the file and the time of the rotation,
+// e.g. proxy.log.20230601T120000.000 or proxy.log.20230601T120000.000.gz.
+// The rotated files are compressed and pruned in the background, so that the
+// loggers are not blocked meanwhile.
+// It is thread-safe.
+type RotatingFile struct {
+	lock    sync.Mutex
+	path    string
+	options RotationOptions
+	file    *os.File
+	size    int64
+	// started is the time the content of the file started to be written,
+	// i.e. the time of the last rotation.
+	started time.Time
+	// cleanupLock serializes the compressions and prunes of the rotated
+	// files, cleanups waits for them.
+	cleanupLock sync.Mutex
+	cleanups    sync.WaitGroup
+	// cleanupErr is the error of the last cleanup, returned by the next
+	// write.
+	cleanupErr error
+	// now returns the current time, it is replaced by the tests.
+	now func() time.Time
+}
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// ROTATION_TIME_FORMAT is the format of the time in the names of the rotated
+// files. The names sort in the order of the rotations.
+const ROTATION_TIME_FORMAT = "20060102T150405.000"
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// rotationTime returns the time of the rotation of the rotated file, and false
+// if the path is not a rotated file of the log file.
+func (f *RotatingFile) rotationTime(path string) (time.Time, bool) {
+	prefix := filepath.Base(f.path) + "."
+	suffix, ok := strings.CutPrefix(filepath.Base(path), prefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	rotation, err := time.Parse(ROTATION_TIME_FORMAT, strings.TrimSuffix(suffix, ".gz"))
+	return rotation, err == nil
+}
+
+// open opens the file, keeping its content. The content of an existing file
+// started at the last rotation, or at its last modification if it was never
+// rotated, so that restarting the proxy does not delay the rotations.
+// It must be called with the lock held.
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.started = f.now()
+	if f.size > 0 {
+		f.started = info.ModTime()
+		if rotated, err := f.Rotated(); err == nil && len(rotated) > 0 {
+			f.started, _ = f.rotationTime(rotated[len(rotated)-1])
+		}
+	}
+	return nil
+}
+
+// compress compresses the rotated file and removes it.
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(dst)
+	_, err = io.Copy(writer, src)
+	if err == nil {
+		err = writer.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+// prune removes the oldest rotated files above the number of files kept.
+func (f *RotatingFile) prune() error {
+	if f.options.Keep <= 0 {
+		return nil
+	}
+	rotated, err := f.Rotated()
+	if err != nil {
+		return err
+	}
+	for len(rotated) > f.options.Keep {
+		err = os.Remove(rotated[0])
+		if err != nil {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+// cleanup compresses the rotated file and removes the oldest ones if needed.
+// It runs in the background, its error is returned by the next write.
+func (f *RotatingFile) cleanup(rotatedPath string) {
+	defer f.cleanups.Done()
+	f.cleanupLock.Lock()
+	defer f.cleanupLock.Unlock()
+	var err error
+	if f.options.Compress {
+		err = compress(rotatedPath)
+	}
+	if err == nil {
+		err = f.prune()
+	}
+	if err != nil {
+		f.lock.Lock()
+		f.cleanupErr = err
+		f.lock.Unlock()
+	}
+}
+
+// rotate renames the file and reopens it, then starts the cleanup of the
+// rotated files. The file is reopened even if it could not be renamed, so
+// that the messages are still logged.
+// It must be called with the lock held.
+func (f *RotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+	rotation := f.now()
+	rotatedPath := f.path + "." + rotation.UTC().Format(ROTATION_TIME_FORMAT)
+	renameErr := os.Rename(f.path, rotatedPath)
+	err := f.open()
+	if err != nil {
+		return err
+	}
+	f.started = rotation
+	if renameErr != nil {
+		return renameErr
+	}
+	f.cleanups.Add(1)
+	go f.cleanup(rotatedPath)
+	return nil
+}
+
+// needsRotation returns true if the file must be rotated before writing n
+// bytes to it.
+// It must be called with the lock held.
+func (f *RotatingFile) needsRotation(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.options.MaxSize > 0 && f.size+int64(n) > f.options.MaxSize {
+		return true
+	}
+	return f.options.Interval > 0 && f.now().Sub(f.started) >= f.options.Interval
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// OpenRotatingFile opens the log file, creating it if needed, and rotates it
+// according to the options.
+func OpenRotatingFile(path string, options RotationOptions) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:    path,
+		options: options,
+		now:     time.Now,
+	}
+	err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write writes the data to the file, rotating it first if needed. If the
+// rotation fails, the data is still written to the file if it is open.
+func (f *RotatingFile) Write(data []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	rotationErr := f.cleanupErr
+	f.cleanupErr = nil
+	if f.file != nil && f.needsRotation(len(data)) {
+		if err := f.rotate(); err != nil {
+			rotationErr = err
+		}
+	}
+	if f.file == nil {
+		// the file could not be reopened after a rotation
+		err := f.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(data)
+	f.size += int64(n)
+	if err == nil {
+		err = rotationErr
+	}
+	return n, err
+}
+
+// Rotated returns the paths of the rotated files, oldest first.
+func (f *RotatingFile) Rotated() ([]string, error) {
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	rotated := matches[:0]
+	for _, match := range matches {
+		if _, ok := f.rotationTime(match); ok {
+			rotated = append(rotated, match)
+		}
+	}
+	sort.Strings(rotated)
+	return rotated, nil
+}
+
+// Close closes the file, and waits for the cleanup of the rotated files.
+func (f *RotatingFile) Close() error {
+	f.lock.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+	}
+	f.lock.Unlock()
+	f.cleanups.Wait()
+	return err
+}
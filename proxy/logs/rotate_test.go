@@ -0,0 +1,164 @@
+package logs
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the rotation of the log files.
+*/
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Helpers
+//------------------------------------------------------------------------------
+
+// openTestFile opens a rotating file whose clock advances by one second at
+// each call.
+func openTestFile(t *testing.T, options RotationOptions) (*RotatingFile, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "proxy.log")
+	f, err := OpenRotatingFile(path, options)
+	if err != nil {
+		t.Fatal("Error opening log file:", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	f.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	f.started = f.now()
+	return f, path
+}
+
+// readFile returns the content of the file, uncompressed if it ends with .gz.
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal("Error opening file:", err)
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		reader, err = gzip.NewReader(file)
+		if err != nil {
+			t.Fatal("Error reading compressed file:", err)
+		}
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Error reading file:", err)
+	}
+	return string(data)
+}
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestRotateBySize(t *testing.T) {
+	f, path := openTestFile(t, RotationOptions{MaxSize: 10, Compress: true, Keep: 2})
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := f.Write([]byte(line))
+		if err != nil {
+			t.Fatal("Error writing to log file:", err)
+		}
+	}
+	// each line exceeds the size with the previous one, the oldest is removed
+	f.Close()
+	rotated, err := f.Rotated()
+	if err != nil || len(rotated) != 2 {
+		t.Fatal("Error listing rotated files: expected 2, got", rotated, err)
+	}
+	for i, expected := range []string{"second\n", "third\n"} {
+		if !strings.HasSuffix(rotated[i], ".gz") {
+			t.Error("Error compressing rotated file:", rotated[i])
+		}
+		if content := readFile(t, rotated[i]); content != expected {
+			t.Errorf("Error rotating log file: %s contains %q, expected %q", rotated[i], content, expected)
+		}
+	}
+	if content := readFile(t, path); content != "fourth\n" {
+		t.Errorf("Error rotating log file: contains %q, expected %q", content, "fourth\n")
+	}
+}
+
+func TestRotateByTime(t *testing.T) {
+	f, path := openTestFile(t, RotationOptions{Interval: 90 * time.Second})
+	f.Write([]byte("first\n"))
+	f.Write([]byte("second\n"))
+	f.started = f.started.Add(-2 * time.Minute)
+	f.Write([]byte("third\n"))
+	f.Close()
+	rotated, err := f.Rotated()
+	if err != nil || len(rotated) != 1 {
+		t.Fatal("Error listing rotated files: expected 1, got", rotated, err)
+	}
+	if content := readFile(t, rotated[0]); content != "first\nsecond\n" {
+		t.Errorf("Error rotating log file: %s contains %q", rotated[0], content)
+	}
+	if content := readFile(t, path); content != "third\n" {
+		t.Errorf("Error rotating log file: contains %q", content)
+	}
+}
+
+func TestRotateByTimeAfterRestart(t *testing.T) {
+	f, path := openTestFile(t, RotationOptions{Interval: time.Hour})
+	f.started = f.started.Add(-2 * time.Hour)
+	f.Write([]byte("first\n"))
+	f.Write([]byte("second\n"))
+	f.Close()
+	rotated, err := f.Rotated()
+	if err != nil || len(rotated) != 1 {
+		t.Fatal("Error listing rotated files: expected 1, got", rotated, err)
+	}
+	rotation, _ := f.rotationTime(rotated[0])
+	// the file reopened after a restart started at the last rotation
+	f, err = OpenRotatingFile(path, RotationOptions{Interval: time.Hour})
+	if err != nil {
+		t.Fatal("Error reopening log file:", err)
+	}
+	defer f.Close()
+	if !f.started.Equal(rotation) {
+		t.Errorf("Error reopening log file: started at %v, expected %v", f.started, rotation)
+	}
+	// a file that was never rotated started at its last modification
+	os.Remove(rotated[0])
+	modified := time.Now().Add(-30 * time.Minute).Truncate(time.Second)
+	os.Chtimes(path, modified, modified)
+	g, err := OpenRotatingFile(path, RotationOptions{Interval: time.Hour})
+	if err != nil {
+		t.Fatal("Error reopening log file:", err)
+	}
+	defer g.Close()
+	if !g.started.Equal(modified) {
+		t.Errorf("Error reopening log file: started at %v, expected %v", g.started, modified)
+	}
+}
+
+func TestGetLoggersDestinations(t *testing.T) {
+	dir := t.TempDir()
+	clientPath := filepath.Join(dir, "client.log")
+	configPath := filepath.Join(dir, "config.log")
+	clientLogger, configLogger, err := GetLoggers(Options{ClientPath: clientPath, ConfigPath: configPath})
+	if err != nil {
+		t.Fatal("Error getting loggers:", err)
+	}
+	clientLogger.Info("Connection opened")
+	configLogger.Info("Session opened")
+	if content := readFile(t, clientPath); !strings.Contains(content, "[CLIENT]") || strings.Contains(content, "[CONFIG]") {
+		t.Error("Error logging the client connections to their file:", content)
+	}
+	if content := readFile(t, configPath); !strings.Contains(content, "[CONFIG]") || strings.Contains(content, "[CLIENT]") {
+		t.Error("Error logging the configuration to its file:", content)
+	}
+}
@@ -7,18 +7,30 @@ Description: This file contains the entry point of the proxy.
 */
 
 import (
+	"flag"
 	"fmt"
 	"net"
 	"os"
+	"semester-project/proxy/admin"
+	"semester-project/proxy/audit"
+	"semester-project/proxy/auth"
 	"semester-project/proxy/configuration"
 	"semester-project/proxy/connection"
+	"semester-project/proxy/events"
 	"semester-project/proxy/logs"
+	"semester-project/proxy/metrics"
+	"semester-project/proxy/record"
+	"semester-project/proxy/sessions"
+	"semester-project/proxy/trigger"
+	"semester-project/wire"
+	"time"
 )
 
-// configListener listens for configuration connections.
-func configListener(loggers *logs.Loggers, localAddrConfig string, configManager *configuration.ConfigManager) {
+// configListener listens for configuration connections, whose messages are
+// at most maxConfigSize bytes.
+func configListener(logger *logs.Logger, localAddrConfig string, configManager *configuration.ConfigManager, maxConfigSize int) {
 	// listen on local address using TCP
-	loggers.Info.Println("Listening on", localAddrConfig, "for configuration connections")
+	logger.Info("Listening for configuration connections", "addr", localAddrConfig)
 	listener, err := net.Listen("tcp", localAddrConfig)
 	if err != nil {
 		panic("Error listening on " + localAddrConfig + ": " + err.Error())
@@ -29,18 +41,18 @@ func configListener(loggers *logs.Loggers, localAddrConfig string, configManager
 		// accept connection
 		conn, err := listener.Accept()
 		if err != nil {
-			loggers.Error.Println("Error accepting new connection:", err)
+			logger.Error("Error accepting new connection", "error", err)
+			continue
 		}
-		loggers.Info.Println("New connection from", conn.RemoteAddr())
 		// start goroutine to handle configuration connection
-		go connection.HandleConfigConnection(conn, configManager)
+		go connection.HandleConfigConnection(conn, configManager, maxConfigSize)
 	}
 }
 
 // clientListener listens for client connections.
-func clientListener(loggers *logs.Loggers, localAddrClient string, configManager *configuration.ConfigManager) {
+func clientListener(logger *logs.Logger, localAddrClient string, configManager *configuration.ConfigManager) {
 	// listen on local address using TCP
-	loggers.Info.Println("Listening on", localAddrClient, "for client connections")
+	logger.Info("Listening for client connections", "addr", localAddrClient)
 	listener, err := net.Listen("tcp", localAddrClient)
 	if err != nil {
 		panic("Error listening on " + localAddrClient + ": " + err.Error())
@@ -51,36 +63,150 @@ func clientListener(loggers *logs.Loggers, localAddrClient string, configManager
 		// accept connection
 		conn, err := listener.Accept()
 		if err != nil {
-			loggers.Error.Println("Error accepting new connection:", err)
+			logger.Error("Error accepting new connection", "error", err)
+			continue
 		}
-		loggers.Info.Println("New connection from", conn.RemoteAddr())
 		// get the configuration
-		config := configManager.GetConfig()
+		active := configManager.GetActiveConfig()
 		// start goroutine to handle client connection
-		go connection.HandleClientConnection(conn, config)
+		go connection.HandleClientConnection(conn, active.Config, active.ConfigVersion)
 	}
 }
 
 func main() {
 	// read arguments
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: proxy <local address> <port for client> <port for configuration>")
+	adminAddr := flag.String("admin", "", "address to serve the HTTP admin API on, e.g. 127.0.0.1:9002 (disabled if empty)")
+	metricsAddr := flag.String("metrics", "", "address to serve the Prometheus metrics on, at /metrics, e.g. 127.0.0.1:9003 (disabled if empty)")
+	statePath := flag.String("state", "", "file to persist the configuration and the presets to (disabled if empty)")
+	maxConfigSize := flag.Int("max-config-size", wire.DEFAULT_MAX_FRAME_SIZE, "maximum size of a configuration message, in bytes")
+	triggerInterval := flag.Duration("trigger-interval", time.Second, "interval between two polls of the nodes to evaluate the triggers")
+	auditPath := flag.String("audit", "", "file to append the audit log of the config changes to (disabled if empty)")
+	authKeys := flag.String("auth-keys", "", "file of identity:secret lines; if set, unsigned configuration messages are rejected")
+	authWindow := flag.Duration("auth-window", 30*time.Second, "maximum clock skew accepted on signed configuration messages")
+	logFormat := flag.String("log-format", logs.FORMAT_TEXT, "format of the logs, text or json")
+	logLevel := flag.String("log-level", "info", "minimum level of the logs, debug, info, warning or error")
+	logPath := flag.String("log", "", "file to append the logs to (stdout if empty)")
+	clientLogPath := flag.String("client-log", "", "file to append the logs of the client connections to, instead of -log")
+	configLogPath := flag.String("config-log", "", "file to append the logs of the configuration to, instead of -log")
+	logMaxSize := flag.Int64("log-max-size", 0, "size of a log file, in MiB, above which it is rotated (disabled if 0)")
+	logRotateEvery := flag.Duration("log-rotate-every", 0, "time after which a log file is rotated, e.g. 24h (disabled if 0)")
+	logCompress := flag.Bool("log-compress", false, "compress the rotated log files with gzip")
+	logKeep := flag.Int("log-keep", 0, "number of rotated log files kept per log file (all if 0)")
+	recordPath := flag.String("record", "", "file to append the HTTP exchanges of the client sessions to, one JSON object per line (disabled if empty)")
+	captureDir := flag.String("capture-dir", "", "directory to write the pcapng captures of the client sessions to, when the config captures them (disabled if empty)")
+	flag.Usage = func() {
+		fmt.Println("Usage: proxy [options] <local address> <port for client> <port for configuration>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 3 {
+		flag.Usage()
 		os.Exit(1)
 	}
-	localAddrClient := os.Args[1] + ":" + os.Args[2]
-	localAddrConfig := os.Args[1] + ":" + os.Args[3]
+	localAddrClient := flag.Arg(0) + ":" + flag.Arg(1)
+	localAddrConfig := flag.Arg(0) + ":" + flag.Arg(2)
 	// get loggers
-	clientLoggers, configLoggers, err := logs.GetLoggers("")
+	level, err := logs.ParseLevel(*logLevel)
+	if err != nil {
+		panic("Error getting loggers: " + err.Error())
+	}
+	clientLogger, configLogger, err := logs.GetLoggers(logs.Options{
+		Path:       *logPath,
+		ClientPath: *clientLogPath,
+		ConfigPath: *configLogPath,
+		Format:     *logFormat,
+		Level:      level,
+		Rotation: logs.RotationOptions{
+			MaxSize:  *logMaxSize << 20,
+			Interval: *logRotateEvery,
+			Compress: *logCompress,
+			Keep:     *logKeep,
+		},
+	})
 	if err != nil {
 		panic("Error getting loggers: " + err.Error())
 	}
 	// initialize loggers
-	connection.InitClientLoggers(clientLoggers)
-	connection.InitConfigLoggers(configLoggers)
+	connection.InitClientLogger(clientLogger)
+	connection.InitConfigLogger(configLogger)
+	if *captureDir != "" {
+		err = os.MkdirAll(*captureDir, 0755)
+		if err != nil {
+			panic("Error creating capture directory " + *captureDir + ": " + err.Error())
+		}
+		connection.InitCaptureDir(*captureDir)
+	}
+	// create the bus the events are published on
+	bus := events.NewBus()
+	connection.InitEventBus(bus)
+	// load the keys authenticating the configuration messages
+	var verifier *auth.Verifier
+	if *authKeys != "" {
+		keys, err := auth.LoadKeys(*authKeys)
+		if err != nil {
+			panic("Error loading keys: " + err.Error())
+		}
+		verifier = auth.NewVerifier(keys, *authWindow)
+		connection.InitConfigVerifier(verifier)
+		configLogger.Info("Configuration messages must be signed", "identities", len(keys))
+	}
 	// create a configuration manager
 	configManager := configuration.NewConfigManager()
+	if *statePath != "" {
+		err = configManager.LoadState(*statePath)
+		if err != nil {
+			panic("Error loading state from " + *statePath + ": " + err.Error())
+		}
+		configLogger.Info("State persisted", "path", *statePath)
+	}
+	if *auditPath != "" {
+		auditLog, err := audit.Open(*auditPath)
+		if err != nil {
+			panic("Error opening audit log " + *auditPath + ": " + err.Error())
+		}
+		defer auditLog.Close()
+		configManager.SetAuditLog(auditLog)
+		configLogger.Info("Config changes audited", "path", *auditPath)
+	}
+	if *recordPath != "" {
+		recorder, err := record.Open(*recordPath)
+		if err != nil {
+			panic("Error opening record file " + *recordPath + ": " + err.Error())
+		}
+		defer recorder.Close()
+		connection.InitClientRecorder(recorder)
+		clientLogger.Info("HTTP exchanges recorded", "path", *recordPath)
+	}
+	// create the registry of the client sessions
+	registry := sessions.NewRegistry()
+	connection.InitClientRegistry(registry)
+	// start goroutine to serve the metrics
+	if *metricsAddr != "" {
+		proxyMetrics := metrics.New(configManager)
+		connection.InitClientMetrics(proxyMetrics)
+		go func() {
+			err := proxyMetrics.ListenAndServe(*metricsAddr, configLogger.Component("metrics"))
+			panic("Error serving metrics on " + *metricsAddr + ": " + err.Error())
+		}()
+	}
+	// start goroutine to serve the admin API
+	if *adminAddr != "" {
+		go func() {
+			server := admin.NewServer(configManager, registry, configLogger.Component("admin"))
+			server.LimitBodySize(int64(*maxConfigSize))
+			if verifier != nil {
+				server.RequireAuth(verifier)
+			}
+			err := server.ListenAndServe(*adminAddr)
+			panic("Error serving admin API on " + *adminAddr + ": " + err.Error())
+		}()
+	}
+	// start goroutine to evaluate the triggers
+	watcher := trigger.NewWatcher(configManager, configLogger.Component("trigger"), bus, *triggerInterval)
+	connection.InitClientObserver(watcher.NewObserver)
+	go watcher.Run()
 	// start goroutine to listen for configuration changes
-	go configListener(configLoggers, localAddrConfig, configManager)
+	go configListener(configLogger, localAddrConfig, configManager, *maxConfigSize)
 	// listen for client connections
-	clientListener(clientLoggers, localAddrClient, configManager)
+	clientListener(clientLogger, localAddrClient, configManager)
 }
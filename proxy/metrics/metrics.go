@@ -0,0 +1,142 @@
+package metrics
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the metrics of the proxy and the HTTP endpoint
+serving them.
+*/
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"semester-project/proxy/configuration"
+	"semester-project/proxy/logs"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// Metrics are the metrics of the proxy. A nil Metrics records nothing, so
+// that the metrics are optional.
+// It is thread-safe.
+type Metrics struct {
+	registry       *Registry
+	activeSessions *Gauge
+	sessions       *Counter
+	bytes          *Counter
+	dialFailures   *Counter
+	dialTimeouts   *Counter
+	responses      *Counter
+	latency        *Histogram
+}
+
+//------------------------------------------------------------------------------
+// Public variables
+//------------------------------------------------------------------------------
+
+// LATENCY_BUCKETS are the upper bounds of the buckets of the latency
+// histogram, in seconds.
+var LATENCY_BUCKETS = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// New creates the metrics of the proxy. The config version and the number of
+// config changes are read from the config manager.
+func New(configManager *configuration.ConfigManager) *Metrics {
+	registry := NewRegistry()
+	m := &Metrics{
+		registry:       registry,
+		activeSessions: registry.NewGauge("proxy_sessions_active", "Number of client sessions currently open."),
+		sessions:       registry.NewCounter("proxy_sessions_total", "Number of client sessions opened."),
+		bytes:          registry.NewCounter("proxy_bytes_total", "Bytes forwarded between the clients and a node, by direction (to-node or to-client).", "node", "direction"),
+		dialFailures:   registry.NewCounter("proxy_node_dial_failures_total", "Number of failed connections to a node, including the timeouts.", "node"),
+		dialTimeouts:   registry.NewCounter("proxy_node_dial_timeouts_total", "Number of connections to a node that timed out.", "node"),
+		responses:      registry.NewCounter("proxy_responses_total", "Number of responses served by a response node, a response being the data sent by the node after data of the client.", "node"),
+		latency:        registry.NewHistogram("proxy_request_duration_seconds", "Time between data of a client and the first byte of the response of the response node.", LATENCY_BUCKETS, "node"),
+	}
+	m.activeSessions.Set(0)
+	m.sessions.Add(0)
+	registry.NewGaugeFunc("proxy_config_version", "Version of the active config.", func() float64 {
+		return float64(configManager.GetVersion())
+	})
+	registry.NewCounterFunc("proxy_config_changes_total", "Number of configs applied since the proxy started.", func() float64 {
+		return float64(configManager.GetChanges())
+	})
+	return m
+}
+
+// SessionOpened records a new client session.
+func (m *Metrics) SessionOpened() {
+	if m == nil {
+		return
+	}
+	m.activeSessions.Add(1)
+	m.sessions.Inc()
+}
+
+// SessionClosed records the end of a client session.
+func (m *Metrics) SessionClosed() {
+	if m == nil {
+		return
+	}
+	m.activeSessions.Add(-1)
+}
+
+// AddBytes records bytes forwarded between a client and the node in the
+// given direction.
+func (m *Metrics) AddBytes(nodeAddr string, direction string, n int) {
+	if m == nil {
+		return
+	}
+	m.bytes.Add(float64(n), nodeAddr, direction)
+}
+
+// DialFailed records a failed connection to the node.
+func (m *Metrics) DialFailed(nodeAddr string, err error) {
+	if m == nil {
+		return
+	}
+	m.dialFailures.Inc(nodeAddr)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		m.dialTimeouts.Inc(nodeAddr)
+	}
+}
+
+// ResponseServed records a response of the node sent to a client, the given
+// time after the request of the client.
+func (m *Metrics) ResponseServed(nodeAddr string, latency time.Duration) {
+	if m == nil {
+		return
+	}
+	m.responses.Inc(nodeAddr)
+	m.latency.Observe(latency.Seconds(), nodeAddr)
+}
+
+// Handler returns the handler serving the metrics in the Prometheus text
+// format.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", CONTENT_TYPE)
+		m.registry.Write(w)
+	})
+}
+
+// ListenAndServe serves the metrics on /metrics at the given address.
+func (m *Metrics) ListenAndServe(addr string, logger *logs.Logger) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	logger.Info("Listening for metrics requests", "addr", addr)
+	return http.ListenAndServe(addr, mux)
+}
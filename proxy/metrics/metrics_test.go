@@ -0,0 +1,159 @@
+package metrics
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the metrics.
+*/
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"semester-project/proxy/configuration"
+	"semester-project/wire"
+	"strings"
+	"testing"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// timeoutError is a network error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// blockingWriter is a writer blocking until its channel is closed, like a
+// stalled scraper.
+type blockingWriter struct {
+	unblock chan struct{}
+}
+
+func (w blockingWriter) Write(data []byte) (int, error) {
+	<-w.unblock
+	return len(data), nil
+}
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestRegistryWrite(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("test_bytes_total", "Bytes.", "node", "direction")
+	counter.Add(10, "127.0.0.1:8002", "to-node")
+	counter.Add(5, "127.0.0.1:8001", "to-client")
+	counter.Inc("127.0.0.1:8001", "to-client")
+	registry.NewGauge("test_active", "Active.").Set(2)
+	histogram := registry.NewHistogram("test_seconds", "Latency.", []float64{0.1, 1}, "node")
+	histogram.Observe(0.05, `a"b`)
+	histogram.Observe(0.5, `a"b`)
+	histogram.Observe(3, `a"b`)
+	var b strings.Builder
+	err := registry.Write(&b)
+	if err != nil {
+		t.Fatal("Error writing metrics:", err)
+	}
+	expected := `# HELP test_bytes_total Bytes.
+# TYPE test_bytes_total counter
+test_bytes_total{node="127.0.0.1:8001",direction="to-client"} 6
+test_bytes_total{node="127.0.0.1:8002",direction="to-node"} 10
+# HELP test_active Active.
+# TYPE test_active gauge
+test_active 2
+# HELP test_seconds Latency.
+# TYPE test_seconds histogram
+test_seconds_bucket{node="a\"b",le="0.1"} 1
+test_seconds_bucket{node="a\"b",le="1"} 2
+test_seconds_bucket{node="a\"b",le="+Inf"} 3
+test_seconds_sum{node="a\"b"} 3.55
+test_seconds_count{node="a\"b"} 3
+`
+	if b.String() != expected {
+		t.Errorf("Error writing metrics: got\n%s\nexpected\n%s", b.String(), expected)
+	}
+}
+
+func TestRegistryWriteDoesNotBlock(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("test_bytes_total", "Bytes.")
+	// the function of a gauge may take its own locks, it must not be called
+	// with the lock of the registry held
+	registry.NewGaugeFunc("test_value", "Value.", func() float64 {
+		counter.Inc()
+		return 1
+	})
+	writer := blockingWriter{unblock: make(chan struct{})}
+	written := make(chan error)
+	go func() {
+		written <- registry.Write(writer)
+	}()
+	incremented := make(chan struct{})
+	go func() {
+		counter.Inc()
+		close(incremented)
+	}()
+	select {
+	case <-incremented:
+	case <-time.After(time.Second):
+		t.Fatal("Error recording metrics: blocked by a stalled writer")
+	}
+	close(writer.unblock)
+	err := <-written
+	if err != nil {
+		t.Error("Error writing metrics:", err)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	configManager := configuration.NewConfigManager()
+	err := configManager.SetConfig(wire.Config{Nodes: []wire.Node{{Addr: "127.0.0.1:8001"}}, ResponseNodeAddr: "127.0.0.1:8001"})
+	if err != nil {
+		t.Fatal("Error setting config:", err)
+	}
+	m := New(configManager)
+	m.SessionOpened()
+	m.SessionOpened()
+	m.SessionClosed()
+	m.AddBytes("127.0.0.1:8001", wire.DirectionToNode, 100)
+	m.DialFailed("127.0.0.1:8002", errors.New("connection refused"))
+	m.DialFailed("127.0.0.1:8002", &os.SyscallError{Syscall: "connect", Err: timeoutError{}})
+	m.ResponseServed("127.0.0.1:8001", 20*time.Millisecond)
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal("Error getting metrics:", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != CONTENT_TYPE {
+		t.Error("Error getting metrics: wrong content type", resp.Header.Get("Content-Type"))
+	}
+	data, _ := io.ReadAll(resp.Body)
+	for _, expected := range []string{
+		"proxy_sessions_active 1\n",
+		"proxy_sessions_total 2\n",
+		`proxy_bytes_total{node="127.0.0.1:8001",direction="to-node"} 100` + "\n",
+		`proxy_node_dial_failures_total{node="127.0.0.1:8002"} 2` + "\n",
+		`proxy_node_dial_timeouts_total{node="127.0.0.1:8002"} 1` + "\n",
+		`proxy_responses_total{node="127.0.0.1:8001"} 1` + "\n",
+		`proxy_request_duration_seconds_bucket{node="127.0.0.1:8001",le="0.025"} 1` + "\n",
+		"proxy_config_version 1\n",
+		"proxy_config_changes_total 1\n",
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Error getting metrics: %q not found in\n%s", expected, data)
+		}
+	}
+	// a nil Metrics records nothing
+	var nilMetrics *Metrics
+	nilMetrics.SessionOpened()
+	nilMetrics.ResponseServed("127.0.0.1:8001", time.Second)
+}
@@ -0,0 +1,312 @@
+package metrics
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains a registry of counters, gauges and histograms
+exposed in the Prometheus text format.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A Registry holds metrics and writes them in the Prometheus text format.
+// It is thread-safe.
+type Registry struct {
+	lock     sync.Mutex
+	families []*family
+}
+
+// family is a metric with all its series, one per combination of label
+// values.
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	// buckets are the upper bounds of the buckets of a histogram.
+	buckets []float64
+	// value returns the value of a gauge computed when the metrics are
+	// written, if set.
+	value  func() float64
+	series map[string]*series
+}
+
+// series is the value of a metric for some label values.
+type series struct {
+	labelValues []string
+	value       float64
+	// counts are the number of observations of a histogram in each bucket.
+	counts []uint64
+	count  uint64
+}
+
+// A Counter is a metric that only increases.
+type Counter struct {
+	registry *Registry
+	family   *family
+}
+
+// A Gauge is a metric that can increase and decrease.
+type Gauge struct {
+	registry *Registry
+	family   *family
+}
+
+// A Histogram counts observations, e.g. latencies, in buckets.
+type Histogram struct {
+	registry *Registry
+	family   *family
+}
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// Kinds of metrics.
+const (
+	KIND_COUNTER   = "counter"
+	KIND_GAUGE     = "gauge"
+	KIND_HISTOGRAM = "histogram"
+)
+
+// CONTENT_TYPE is the content type of the Prometheus text format.
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// add registers a new family.
+func (r *Registry) add(f *family) *family {
+	f.series = make(map[string]*series)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.families = append(r.families, f)
+	return f
+}
+
+// get returns the series of the label values, creating it if needed.
+// It must be called with the lock of the registry held.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		if f.kind == KIND_HISTOGRAM {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// snapshot returns a copy of the family and its series.
+// It must be called with the lock of the registry held.
+func (f *family) snapshot() *family {
+	copied := *f
+	copied.series = make(map[string]*series, len(f.series))
+	for key, s := range f.series {
+		copiedSeries := *s
+		copiedSeries.counts = append([]uint64{}, s.counts...)
+		copied.series[key] = &copiedSeries
+	}
+	return &copied
+}
+
+// formatValue formats a value of a sample.
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+// escapeLabel escapes a label value.
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatLabels formats the labels of a sample, e.g. {node="a",le="0.1"}.
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// write writes the family in the text format. The family must be a snapshot,
+// since the value of a gauge or counter function is computed without the lock
+// of the registry.
+func (f *family) write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, strings.ReplaceAll(f.help, "\n", " "), f.name, f.kind)
+	if err != nil {
+		return err
+	}
+	if f.value != nil {
+		_, err = fmt.Fprintf(w, "%s %s\n", f.name, formatValue(f.value()))
+		return err
+	}
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != KIND_HISTOGRAM {
+			_, err = fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labels, s.labelValues), formatValue(s.value))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		names := append(append([]string{}, f.labels...), "le")
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += s.counts[i]
+			values := append(append([]string{}, s.labelValues...), formatValue(bound))
+			_, err = fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(names, values), cumulative)
+			if err != nil {
+				return err
+			}
+		}
+		values := append(append([]string{}, s.labelValues...), "+Inf")
+		labels := formatLabels(f.labels, s.labelValues)
+		_, err = fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			f.name, formatLabels(names, values), s.count,
+			f.name, labels, formatValue(s.value),
+			f.name, labels, s.count,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// NewRegistry creates and returns a new Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// NewCounter registers a counter with the given label names.
+func (r *Registry) NewCounter(name string, help string, labels ...string) *Counter {
+	return &Counter{registry: r, family: r.add(&family{name: name, help: help, kind: KIND_COUNTER, labels: labels})}
+}
+
+// NewGauge registers a gauge with the given label names.
+func (r *Registry) NewGauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{registry: r, family: r.add(&family{name: name, help: help, kind: KIND_GAUGE, labels: labels})}
+}
+
+// NewGaugeFunc registers a gauge without labels whose value is computed by
+// the function each time the metrics are written.
+func (r *Registry) NewGaugeFunc(name string, help string, value func() float64) {
+	r.add(&family{name: name, help: help, kind: KIND_GAUGE, value: value})
+}
+
+// NewCounterFunc registers a counter without labels whose value is computed
+// by the function each time the metrics are written.
+func (r *Registry) NewCounterFunc(name string, help string, value func() float64) {
+	r.add(&family{name: name, help: help, kind: KIND_COUNTER, value: value})
+}
+
+// NewHistogram registers a histogram with the given bucket upper bounds, in
+// increasing order, and label names.
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{registry: r, family: r.add(&family{name: name, help: help, kind: KIND_HISTOGRAM, labels: labels, buckets: buckets})}
+}
+
+// Add adds the value, which must not be negative, to the counter of the
+// label values.
+func (c *Counter) Add(value float64, labelValues ...string) {
+	c.registry.lock.Lock()
+	defer c.registry.lock.Unlock()
+	c.family.get(labelValues).value += value
+}
+
+// Inc increments the counter of the label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds the value to the gauge of the label values.
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.registry.lock.Lock()
+	defer g.registry.lock.Unlock()
+	g.family.get(labelValues).value += value
+}
+
+// Set sets the gauge of the label values.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.registry.lock.Lock()
+	defer g.registry.lock.Unlock()
+	g.family.get(labelValues).value = value
+}
+
+// Observe adds an observation to the histogram of the label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.registry.lock.Lock()
+	defer h.registry.lock.Unlock()
+	s := h.family.get(labelValues)
+	for i, bound := range h.family.buckets {
+		if value <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+// Write writes the metrics in the Prometheus text format, in the order they
+// were registered. The values are copied under the lock and written after it
+// is released, so that a slow writer does not block the metrics, which are
+// recorded while the data of the clients is forwarded.
+func (r *Registry) Write(w io.Writer) error {
+	r.lock.Lock()
+	families := make([]*family, len(r.families))
+	for i, f := range r.families {
+		families[i] = f.snapshot()
+	}
+	r.lock.Unlock()
+	var b bytes.Buffer
+	for _, f := range families {
+		err := f.write(&b)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,159 @@
+package record
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the file the HTTP exchanges of the client
+sessions are recorded to, one JSON object per line.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// An Exchange is a request of a client with the responses of every node.
+type Exchange struct {
+	// Time is the time the end of the request was received.
+	Time          time.Time `json:"time"`
+	SessionID     uint64    `json:"sessionId"`
+	ClientAddr    string    `json:"clientAddr"`
+	ConfigVersion uint64    `json:"configVersion"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	// RPCMethod is the JSON-RPC method of the request, or the methods of a
+	// batch separated by commas, if any.
+	RPCMethod string          `json:"rpcMethod,omitempty"`
+	Request   json.RawMessage `json:"request,omitempty"`
+	// RequestTruncated is true if the body of the request was larger than
+	// MAX_BODY_SIZE and only its beginning is recorded.
+	RequestTruncated bool       `json:"requestTruncated,omitempty"`
+	Responses        []Response `json:"responses"`
+	// ReturnedNodeAddr is the node whose response was returned to the
+	// client, if any.
+	ReturnedNodeAddr string `json:"returnedNodeAddr,omitempty"`
+	// Divergent is true if the nodes returned different bodies.
+	Divergent bool `json:"divergent"`
+}
+
+// A Response is the response of a node to a request.
+type Response struct {
+	NodeAddr string          `json:"nodeAddr"`
+	Status   int             `json:"status,omitempty"`
+	Body     json.RawMessage `json:"body,omitempty"`
+	// Truncated is true if the body was larger than MAX_BODY_SIZE and only
+	// its beginning is recorded.
+	Truncated bool `json:"truncated,omitempty"`
+	// LatencyMs is the time between the end of the request and the end of
+	// the response, as received by the proxy, in milliseconds.
+	LatencyMs float64 `json:"latencyMs"`
+	Returned  bool    `json:"returned"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// A Recorder appends the exchanges to a file, one JSON object per line.
+// Exchanges recorded by previous runs of the proxy are kept.
+// It is thread-safe.
+type Recorder struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// encodeBody returns the body as JSON, as is if it is JSON, or as a string.
+func encodeBody(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	var compact bytes.Buffer
+	if json.Compact(&compact, body) == nil {
+		return compact.Bytes()
+	}
+	data, _ := json.Marshal(string(body))
+	return data
+}
+
+// rpcMethod returns the JSON-RPC method of the request body, or the methods
+// of a batch separated by commas, or an empty string.
+func rpcMethod(body []byte) string {
+	var call struct {
+		Method string `json:"method"`
+	}
+	if json.Unmarshal(body, &call) == nil {
+		return call.Method
+	}
+	var batch []struct {
+		Method string `json:"method"`
+	}
+	if json.Unmarshal(body, &batch) != nil {
+		return ""
+	}
+	var methods bytes.Buffer
+	for i, call := range batch {
+		if i > 0 {
+			methods.WriteString(",")
+		}
+		methods.WriteString(call.Method)
+	}
+	return methods.String()
+}
+
+// isDivergent returns true if the nodes that responded returned different
+// bodies.
+func isDivergent(responses []Response) bool {
+	var first *Response
+	for i := range responses {
+		if responses[i].Error != "" {
+			continue
+		}
+		if first == nil {
+			first = &responses[i]
+		} else if first.Status != responses[i].Status || !bytes.Equal(first.Body, responses[i].Body) {
+			return true
+		}
+	}
+	return false
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// Open opens the file at the given path, creating it if needed.
+func Open(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{file: file}, nil
+}
+
+// Write writes the exchange at the end of the file.
+func (r *Recorder) Write(exchange Exchange) error {
+	data, err := json.Marshal(exchange)
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	_, err = r.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the file.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,241 @@
+package record
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the recording of the HTTP
+exchanges.
+*/
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+const (
+	REQUEST_BLOCK_NUMBER = "POST / HTTP/1.1\r\nHost: proxy\r\nContent-Type: application/json\r\nContent-Length: 63\r\n\r\n" +
+		`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`
+	REQUEST_BALANCE = "POST / HTTP/1.1\r\nHost: proxy\r\nContent-Type: application/json\r\nContent-Length: 65\r\n\r\n" +
+		`{"jsonrpc":"2.0","id":2,"method":"eth_getBalance","params":["a"]}`
+	RESPONSE_BLOCK_NUMBER = "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 42\r\n\r\n" +
+		`{"jsonrpc":"2.0","id":1,"result":"0x2a"}` + "\r\n"
+	RESPONSE_TWIN_BALANCE = "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 40\r\n\r\n" +
+		`{"jsonrpc":"2.0","id":2,"result":"0x5"}` + "\n"
+	RESPONSE_HONEST_BALANCE = "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"27\r\n" + `{"jsonrpc":"2.0","id":2,"result":"0x0"}` + "\r\n0\r\n\r\n"
+)
+
+//------------------------------------------------------------------------------
+// Helpers
+//------------------------------------------------------------------------------
+
+// openTestRecorder opens a recorder in a temporary directory.
+func openTestRecorder(t *testing.T) (*Recorder, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "exchanges.jsonl")
+	recorder, err := Open(path)
+	if err != nil {
+		t.Fatal("Error opening recorder:", err)
+	}
+	t.Cleanup(func() { recorder.Close() })
+	return recorder, path
+}
+
+// readExchanges returns the exchanges recorded in the file.
+func readExchanges(t *testing.T, path string) []Exchange {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal("Error opening record file:", err)
+	}
+	defer file.Close()
+	var exchanges []Exchange
+	scanner := bufio.NewScanner(file)
+	// the bodies recorded take up to MAX_BODY_SIZE bytes, escaped
+	scanner.Buffer(nil, 4*MAX_BODY_SIZE)
+	for scanner.Scan() {
+		var exchange Exchange
+		err := json.Unmarshal(scanner.Bytes(), &exchange)
+		if err != nil {
+			t.Fatal("Error decoding exchange:", err)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal("Error reading record file:", err)
+	}
+	return exchanges
+}
+
+// write writes the data in chunks of a few bytes, as they may be forwarded.
+func write(w io.Writer, data string) {
+	for len(data) > 0 {
+		n := 7
+		if n > len(data) {
+			n = len(data)
+		}
+		w.Write([]byte(data[:n]))
+		data = data[n:]
+	}
+}
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+// TestRecordExchanges tests that the requests of a keep-alive connection are
+// recorded in order with the responses of every node.
+func TestRecordExchanges(t *testing.T) {
+	recorder, path := openTestRecorder(t)
+	session := recorder.NewSession(nil, 3, "10.0.0.1:40000", 7, []string{"twin:8545", "honest:8545"}, "twin:8545")
+	write(session.Requests(), REQUEST_BLOCK_NUMBER)
+	write(session.Responses(1), RESPONSE_BLOCK_NUMBER)
+	write(session.TeeResponses(0, io.Discard), RESPONSE_BLOCK_NUMBER)
+	write(session.Requests(), REQUEST_BALANCE)
+	write(session.Responses(0), RESPONSE_TWIN_BALANCE)
+	write(session.Responses(1), RESPONSE_HONEST_BALANCE)
+	session.Close()
+	exchanges := readExchanges(t, path)
+	if len(exchanges) != 2 {
+		t.Fatal("Error recording exchanges: expected 2, got", len(exchanges))
+	}
+	first, second := exchanges[0], exchanges[1]
+	if first.SessionID != 3 || first.ClientAddr != "10.0.0.1:40000" || first.ConfigVersion != 7 || first.Method != "POST" || first.Path != "/" {
+		t.Error("Error recording exchange fields:", first)
+	}
+	if first.RPCMethod != "eth_blockNumber" || second.RPCMethod != "eth_getBalance" {
+		t.Error("Error recording JSON-RPC methods:", first.RPCMethod, second.RPCMethod)
+	}
+	if first.Divergent || first.ReturnedNodeAddr != "twin:8545" || !first.Responses[0].Returned || first.Responses[1].Returned {
+		t.Error("Error recording first exchange:", first)
+	}
+	if !second.Divergent || string(second.Responses[0].Body) != `{"jsonrpc":"2.0","id":2,"result":"0x5"}` || string(second.Responses[1].Body) != `{"jsonrpc":"2.0","id":2,"result":"0x0"}` {
+		t.Error("Error recording second exchange:", second)
+	}
+	for _, response := range append(first.Responses, second.Responses...) {
+		if response.Status != 200 || response.Error != "" || response.LatencyMs < 0 {
+			t.Error("Error recording response:", response)
+		}
+	}
+}
+
+// TestRecordMissingResponse tests that an exchange is recorded at the end of
+// the session if a node did not respond.
+func TestRecordMissingResponse(t *testing.T) {
+	recorder, path := openTestRecorder(t)
+	session := recorder.NewSession(nil, 1, "10.0.0.1:40000", 1, []string{"twin:8545", "honest:8545"}, "twin:8545")
+	write(session.Requests(), REQUEST_BLOCK_NUMBER)
+	write(session.Responses(0), RESPONSE_BLOCK_NUMBER)
+	session.Close()
+	exchanges := readExchanges(t, path)
+	if len(exchanges) != 1 {
+		t.Fatal("Error recording exchanges: expected 1, got", len(exchanges))
+	}
+	responses := exchanges[0].Responses
+	if responses[0].Error != "" || responses[1].Error != ERROR_NO_RESPONSE || exchanges[0].Divergent {
+		t.Error("Error recording missing response:", responses)
+	}
+}
+
+// TestRecordNotHTTP tests that a session whose traffic is not HTTP records
+// nothing and does not block the forwarding.
+func TestRecordNotHTTP(t *testing.T) {
+	recorder, path := openTestRecorder(t)
+	session := recorder.NewSession(nil, 1, "10.0.0.1:40000", 1, []string{"twin:8545"}, "twin:8545")
+	write(session.Requests(), "\x00\x01 not http at all\r\n\r\n")
+	write(session.Responses(0), "\x00\x02")
+	session.Close()
+	if exchanges := readExchanges(t, path); len(exchanges) != 0 {
+		t.Error("Error recording non-HTTP traffic:", exchanges)
+	}
+}
+
+// TestRecordTruncatedBody tests that a large body is truncated in the record
+// and that the next exchange is still recorded.
+func TestRecordTruncatedBody(t *testing.T) {
+	recorder, path := openTestRecorder(t)
+	session := recorder.NewSession(nil, 1, "10.0.0.1:40000", 1, []string{"twin:8545"}, "twin:8545")
+	large := strings.Repeat("x", MAX_BODY_SIZE+1)
+	session.Requests().Write([]byte(REQUEST_BLOCK_NUMBER))
+	session.Responses(0).Write([]byte(fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(large), large)))
+	session.Requests().Write([]byte(REQUEST_BALANCE))
+	session.Responses(0).Write([]byte(RESPONSE_TWIN_BALANCE))
+	session.Close()
+	exchanges := readExchanges(t, path)
+	if len(exchanges) != 2 {
+		t.Fatal("Error recording exchanges: expected 2, got", len(exchanges))
+	}
+	first, second := exchanges[0].Responses[0], exchanges[1].Responses[0]
+	var body string
+	json.Unmarshal(first.Body, &body)
+	if !first.Truncated || len(body) != MAX_BODY_SIZE {
+		t.Error("Error truncating the body: truncated", first.Truncated, "with", len(body), "bytes")
+	}
+	if second.Truncated || string(second.Body) != `{"jsonrpc":"2.0","id":2,"result":"0x5"}` {
+		t.Error("Error recording the exchange after a truncated body:", second)
+	}
+}
+
+// TestRecordBufferOverflow tests that the recording of the responses stops if
+// their parser is too far behind, without blocking the forwarding.
+func TestRecordBufferOverflow(t *testing.T) {
+	recorder, path := openTestRecorder(t)
+	session := recorder.NewSession(nil, 1, "10.0.0.1:40000", 1, []string{"twin:8545"}, "twin:8545")
+	// the responses are not parsed until their request is received
+	chunk := make([]byte, MAX_BUFFER_SIZE/2+1)
+	session.Responses(0).Write(chunk)
+	session.Responses(0).Write(chunk)
+	if b := session.responses[0]; !b.hasOverflowed() || len(b.data) != 0 {
+		t.Fatal("Error bounding the buffer:", len(b.data), "bytes kept")
+	}
+	session.Requests().Write([]byte(REQUEST_BLOCK_NUMBER))
+	session.Close()
+	exchanges := readExchanges(t, path)
+	if len(exchanges) != 1 || exchanges[0].Responses[0].Error != ERROR_NO_RESPONSE {
+		t.Error("Error recording the exchange after an overflow:", exchanges)
+	}
+}
+
+// TestBufferStamps tests that the data is stamped with the time it was
+// written, not the time it was parsed.
+func TestBufferStamps(t *testing.T) {
+	b := newBuffer()
+	b.Write([]byte("abc"))
+	first := time.Now()
+	time.Sleep(20 * time.Millisecond)
+	b.Write([]byte("def"))
+	b.close()
+	reader := bufio.NewReader(b)
+	data := make([]byte, 3)
+	io.ReadFull(reader, data)
+	if stamp := b.consumed(reader); stamp.After(first) {
+		t.Error("Error stamping the data: first write stamped", stamp.Sub(first), "late")
+	}
+	io.ReadFull(reader, data)
+	if stamp := b.consumed(reader); !stamp.After(first) {
+		t.Error("Error stamping the data: second write stamped before the first")
+	}
+}
+
+// TestNilRecorder tests that a nil recorder records nothing.
+func TestNilRecorder(t *testing.T) {
+	var recorder *Recorder
+	session := recorder.NewSession(nil, 1, "10.0.0.1:40000", 1, []string{"twin:8545"}, "twin:8545")
+	write(session.Requests(), REQUEST_BLOCK_NUMBER)
+	write(session.Responses(0), RESPONSE_BLOCK_NUMBER)
+	if session.TeeResponses(0, io.Discard) != io.Discard {
+		t.Error("Error using nil session")
+	}
+	session.Close()
+}
@@ -0,0 +1,398 @@
+package record
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to parse the HTTP exchanges of a
+client session from the data forwarded by the proxy.
+*/
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"semester-project/proxy/logs"
+	"sync"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A Session parses the requests sent by a client and the responses of the
+// nodes, and records every request with the responses of all nodes once they
+// have all responded, in the order of the requests. The n-th response of a
+// node is the response to the n-th request, as in HTTP/1.x.
+// It is thread-safe.
+type Session struct {
+	recorder *Recorder
+	logger   *logs.Logger
+	// base holds the fields shared by the exchanges of the session.
+	base      Exchange
+	nodeAddrs []string
+	lock      sync.Mutex
+	cond      *sync.Cond
+	exchanges []*pending
+	// written is the number of exchanges written.
+	written int
+	// requestsDone is true once no more requests are parsed.
+	requestsDone bool
+	requests     *buffer
+	responses    []*buffer
+	parsers      sync.WaitGroup
+}
+
+// pending is an exchange waiting for the responses of the nodes.
+type pending struct {
+	exchange Exchange
+	method   string
+	answered int
+}
+
+// buffer is the data forwarded in a direction, read by a parser. It never
+// blocks the writer, and drops the data once the parser stopped or if the
+// parser falls more than MAX_BUFFER_SIZE bytes behind.
+type buffer struct {
+	lock sync.Mutex
+	cond *sync.Cond
+	data []byte
+	// read is the number of bytes read by the parser.
+	read int64
+	// stamps are the times the data not consumed by the parser was written.
+	stamps     []stamp
+	written    int64
+	closed     bool
+	stopped    bool
+	overflowed bool
+}
+
+// A stamp is the time the data up to an offset of a buffer was written.
+type stamp struct {
+	end  int64
+	time time.Time
+}
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// ERROR_NO_RESPONSE is the error of the nodes that did not respond before the
+// end of the session.
+const ERROR_NO_RESPONSE = "no response"
+
+// MAX_BODY_SIZE is the size, in bytes, above which the bodies are truncated
+// in the record.
+const MAX_BODY_SIZE = 1 << 20
+
+// MAX_BUFFER_SIZE is the size, in bytes, of the data waiting to be parsed
+// above which the recording of a direction of the session stops.
+const MAX_BUFFER_SIZE = 4 << 20
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// newBuffer creates and returns a new buffer.
+func newBuffer() *buffer {
+	b := &buffer{}
+	b.cond = sync.NewCond(&b.lock)
+	return b
+}
+
+// Write appends the data to the buffer with the time it was written, unless
+// the parser stopped. If the parser is too far behind, it is stopped.
+func (b *buffer) Write(data []byte) (int, error) {
+	now := time.Now()
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed || b.stopped || len(data) == 0 {
+		return len(data), nil
+	}
+	if len(b.data)+len(data) > MAX_BUFFER_SIZE {
+		b.overflowed = true
+		b.stopped = true
+		b.data = nil
+		b.stamps = nil
+		b.cond.Broadcast()
+		return len(data), nil
+	}
+	b.data = append(b.data, data...)
+	b.written += int64(len(data))
+	b.stamps = append(b.stamps, stamp{end: b.written, time: now})
+	b.cond.Signal()
+	return len(data), nil
+}
+
+// Read reads the data of the buffer, waiting for data until the buffer is
+// closed.
+func (b *buffer) Read(data []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for len(b.data) == 0 && !b.closed && !b.stopped {
+		b.cond.Wait()
+	}
+	if len(b.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(data, b.data)
+	b.data = b.data[n:]
+	if len(b.data) == 0 {
+		b.data = nil
+	}
+	b.read += int64(n)
+	return n, nil
+}
+
+// consumed returns the time the data consumed by the parser, i.e. read from
+// the buffer but not buffered by the reader, was written. The stamps of the
+// data consumed are dropped.
+func (b *buffer) consumed(reader *bufio.Reader) time.Time {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	offset := b.read - int64(reader.Buffered())
+	for len(b.stamps) > 1 && b.stamps[0].end < offset {
+		b.stamps = b.stamps[1:]
+	}
+	if len(b.stamps) == 0 {
+		return time.Now()
+	}
+	return b.stamps[0].time
+}
+
+// hasOverflowed returns true if the parser was stopped because it was too
+// far behind.
+func (b *buffer) hasOverflowed() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.overflowed
+}
+
+// stop drops the data of the buffer, when the parser cannot parse it.
+func (b *buffer) stop() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.stopped = true
+	b.data = nil
+	b.stamps = nil
+	b.cond.Broadcast()
+}
+
+// close marks the end of the data.
+func (b *buffer) close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = true
+	b.cond.Broadcast()
+}
+
+// isEOF returns true if the error is the end of the data, possibly in the
+// middle of a message.
+func isEOF(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// readBody reads the body, keeping at most MAX_BODY_SIZE bytes of it. It
+// returns true if the body was truncated.
+func readBody(body io.Reader) ([]byte, bool, error) {
+	data, err := io.ReadAll(io.LimitReader(body, MAX_BODY_SIZE))
+	if err != nil {
+		return nil, false, err
+	}
+	// the rest of the body is read to parse the next message
+	n, err := io.Copy(io.Discard, body)
+	return data, n > 0, err
+}
+
+// stopParsing stops the parser of the buffer after the error, and logs why
+// the data is not recorded, if it is not the end of the data.
+func (s *Session) stopParsing(b *buffer, err error, message string, args ...interface{}) {
+	if b.hasOverflowed() {
+		s.logger.Warning(message+", the parser is too far behind", args...)
+	} else if !isEOF(err) {
+		s.logger.Warning(message+", they are not HTTP", append(args, "error", err)...)
+	}
+	b.stop()
+}
+
+// parseRequests parses the requests of the client.
+func (s *Session) parseRequests() {
+	defer s.parsers.Done()
+	defer func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.requestsDone = true
+		s.cond.Broadcast()
+	}()
+	reader := bufio.NewReader(s.requests)
+	for {
+		request, err := http.ReadRequest(reader)
+		var body []byte
+		var truncated bool
+		if err == nil {
+			body, truncated, err = readBody(request.Body)
+		}
+		if err != nil {
+			s.stopParsing(s.requests, err, "Stopped recording the session")
+			return
+		}
+		exchange := s.base
+		exchange.Time = s.requests.consumed(reader)
+		exchange.Method = request.Method
+		exchange.Path = request.URL.RequestURI()
+		exchange.RPCMethod = rpcMethod(body)
+		exchange.Request = encodeBody(body)
+		exchange.RequestTruncated = truncated
+		exchange.Responses = make([]Response, len(s.nodeAddrs))
+		for i, nodeAddr := range s.nodeAddrs {
+			exchange.Responses[i] = Response{
+				NodeAddr: nodeAddr,
+				Returned: nodeAddr == exchange.ReturnedNodeAddr,
+				Error:    ERROR_NO_RESPONSE,
+			}
+		}
+		s.lock.Lock()
+		s.exchanges = append(s.exchanges, &pending{exchange: exchange, method: request.Method})
+		s.cond.Broadcast()
+		s.lock.Unlock()
+	}
+}
+
+// parseResponses parses the responses of the node.
+func (s *Session) parseResponses(node int) {
+	defer s.parsers.Done()
+	reader := bufio.NewReader(s.responses[node])
+	for n := 0; ; n++ {
+		// wait for the request of the response
+		s.lock.Lock()
+		for len(s.exchanges) <= n && !s.requestsDone {
+			s.cond.Wait()
+		}
+		if len(s.exchanges) <= n {
+			s.lock.Unlock()
+			s.responses[node].stop()
+			return
+		}
+		p := s.exchanges[n]
+		s.lock.Unlock()
+		response, err := http.ReadResponse(reader, &http.Request{Method: p.method})
+		var body []byte
+		var truncated bool
+		if err == nil {
+			body, truncated, err = readBody(response.Body)
+		}
+		if err != nil {
+			s.stopParsing(s.responses[node], err, "Stopped recording the responses of the node", "node", s.nodeAddrs[node])
+			return
+		}
+		received := s.responses[node].consumed(reader)
+		s.lock.Lock()
+		r := &p.exchange.Responses[node]
+		r.Status = response.StatusCode
+		r.Body = encodeBody(body)
+		r.Truncated = truncated
+		r.LatencyMs = float64(received.Sub(p.exchange.Time).Microseconds()) / 1000
+		r.Error = ""
+		p.answered++
+		s.flush(false)
+		s.lock.Unlock()
+	}
+}
+
+// flush writes the exchanges answered by all nodes, in order, or all the
+// exchanges left if all is true.
+// It must be called with the lock held.
+func (s *Session) flush(all bool) {
+	for s.written < len(s.exchanges) {
+		p := s.exchanges[s.written]
+		if !all && p.answered < len(s.nodeAddrs) {
+			return
+		}
+		p.exchange.Divergent = isDivergent(p.exchange.Responses)
+		err := s.recorder.Write(p.exchange)
+		if err != nil {
+			s.logger.Error("Error recording the exchange", "error", err)
+		}
+		// the exchange is not needed anymore
+		s.exchanges[s.written] = nil
+		s.written++
+	}
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// NewSession starts recording the exchanges of a client session forwarded to
+// the nodes, whose responses are returned by the response node if any. A nil
+// Recorder returns a nil Session, which records nothing.
+func (r *Recorder) NewSession(logger *logs.Logger, sessionID uint64, clientAddr string, configVersion uint64, nodeAddrs []string, responseNodeAddr string) *Session {
+	if r == nil {
+		return nil
+	}
+	s := &Session{
+		recorder: r,
+		logger:   logger,
+		base: Exchange{
+			SessionID:        sessionID,
+			ClientAddr:       clientAddr,
+			ConfigVersion:    configVersion,
+			ReturnedNodeAddr: responseNodeAddr,
+		},
+		nodeAddrs: nodeAddrs,
+		requests:  newBuffer(),
+		responses: make([]*buffer, len(nodeAddrs)),
+	}
+	s.cond = sync.NewCond(&s.lock)
+	s.parsers.Add(1 + len(nodeAddrs))
+	go s.parseRequests()
+	for i := range nodeAddrs {
+		s.responses[i] = newBuffer()
+		go s.parseResponses(i)
+	}
+	return s
+}
+
+// Requests returns the writer the data sent by the client is written to.
+func (s *Session) Requests() io.Writer {
+	if s == nil {
+		return io.Discard
+	}
+	return s.requests
+}
+
+// Responses returns the writer the data sent by the node is written to.
+func (s *Session) Responses(node int) io.Writer {
+	if s == nil {
+		return io.Discard
+	}
+	return s.responses[node]
+}
+
+// TeeResponses returns a writer writing to the writer of the responses of the
+// node, then to the writer. The responses are recorded before they reach the
+// client, which may end the session as soon as it receives them. If the
+// Session is nil, the writer is returned.
+func (s *Session) TeeResponses(node int, writer io.Writer) io.Writer {
+	if s == nil {
+		return writer
+	}
+	return io.MultiWriter(s.responses[node], writer)
+}
+
+// Close ends the session, once the data forwarded is parsed, and records the
+// exchanges left, without the responses that were not received.
+func (s *Session) Close() {
+	if s == nil {
+		return
+	}
+	s.requests.close()
+	for _, responses := range s.responses {
+		responses.close()
+	}
+	s.parsers.Wait()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.flush(true)
+}
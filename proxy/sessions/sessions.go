@@ -0,0 +1,128 @@
+package sessions
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the registry of the client sessions handled by
+the proxy.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"semester-project/wire"
+	"sort"
+	"sync"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A Registry keeps track of the live client sessions.
+// It is thread-safe.
+type Registry struct {
+	lock     sync.Mutex
+	nextID   uint64
+	sessions map[uint64]*entry
+}
+
+// entry is a registered session, with the connection to close to kill it.
+type entry struct {
+	session wire.ClientSession
+	conn    io.Closer
+}
+
+//------------------------------------------------------------------------------
+// Errors
+//------------------------------------------------------------------------------
+
+// ErrUnknownSession is returned when a session does not exist.
+var ErrUnknownSession = errors.New("unknown session")
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// NewRegistry creates and returns a new Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		sessions: make(map[uint64]*entry),
+	}
+}
+
+// Add registers a new session of the client using the given config, and
+// returns its ID. The connection is closed if the session is killed.
+func (r *Registry) Add(clientAddr string, config wire.Config, configVersion uint64, conn io.Closer) uint64 {
+	nodes := make([]string, len(config.Nodes))
+	for i, node := range config.Nodes {
+		nodes[i] = node.Addr
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.nextID++
+	r.sessions[r.nextID] = &entry{
+		session: wire.ClientSession{
+			ID:               r.nextID,
+			ClientAddr:       clientAddr,
+			Nodes:            nodes,
+			ResponseNodeAddr: config.ResponseNodeAddr,
+			ConfigVersion:    configVersion,
+			StartTime:        time.Now(),
+		},
+		conn: conn,
+	}
+	return r.nextID
+}
+
+// Remove unregisters the session with the given ID.
+func (r *Registry) Remove(id uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.sessions, id)
+}
+
+// AddBytes adds n bytes forwarded in the given direction to the counters of
+// the session with the given ID.
+func (r *Registry) AddBytes(id uint64, direction string, n int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	entry, ok := r.sessions[id]
+	if !ok {
+		return
+	}
+	switch direction {
+	case wire.DirectionToNode:
+		entry.session.BytesToNodes += uint64(n)
+	case wire.DirectionToClient:
+		entry.session.BytesToClient += uint64(n)
+	}
+}
+
+// Kill closes the connection of the client of the session with the given ID,
+// which ends the session.
+func (r *Registry) Kill(id uint64) error {
+	r.lock.Lock()
+	entry, ok := r.sessions[id]
+	r.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownSession, id)
+	}
+	return entry.conn.Close()
+}
+
+// List returns a copy of the live sessions, ordered by ID.
+func (r *Registry) List() []wire.ClientSession {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	list := make([]wire.ClientSession, 0, len(r.sessions))
+	for _, entry := range r.sessions {
+		list = append(list, entry.session)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
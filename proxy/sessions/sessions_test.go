@@ -0,0 +1,57 @@
+package sessions
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the registry of the client
+sessions.
+*/
+
+import (
+	"errors"
+	"io"
+	"net"
+	"semester-project/wire"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	config := wire.Config{
+		Nodes:            []wire.Node{{Addr: "127.0.0.1:8545"}, {Addr: "127.0.0.1:8546"}},
+		ResponseNodeAddr: "127.0.0.1:8546",
+	}
+	clientConn, proxyConn := net.Pipe()
+	defer clientConn.Close()
+	id := registry.Add("127.0.0.1:40000", config, 3, proxyConn)
+	registry.AddBytes(id, wire.DirectionToNode, 10)
+	registry.AddBytes(id, wire.DirectionToNode, 5)
+	registry.AddBytes(id, wire.DirectionToClient, 7)
+	list := registry.List()
+	if len(list) != 1 {
+		t.Fatal("Error listing sessions: expected 1 session, got", len(list))
+	}
+	session := list[0]
+	if session.ID != id || len(session.Nodes) != 2 || session.ResponseNodeAddr != "127.0.0.1:8546" || session.ConfigVersion != 3 {
+		t.Error("Error listing sessions: got", session)
+	}
+	if session.BytesToNodes != 15 || session.BytesToClient != 7 {
+		t.Errorf("Error counting bytes: got %d to nodes and %d to client", session.BytesToNodes, session.BytesToClient)
+	}
+	// killing the session closes the connection of the client
+	err := registry.Kill(id)
+	if err != nil {
+		t.Fatal("Error killing session:", err)
+	}
+	if _, err := proxyConn.Write([]byte("x")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Error("Error killing session: connection still open:", err)
+	}
+	registry.Remove(id)
+	if err := registry.Kill(id); !errors.Is(err, ErrUnknownSession) {
+		t.Error("Error killing removed session: expected ErrUnknownSession, got", err)
+	}
+}
@@ -0,0 +1,235 @@
+package trigger
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to evaluate the triggers of the proxy
+configuration and apply their target config.
+*/
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"semester-project/proxy/configuration"
+	"semester-project/proxy/events"
+	"semester-project/proxy/logs"
+	"semester-project/wire"
+	"semester-project/wire/chains"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A Watcher evaluates the triggers of the current config and applies the
+// target config of the first trigger whose condition is met.
+// It is thread-safe.
+type Watcher struct {
+	configManager *configuration.ConfigManager
+	logger        *logs.Logger
+	events        *events.Bus
+	interval      time.Duration
+	// current is the snapshot of the triggers of the current config. It is
+	// replaced when the triggers of the config change, so that the data sent
+	// by the clients is matched without locking the config.
+	current atomic.Pointer[snapshot]
+	// lock serializes the configs applied by the triggers.
+	lock sync.Mutex
+}
+
+// A snapshot is the triggers of a config, with the ones that already fired.
+type snapshot struct {
+	triggers []wire.Trigger
+	// queries are the client-query triggers, with their address in lower
+	// case.
+	queries   []query
+	maxLength int
+	lock      sync.Mutex
+	fired     map[string]bool
+}
+
+// A query is a client-query trigger.
+type query struct {
+	trigger wire.Trigger
+	address []byte
+}
+
+// An observer matches the client-query triggers on the data sent by a client.
+type observer struct {
+	watcher *Watcher
+	// tail is the end of the data already observed, so that an address split
+	// between two writes is matched.
+	tail []byte
+}
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// newSnapshot creates and returns the snapshot of the triggers.
+func newSnapshot(triggers []wire.Trigger) *snapshot {
+	s := &snapshot{
+		triggers: triggers,
+		fired:    make(map[string]bool),
+	}
+	for _, trigger := range triggers {
+		if trigger.Condition.Kind != wire.ConditionClientQuery || trigger.Condition.Address == "" {
+			continue
+		}
+		address := bytes.ToLower([]byte(trigger.Condition.Address))
+		s.queries = append(s.queries, query{trigger: trigger, address: address})
+		if len(address) > s.maxLength {
+			s.maxLength = len(address)
+		}
+	}
+	return s
+}
+
+// hasFired returns true if the trigger already fired.
+func (s *snapshot) hasFired(name string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.fired[name]
+}
+
+// markFired marks the trigger as fired, and returns false if it already
+// fired.
+func (s *snapshot) markFired(name string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.fired[name] {
+		return false
+	}
+	s.fired[name] = true
+	return true
+}
+
+// update replaces the snapshot if the triggers of the config changed, which
+// resets the fired triggers.
+// It is called by the ConfigManager with the config lock held.
+func (w *Watcher) update(config configuration.Config) {
+	if current := w.current.Load(); current != nil && reflect.DeepEqual(config.Triggers, current.triggers) {
+		return
+	}
+	w.current.Store(newSnapshot(config.Triggers))
+}
+
+// fire applies the target config of the trigger, unless it already fired or
+// the triggers changed since it was matched.
+func (w *Watcher) fire(s *snapshot, trigger wire.Trigger) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.current.Load() != s || !s.markFired(trigger.Name) {
+		return
+	}
+	w.logger.Info("Trigger fired", "trigger", trigger.Name, "condition", trigger.Condition.String())
+	version, err := w.configManager.UpdateConfig(trigger.Target, configuration.Origin{Source: "trigger " + trigger.Name})
+	if err != nil {
+		w.logger.Error("Error applying target config of trigger", "trigger", trigger.Name, "error", err)
+		return
+	}
+	w.logger.Info("Configuration updated", "version", version, "trigger", trigger.Name)
+	w.events.Publish(wire.Event{
+		Kind:          wire.EventConfigApplied,
+		ConfigVersion: version,
+		Source:        "trigger " + trigger.Name,
+	})
+}
+
+// evaluate returns true if the condition of a polled trigger is met.
+func (w *Watcher) evaluate(condition wire.Condition) bool {
+	switch condition.Kind {
+	case wire.ConditionBlockHeight:
+		height, err := chains.BlockHeight(condition.Chain, condition.NodeAddr, condition.Token)
+		if err != nil {
+			w.logger.Warning("Error getting block height", "node", condition.NodeAddr, "error", err)
+			return false
+		}
+		return height >= condition.Height
+	case wire.ConditionTxIncluded:
+		included, err := chains.TxIncluded(condition.Chain, condition.NodeAddr, condition.Token, condition.TxID)
+		if err != nil {
+			w.logger.Warning("Error getting transaction", "node", condition.NodeAddr, "error", err)
+			return false
+		}
+		return included
+	default:
+		return false
+	}
+}
+
+// poll evaluates the polled triggers of the current config.
+func (w *Watcher) poll() {
+	s := w.current.Load()
+	for _, trigger := range s.triggers {
+		if trigger.Condition.Kind == wire.ConditionClientQuery || s.hasFired(trigger.Name) {
+			continue
+		}
+		if w.evaluate(trigger.Condition) {
+			w.fire(s, trigger)
+			// the config changed, the other triggers no longer apply
+			return
+		}
+	}
+}
+
+// Write matches the client-query triggers of the current config on the data.
+// The triggers matched are fired in the background, so that the data is
+// forwarded without waiting for the config to be applied.
+func (o *observer) Write(data []byte) (int, error) {
+	s := o.watcher.current.Load()
+	if len(s.queries) == 0 {
+		o.tail = nil
+		return len(data), nil
+	}
+	window := append(o.tail, bytes.ToLower(data)...)
+	for _, q := range s.queries {
+		if bytes.Contains(window, q.address) && !s.hasFired(q.trigger.Name) {
+			go o.watcher.fire(s, q.trigger)
+			break
+		}
+	}
+	if keep := s.maxLength - 1; len(window) > keep {
+		window = window[len(window)-keep:]
+	}
+	o.tail = append(o.tail[:0], window...)
+	return len(data), nil
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// NewWatcher creates and returns a new Watcher polling the nodes at the given
+// interval. The configs applied by the triggers are published on the bus, if
+// any.
+func NewWatcher(configManager *configuration.ConfigManager, logger *logs.Logger, bus *events.Bus, interval time.Duration) *Watcher {
+	w := &Watcher{
+		configManager: configManager,
+		logger:        logger,
+		events:        bus,
+		interval:      interval,
+	}
+	configManager.OnChange(w.update)
+	return w
+}
+
+// Run polls the nodes and evaluates the triggers until the program exits.
+func (w *Watcher) Run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		w.poll()
+	}
+}
+
+// NewObserver returns a writer matching the client-query triggers on the data
+// sent by a client, one per session. Addresses are matched
+// case-insensitively, even if they are split between two writes.
+func (w *Watcher) NewObserver() io.Writer {
+	return &observer{watcher: w}
+}
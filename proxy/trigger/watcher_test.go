@@ -0,0 +1,153 @@
+package trigger
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the triggers watcher.
+*/
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"semester-project/proxy/configuration"
+	"semester-project/proxy/logs"
+	"semester-project/wire"
+	"strings"
+	"testing"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Helpers
+//------------------------------------------------------------------------------
+
+// newTestWatcher creates a watcher whose config has the given triggers.
+func newTestWatcher(t *testing.T, nodeAddr string, triggers []wire.Trigger) (*Watcher, *configuration.ConfigManager) {
+	t.Helper()
+	_, logger, err := logs.GetLoggers(logs.Options{Path: os.DevNull})
+	if err != nil {
+		t.Fatal("Error getting loggers:", err)
+	}
+	configManager := configuration.NewConfigManager()
+	err = configManager.SetConfig(wire.Config{
+		Nodes:            []wire.Node{{Addr: nodeAddr}},
+		ResponseNodeAddr: nodeAddr,
+		Triggers:         triggers,
+	})
+	if err != nil {
+		t.Fatal("Error setting config:", err)
+	}
+	return NewWatcher(configManager, logger, nil, time.Second), configManager
+}
+
+// waitForResponseNode returns true if the response node of the config becomes
+// the given node before the timeout.
+func waitForResponseNode(configManager *configuration.ConfigManager, nodeAddr string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if configManager.GetConfig().ResponseNodeAddr == nodeAddr {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// twinTarget is the target config used by the tests.
+var twinTarget = wire.Config{
+	Nodes:            []wire.Node{{Addr: "127.0.0.1:8002"}},
+	ResponseNodeAddr: "127.0.0.1:8002",
+}
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestBlockHeightTrigger(t *testing.T) {
+	height := "0x9"
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"` + height + `"}`))
+	}))
+	defer node.Close()
+	nodeAddr := strings.TrimPrefix(node.URL, "http://")
+	watcher, configManager := newTestWatcher(t, nodeAddr, []wire.Trigger{{
+		Name:      "height",
+		Condition: wire.Condition{Kind: wire.ConditionBlockHeight, Chain: wire.ChainQuorum, NodeAddr: nodeAddr, Height: 10},
+		Target:    twinTarget,
+	}})
+	watcher.poll()
+	if config := configManager.GetConfig(); config.ResponseNodeAddr != nodeAddr {
+		t.Fatal("Error polling: trigger fired before the height was reached")
+	}
+	height = "0xa"
+	watcher.poll()
+	if config := configManager.GetConfig(); config.ResponseNodeAddr != twinTarget.ResponseNodeAddr {
+		t.Error("Error polling: trigger did not fire once the height was reached")
+	}
+}
+
+func TestClientQueryTrigger(t *testing.T) {
+	watcher, configManager := newTestWatcher(t, "127.0.0.1:8001", []wire.Trigger{{
+		Name:      "query",
+		Condition: wire.Condition{Kind: wire.ConditionClientQuery, Address: "0xB0B"},
+		Target:    twinTarget,
+	}})
+	observer := watcher.NewObserver()
+	observer.Write([]byte(`{"method":"eth_getBalance","params":["0xabc"]}`))
+	if waitForResponseNode(configManager, twinTarget.ResponseNodeAddr, 100*time.Millisecond) {
+		t.Fatal("Error observing client data: trigger fired on another address")
+	}
+	observer.Write([]byte(`{"method":"eth_getBalance","params":["0xb0b"]}`))
+	if !waitForResponseNode(configManager, twinTarget.ResponseNodeAddr, time.Second) {
+		t.Error("Error observing client data: trigger did not fire")
+	}
+}
+
+func TestClientQuerySplitAddress(t *testing.T) {
+	watcher, configManager := newTestWatcher(t, "127.0.0.1:8001", []wire.Trigger{{
+		Name:      "query",
+		Condition: wire.Condition{Kind: wire.ConditionClientQuery, Address: "0xB0B"},
+		Target:    twinTarget,
+	}})
+	// the address is split between the writes of one session only
+	observer := watcher.NewObserver()
+	observer.Write([]byte(`{"params":["0x`))
+	watcher.NewObserver().Write([]byte(`b0b"]}`))
+	if waitForResponseNode(configManager, twinTarget.ResponseNodeAddr, 100*time.Millisecond) {
+		t.Fatal("Error observing client data: trigger fired on the data of two sessions")
+	}
+	observer.Write([]byte(`b`))
+	observer.Write([]byte(`0b"]}`))
+	if !waitForResponseNode(configManager, twinTarget.ResponseNodeAddr, time.Second) {
+		t.Error("Error observing client data: split address not matched")
+	}
+}
+
+func TestTriggersReset(t *testing.T) {
+	triggers := []wire.Trigger{{
+		Name:      "query",
+		Condition: wire.Condition{Kind: wire.ConditionClientQuery, Address: "0xb0b"},
+		Target:    twinTarget,
+	}}
+	watcher, configManager := newTestWatcher(t, "127.0.0.1:8001", triggers)
+	watcher.NewObserver().Write([]byte("0xb0b"))
+	if !waitForResponseNode(configManager, twinTarget.ResponseNodeAddr, time.Second) {
+		t.Fatal("Error observing client data: trigger did not fire")
+	}
+	// the trigger fires again once its config is applied again
+	err := configManager.SetConfig(wire.Config{
+		Nodes:            []wire.Node{{Addr: "127.0.0.1:8001"}},
+		ResponseNodeAddr: "127.0.0.1:8001",
+		Triggers:         triggers,
+	})
+	if err != nil {
+		t.Fatal("Error setting config:", err)
+	}
+	watcher.NewObserver().Write([]byte("0xb0b"))
+	if !waitForResponseNode(configManager, twinTarget.ResponseNodeAddr, time.Second) {
+		t.Error("Error observing client data: trigger did not fire after the config changed")
+	}
+}
@@ -47,6 +47,11 @@ export() {
         scripts/ \
         --exclude 'local/' \
         ${HOST}:~/scripts
+      # Export wire schema shared by the controller and the proxy
+      ssh -p $((PORT + i)) ${HOST} 'mkdir -p ~/go/src/wire'
+      rsync -rav -e "ssh -p $((PORT + i))" \
+        wire/ \
+        ${HOST}:~/go/src/wire
       # Export controller
       ssh -p $((PORT + i)) ${HOST} 'mkdir -p ~/go/src/controller'
       rsync -rav -e "ssh -p $((PORT + i))" \
@@ -0,0 +1,174 @@
+package wire
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to sign and verify the messages sent by
+the controller, with a secret key shared with the proxy.
+*/
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// An Auth authenticates a message.
+// The MAC is the hex-encoded HMAC-SHA256 of the message, including the
+// identity, the nonce and the timestamp, with the key of the identity. The
+// nonce and the timestamp allow the proxy to reject replayed messages.
+type Auth struct {
+	Identity  string `json:"identity"`
+	Nonce     string `json:"nonce"`
+	Timestamp int64  `json:"timestamp"`
+	MAC       string `json:"mac"`
+}
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// HTTP_AUTH_SCHEME is the scheme of the Authorization header of the HTTP
+// requests signed like the messages, e.g. the requests of the admin API of
+// the proxy.
+const HTTP_AUTH_SCHEME = "Twins-HMAC"
+
+//------------------------------------------------------------------------------
+// Errors
+//------------------------------------------------------------------------------
+
+// ErrUnsigned is returned when a message carries no authentication.
+var ErrUnsigned = errors.New("message is not signed")
+
+// ErrBadSignature is returned when the MAC of a message does not match.
+var ErrBadSignature = errors.New("bad message signature")
+
+// ErrMalformedAuthHeader is returned when an Authorization header cannot be
+// parsed.
+var ErrMalformedAuthHeader = errors.New("malformed authorization header")
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// mac computes the MAC of the message with the key.
+func (m *Message) mac(key []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, field := range []string{
+		strconv.Itoa(m.Version),
+		m.ID,
+		m.Type,
+		m.Auth.Identity,
+		m.Auth.Nonce,
+		strconv.FormatInt(m.Auth.Timestamp, 10),
+	} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	h.Write(m.Payload)
+	return h.Sum(nil)
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// Sign authenticates the message as sent by the identity, with its key.
+// The message must not be modified after being signed.
+func (m *Message) Sign(identity string, key []byte) error {
+	// the payload is compacted when encoded, so it must be signed compacted
+	if len(m.Payload) > 0 {
+		var payload bytes.Buffer
+		err := json.Compact(&payload, m.Payload)
+		if err != nil {
+			return err
+		}
+		m.Payload = payload.Bytes()
+	}
+	nonce := make([]byte, 16)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+	m.Auth = &Auth{
+		Identity:  identity,
+		Nonce:     hex.EncodeToString(nonce),
+		Timestamp: time.Now().Unix(),
+	}
+	m.Auth.MAC = hex.EncodeToString(m.mac(key))
+	return nil
+}
+
+// VerifySignature checks that the message was signed with the key.
+// It does not check the freshness of the message.
+func (m *Message) VerifySignature(key []byte) error {
+	if m.Auth == nil {
+		return ErrUnsigned
+	}
+	mac, err := hex.DecodeString(m.Auth.MAC)
+	if err != nil || !hmac.Equal(mac, m.mac(key)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// NewRequestMessage returns the message signed to authenticate an HTTP
+// request. Its type is the method and the URI of the request, and its payload
+// the SHA-256 of the body, so that the body is signed as it was sent.
+func NewRequestMessage(method string, uri string, body []byte) Message {
+	sum := sha256.Sum256(body)
+	payload, _ := json.Marshal(hex.EncodeToString(sum[:]))
+	return Message{Version: SchemaVersion, Type: method + " " + uri, Payload: payload}
+}
+
+// Header returns the value of the Authorization header of an HTTP request
+// signed with the authentication, e.g.
+// Twins-HMAC identity="team-a", nonce="...", timestamp="...", mac="...".
+func (a *Auth) Header() string {
+	return fmt.Sprintf("%s identity=%q, nonce=%q, timestamp=%q, mac=%q",
+		HTTP_AUTH_SCHEME, a.Identity, a.Nonce, strconv.FormatInt(a.Timestamp, 10), a.MAC)
+}
+
+// ParseAuthHeader parses the value of the Authorization header of a signed
+// HTTP request.
+func ParseAuthHeader(header string) (*Auth, error) {
+	params, ok := strings.CutPrefix(header, HTTP_AUTH_SCHEME+" ")
+	if !ok {
+		return nil, ErrUnsigned
+	}
+	values := make(map[string]string)
+	for params = strings.TrimSpace(params); params != ""; {
+		name, rest, ok := strings.Cut(params, "=")
+		if !ok {
+			return nil, ErrMalformedAuthHeader
+		}
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return nil, ErrMalformedAuthHeader
+		}
+		values[strings.TrimSpace(name)], _ = strconv.Unquote(quoted)
+		params = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rest[len(quoted):]), ","))
+	}
+	timestamp, err := strconv.ParseInt(values["timestamp"], 10, 64)
+	if err != nil || values["identity"] == "" || values["nonce"] == "" || values["mac"] == "" {
+		return nil, ErrMalformedAuthHeader
+	}
+	return &Auth{
+		Identity:  values["identity"],
+		Nonce:     values["nonce"],
+		Timestamp: timestamp,
+		MAC:       values["mac"],
+	}, nil
+}
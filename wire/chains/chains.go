@@ -0,0 +1,270 @@
+package chains
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to query the nodes of the chains
+behind the proxy and to send transactions to them.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"semester-project/wire"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A QuorumTx is a transaction known by a Quorum node.
+type QuorumTx struct {
+	From  string
+	To    string
+	Value *big.Int
+	// BlockNumber is the block including the transaction, or 0 if the
+	// transaction is pending.
+	BlockNumber uint64
+}
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// REQUEST_TIMEOUT is the timeout of a request to a node.
+const REQUEST_TIMEOUT = 5 * time.Second
+
+//------------------------------------------------------------------------------
+// Public variables
+//------------------------------------------------------------------------------
+
+// WEI_PER_ETHER is the number of wei in an ether.
+var WEI_PER_ETHER = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
+//------------------------------------------------------------------------------
+// Private variables
+//------------------------------------------------------------------------------
+
+// httpClient is the client used to query the nodes.
+var httpClient = &http.Client{Timeout: REQUEST_TIMEOUT}
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// quorumCall calls a JSON-RPC method on a Quorum node and decodes its result.
+func quorumCall(nodeAddr string, method string, params []interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Post("http://"+nodeAddr, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&reply)
+	if err != nil {
+		return err
+	}
+	if reply.Error != nil {
+		return errors.New(method + ": " + reply.Error.Message)
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+// algorandGet sends a GET request to the REST API of an Algorand node and
+// decodes its result. It returns false if the resource does not exist.
+func algorandGet(nodeAddr string, token string, path string, result interface{}) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://"+nodeAddr+path, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("X-Algo-API-Token", token)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return true, json.NewDecoder(resp.Body).Decode(result)
+}
+
+// parseHex parses a 0x prefixed hexadecimal quantity.
+func parseHex(quantity string) (*big.Int, error) {
+	value, ok := new(big.Int).SetString(strings.TrimPrefix(quantity, "0x"), 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid quantity %q", quantity)
+	}
+	return value, nil
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// BlockHeight returns the height of the chain of the node.
+// It uses eth_blockNumber for Quorum and /v2/status for Algorand.
+func BlockHeight(chain string, nodeAddr string, token string) (uint64, error) {
+	switch chain {
+	case wire.ChainQuorum:
+		var hexHeight string
+		err := quorumCall(nodeAddr, "eth_blockNumber", []interface{}{}, &hexHeight)
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseUint(strings.TrimPrefix(hexHeight, "0x"), 16, 64)
+	case wire.ChainAlgorand:
+		var status struct {
+			LastRound uint64 `json:"last-round"`
+		}
+		_, err := algorandGet(nodeAddr, token, "/v2/status", &status)
+		return status.LastRound, err
+	default:
+		return 0, errors.New("unknown chain: " + chain)
+	}
+}
+
+// TxIncluded returns true if the transaction is included in a block of the
+// chain of the node.
+// It uses eth_getTransactionReceipt for Quorum and
+// /v2/transactions/pending/<id> for Algorand.
+func TxIncluded(chain string, nodeAddr string, token string, txID string) (bool, error) {
+	switch chain {
+	case wire.ChainQuorum:
+		var receipt *struct {
+			BlockNumber string `json:"blockNumber"`
+		}
+		err := quorumCall(nodeAddr, "eth_getTransactionReceipt", []interface{}{txID}, &receipt)
+		if err != nil {
+			return false, err
+		}
+		return receipt != nil && receipt.BlockNumber != "", nil
+	case wire.ChainAlgorand:
+		var pending struct {
+			ConfirmedRound uint64 `json:"confirmed-round"`
+		}
+		found, err := algorandGet(nodeAddr, token, "/v2/transactions/pending/"+url.PathEscape(txID), &pending)
+		if err != nil || !found {
+			return false, err
+		}
+		return pending.ConfirmedRound > 0, nil
+	default:
+		return false, errors.New("unknown chain: " + chain)
+	}
+}
+
+// Balance returns the balance of the account, in wei for Quorum and in
+// microalgos for Algorand.
+// It uses eth_getBalance for Quorum and /v2/accounts/<address> for Algorand.
+func Balance(chain string, nodeAddr string, token string, address string) (*big.Int, error) {
+	switch chain {
+	case wire.ChainQuorum:
+		var hexBalance string
+		err := quorumCall(nodeAddr, "eth_getBalance", []interface{}{address, "latest"}, &hexBalance)
+		if err != nil {
+			return nil, err
+		}
+		return parseHex(hexBalance)
+	case wire.ChainAlgorand:
+		var account struct {
+			Amount uint64 `json:"amount"`
+		}
+		found, err := algorandGet(nodeAddr, token, "/v2/accounts/"+url.PathEscape(address), &account)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errors.New("unknown account: " + address)
+		}
+		return new(big.Int).SetUint64(account.Amount), nil
+	default:
+		return nil, errors.New("unknown chain: " + chain)
+	}
+}
+
+// SendTx sends a transaction of the given value, in wei, from an account
+// unlocked on the Quorum node. It returns the hash of the transaction.
+func SendTx(nodeAddr string, from string, to string, value *big.Int) (string, error) {
+	tx := map[string]string{
+		"from":  from,
+		"to":    to,
+		"value": "0x" + value.Text(16),
+	}
+	var hash string
+	err := quorumCall(nodeAddr, "eth_sendTransaction", []interface{}{tx}, &hash)
+	return hash, err
+}
+
+// Transaction returns the transaction with the given hash known by the Quorum
+// node, or nil if the node does not know it.
+// It uses eth_getTransactionByHash.
+func Transaction(nodeAddr string, hash string) (*QuorumTx, error) {
+	var tx *struct {
+		From        string  `json:"from"`
+		To          string  `json:"to"`
+		Value       string  `json:"value"`
+		BlockNumber *string `json:"blockNumber"`
+	}
+	err := quorumCall(nodeAddr, "eth_getTransactionByHash", []interface{}{hash}, &tx)
+	if err != nil || tx == nil {
+		return nil, err
+	}
+	value, err := parseHex(tx.Value)
+	if err != nil {
+		return nil, err
+	}
+	quorumTx := &QuorumTx{From: tx.From, To: tx.To, Value: value}
+	if tx.BlockNumber != nil {
+		quorumTx.BlockNumber, err = strconv.ParseUint(strings.TrimPrefix(*tx.BlockNumber, "0x"), 16, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return quorumTx, nil
+}
+
+// ParseEther parses a decimal amount of ether, e.g. 1.5, and returns it in
+// wei.
+func ParseEther(amount string) (*big.Int, error) {
+	ether, ok := new(big.Rat).SetString(amount)
+	if !ok || ether.Sign() < 0 {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	wei := ether.Mul(ether, new(big.Rat).SetInt(WEI_PER_ETHER))
+	if !wei.IsInt() {
+		return nil, fmt.Errorf("amount %q is smaller than a wei", amount)
+	}
+	return wei.Num(), nil
+}
+
+// FormatEther formats an amount of wei in ether.
+func FormatEther(wei *big.Int) string {
+	ether := new(big.Rat).SetFrac(wei, WEI_PER_ETHER)
+	text := strings.TrimRight(ether.FloatString(18), "0")
+	return strings.TrimSuffix(text, ".")
+}
@@ -0,0 +1,41 @@
+package chains
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the amounts of ether.
+*/
+
+import (
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestParseEther(t *testing.T) {
+	tests := map[string]string{
+		"1":                    "1000000000000000000",
+		"0.5":                  "500000000000000000",
+		"0.000000000000000001": "1",
+	}
+	for amount, expected := range tests {
+		wei, err := ParseEther(amount)
+		if err != nil {
+			t.Error("Error parsing the amount:", err)
+			continue
+		}
+		if wei.String() != expected {
+			t.Errorf("Error parsing %q: got %s wei, expected %s", amount, wei, expected)
+		}
+		if FormatEther(wei) != amount {
+			t.Errorf("Error formatting %s wei: got %q, expected %q", wei, FormatEther(wei), amount)
+		}
+	}
+	for _, amount := range []string{"-1", "abc", "0.0000000000000000001"} {
+		if _, err := ParseEther(amount); err == nil {
+			t.Errorf("Error parsing %q: expected an error", amount)
+		}
+	}
+}
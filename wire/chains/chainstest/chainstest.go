@@ -0,0 +1,114 @@
+package chainstest
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains a fake Quorum node for the tests of the chain
+queries.
+*/
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// fakeQuorum is a Quorum node whose accounts are unlocked and whose
+// transactions are included in the next block as soon as they are sent. Its
+// height grows by one at each query.
+type fakeQuorum struct {
+	lock         sync.Mutex
+	height       uint64
+	balances     map[string]*big.Int
+	transactions map[string]fakeTx
+}
+
+// fakeTx is a transaction sent to the fake Quorum node.
+type fakeTx struct {
+	from  string
+	to    string
+	value *big.Int
+	block uint64
+}
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// balance returns the balance of the address, zero if it is unknown.
+func (q *fakeQuorum) balance(address string) *big.Int {
+	if balance, ok := q.balances[address]; ok {
+		return balance
+	}
+	return new(big.Int)
+}
+
+func (q *fakeQuorum) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	var result interface{}
+	switch request.Method {
+	case "eth_blockNumber":
+		q.height++
+		result = "0x" + strconv.FormatUint(q.height, 16)
+	case "eth_getBalance":
+		var address string
+		json.Unmarshal(request.Params[0], &address)
+		result = "0x" + q.balance(address).Text(16)
+	case "eth_sendTransaction":
+		var params map[string]string
+		json.Unmarshal(request.Params[0], &params)
+		value, _ := new(big.Int).SetString(strings.TrimPrefix(params["value"], "0x"), 16)
+		tx := fakeTx{from: params["from"], to: params["to"], value: value, block: uint64(len(q.transactions) + 1)}
+		q.balances[tx.from] = new(big.Int).Sub(q.balance(tx.from), value)
+		q.balances[tx.to] = new(big.Int).Add(q.balance(tx.to), value)
+		hash := "0xhash" + strconv.Itoa(len(q.transactions))
+		q.transactions[hash] = tx
+		result = hash
+	case "eth_getTransactionReceipt", "eth_getTransactionByHash":
+		var hash string
+		json.Unmarshal(request.Params[0], &hash)
+		if tx, ok := q.transactions[hash]; ok {
+			result = map[string]string{
+				"from":        tx.from,
+				"to":          tx.to,
+				"value":       "0x" + tx.value.Text(16),
+				"blockNumber": "0x" + strconv.FormatUint(tx.block, 16),
+			}
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": result})
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// NewQuorum starts a fake Quorum node with the given balances, in wei, for
+// the duration of the test, and returns its address.
+// Its accounts are unlocked, its transactions are included in the next block
+// as soon as they are sent, and its height grows by one at each query.
+func NewQuorum(t *testing.T, balances map[string]*big.Int) string {
+	t.Helper()
+	q := &fakeQuorum{balances: make(map[string]*big.Int), transactions: make(map[string]fakeTx)}
+	for address, balance := range balances {
+		q.balances[address] = balance
+	}
+	server := httptest.NewServer(q)
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
@@ -0,0 +1,175 @@
+package wire
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the proxy configuration as exchanged between the
+controller and the proxy.
+*/
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A Node is a destination node for the proxy.
+type Node struct {
+	Addr string `json:"addr"`
+}
+
+// A Config is the configuration for the proxy.
+// It contains the list of destination nodes and the node to use for the
+// response, the triggers that switch the proxy to another config, and
+// whether the traffic of the client sessions is captured.
+type Config struct {
+	Nodes            []Node    `json:"nodes"`
+	ResponseNodeAddr string    `json:"responseNodeAddr"`
+	Triggers         []Trigger `json:"triggers,omitempty"`
+	Capture          *Capture  `json:"capture,omitempty"`
+}
+
+// A Capture enables the capture of the traffic of the client sessions, i.e.
+// of the client stream and of every node stream of each session.
+// Clients is the client profile: the IP addresses or CIDR prefixes, e.g.
+// 10.0.0.0/24, of the clients whose sessions are captured. If it is empty,
+// the sessions of all the clients are captured.
+type Capture struct {
+	Clients []string `json:"clients,omitempty"`
+}
+
+// A Trigger applies its target config once its condition is met.
+// The target config may contain triggers itself, which allows to chain flows.
+type Trigger struct {
+	Name      string    `json:"name"`
+	Condition Condition `json:"condition"`
+	Target    Config    `json:"target"`
+}
+
+// A Condition is an observation of the chains behind the proxy.
+// The fields used depend on the kind of the condition:
+//   - tx-included: Chain, NodeAddr, TxID (and Token for Algorand)
+//   - block-height: Chain, NodeAddr, Height (and Token for Algorand)
+//   - client-query: Address
+//
+// NodeAddr is the address of one of the nodes of the config, that is polled
+// to evaluate the condition.
+type Condition struct {
+	Kind     string `json:"kind"`
+	Chain    string `json:"chain,omitempty"`
+	NodeAddr string `json:"nodeAddr,omitempty"`
+	TxID     string `json:"txId,omitempty"`
+	Height   uint64 `json:"height,omitempty"`
+	Address  string `json:"address,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// Condition kinds.
+const (
+	// ConditionTxIncluded is met when the transaction is included in a block
+	// of the chain of the node.
+	ConditionTxIncluded = "tx-included"
+	// ConditionBlockHeight is met when the chain of the node reaches the
+	// height.
+	ConditionBlockHeight = "block-height"
+	// ConditionClientQuery is met when a client sends a request mentioning
+	// the address.
+	ConditionClientQuery = "client-query"
+)
+
+// Chains whose nodes can be polled.
+const (
+	ChainQuorum   = "quorum"
+	ChainAlgorand = "algorand"
+)
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// IsValid checks if the config is valid.
+// Use Validate to know why a config is not valid.
+func (c *Config) IsValid() bool {
+	report := c.Validate()
+	return report.OK()
+}
+
+func (c *Config) String() string {
+	str := "Config:\n"
+	str += "\tNodes:\n"
+	for _, node := range c.Nodes {
+		str += "\t\t" + node.Addr + "\n"
+	}
+	str += "\tUseResponseFrom: " + c.ResponseNodeAddr + "\n"
+	if len(c.Triggers) > 0 {
+		str += "\tTriggers:\n"
+		for _, trigger := range c.Triggers {
+			str += "\t\t" + trigger.Name + ": " + trigger.Condition.String() + "\n"
+		}
+	}
+	if c.Capture != nil {
+		str += "\tCapture: " + c.Capture.String() + "\n"
+	}
+	return str
+}
+
+// CapturesClient returns true if the sessions of the client, given by its
+// address, are captured. A nil Capture captures no session.
+func (c *Capture) CapturesClient(clientAddr string) bool {
+	if c == nil {
+		return false
+	}
+	if len(c.Clients) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(clientAddr)
+	if err != nil {
+		host = clientAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, client := range c.Clients {
+		if _, prefix, err := net.ParseCIDR(client); err == nil {
+			if prefix.Contains(ip) {
+				return true
+			}
+		} else if clientIP := net.ParseIP(client); clientIP != nil && clientIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the clients whose sessions are captured.
+func (c *Capture) String() string {
+	if c == nil {
+		return "off"
+	}
+	if len(c.Clients) == 0 {
+		return "all clients"
+	}
+	return strings.Join(c.Clients, ", ")
+}
+
+func (c Condition) String() string {
+	switch c.Kind {
+	case ConditionTxIncluded:
+		return fmt.Sprintf("tx %s included on %s (%s)", c.TxID, c.NodeAddr, c.Chain)
+	case ConditionBlockHeight:
+		return fmt.Sprintf("block %d reached on %s (%s)", c.Height, c.NodeAddr, c.Chain)
+	case ConditionClientQuery:
+		return fmt.Sprintf("client queries %s", c.Address)
+	default:
+		return c.Kind
+	}
+}
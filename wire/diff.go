@@ -0,0 +1,146 @@
+package wire
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to compute the differences between
+two configs.
+*/
+
+import (
+	"sort"
+	"strings"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A ValueChange is a value that changed between two configs.
+type ValueChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// A ConfigDiff describes the differences between two configs. Triggers are
+// identified by their name: a trigger whose condition or target changed is
+// listed in ChangedTriggers.
+type ConfigDiff struct {
+	AddedNodes      []string     `json:"addedNodes,omitempty"`
+	RemovedNodes    []string     `json:"removedNodes,omitempty"`
+	ResponseNode    *ValueChange `json:"responseNode,omitempty"`
+	AddedTriggers   []string     `json:"addedTriggers,omitempty"`
+	RemovedTriggers []string     `json:"removedTriggers,omitempty"`
+	ChangedTriggers []string     `json:"changedTriggers,omitempty"`
+	Capture         *ValueChange `json:"capture,omitempty"`
+}
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// diffKeys returns the keys only in a, only in b, and in both with different
+// values, each sorted.
+func diffKeys(a map[string]string, b map[string]string) ([]string, []string, []string) {
+	var onlyA, onlyB, changed []string
+	for key, valueA := range a {
+		valueB, ok := b[key]
+		if !ok {
+			onlyA = append(onlyA, key)
+		} else if valueA != valueB {
+			changed = append(changed, key)
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			onlyB = append(onlyB, key)
+		}
+	}
+	sort.Strings(onlyA)
+	sort.Strings(onlyB)
+	sort.Strings(changed)
+	return onlyA, onlyB, changed
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// DiffConfigs returns the differences to go from the config from to the
+// config to.
+func DiffConfigs(from Config, to Config) ConfigDiff {
+	var diff ConfigDiff
+	// nodes
+	fromNodes := make(map[string]string, len(from.Nodes))
+	for _, node := range from.Nodes {
+		fromNodes[node.Addr] = ""
+	}
+	toNodes := make(map[string]string, len(to.Nodes))
+	for _, node := range to.Nodes {
+		toNodes[node.Addr] = ""
+	}
+	diff.RemovedNodes, diff.AddedNodes, _ = diffKeys(fromNodes, toNodes)
+	// response node
+	if from.ResponseNodeAddr != to.ResponseNodeAddr {
+		diff.ResponseNode = &ValueChange{From: from.ResponseNodeAddr, To: to.ResponseNodeAddr}
+	}
+	// triggers, compared by their description
+	fromTriggers := make(map[string]string, len(from.Triggers))
+	for _, trigger := range from.Triggers {
+		fromTriggers[trigger.Name] = trigger.Condition.String() + " -> " + trigger.Target.String()
+	}
+	toTriggers := make(map[string]string, len(to.Triggers))
+	for _, trigger := range to.Triggers {
+		toTriggers[trigger.Name] = trigger.Condition.String() + " -> " + trigger.Target.String()
+	}
+	diff.RemovedTriggers, diff.AddedTriggers, diff.ChangedTriggers = diffKeys(fromTriggers, toTriggers)
+	// capture
+	if from.Capture.String() != to.Capture.String() {
+		diff.Capture = &ValueChange{From: from.Capture.String(), To: to.Capture.String()}
+	}
+	return diff
+}
+
+// IsEmpty returns true if the configs are the same.
+func (d ConfigDiff) IsEmpty() bool {
+	return len(d.AddedNodes) == 0 && len(d.RemovedNodes) == 0 && d.ResponseNode == nil &&
+		len(d.AddedTriggers) == 0 && len(d.RemovedTriggers) == 0 && len(d.ChangedTriggers) == 0 &&
+		d.Capture == nil
+}
+
+// String returns the differences, one per line.
+func (d ConfigDiff) String() string {
+	if d.IsEmpty() {
+		return "no change\n"
+	}
+	var b strings.Builder
+	for _, addr := range d.AddedNodes {
+		b.WriteString("+ node " + addr + "\n")
+	}
+	for _, addr := range d.RemovedNodes {
+		b.WriteString("- node " + addr + "\n")
+	}
+	if d.ResponseNode != nil {
+		from, to := d.ResponseNode.From, d.ResponseNode.To
+		if from == "" {
+			from = "none"
+		}
+		if to == "" {
+			to = "none"
+		}
+		b.WriteString("~ response node " + from + " -> " + to + "\n")
+	}
+	for _, name := range d.AddedTriggers {
+		b.WriteString("+ trigger " + name + "\n")
+	}
+	for _, name := range d.RemovedTriggers {
+		b.WriteString("- trigger " + name + "\n")
+	}
+	for _, name := range d.ChangedTriggers {
+		b.WriteString("~ trigger " + name + "\n")
+	}
+	if d.Capture != nil {
+		b.WriteString("~ capture " + d.Capture.From + " -> " + d.Capture.To + "\n")
+	}
+	return b.String()
+}
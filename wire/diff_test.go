@@ -0,0 +1,54 @@
+package wire
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the differences between configs.
+*/
+
+import (
+	"reflect"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestDiffConfigs(t *testing.T) {
+	from := Config{
+		Nodes:            []Node{{Addr: "127.0.0.1:8001"}, {Addr: "127.0.0.1:8002"}},
+		ResponseNodeAddr: "127.0.0.1:8001",
+		Triggers: []Trigger{
+			{Name: "kept", Condition: Condition{Kind: ConditionClientQuery, Address: "0xa"}},
+			{Name: "changed", Condition: Condition{Kind: ConditionClientQuery, Address: "0xb"}},
+			{Name: "removed", Condition: Condition{Kind: ConditionClientQuery, Address: "0xc"}},
+		},
+	}
+	to := Config{
+		Nodes:            []Node{{Addr: "127.0.0.1:8002"}, {Addr: "127.0.0.1:8003"}},
+		ResponseNodeAddr: "127.0.0.1:8003",
+		Triggers: []Trigger{
+			{Name: "kept", Condition: Condition{Kind: ConditionClientQuery, Address: "0xa"}},
+			{Name: "changed", Condition: Condition{Kind: ConditionClientQuery, Address: "0xd"}},
+			{Name: "added", Condition: Condition{Kind: ConditionClientQuery, Address: "0xe"}},
+		},
+		Capture: &Capture{Clients: []string{"10.0.0.0/24"}},
+	}
+	expected := ConfigDiff{
+		AddedNodes:      []string{"127.0.0.1:8003"},
+		RemovedNodes:    []string{"127.0.0.1:8001"},
+		ResponseNode:    &ValueChange{From: "127.0.0.1:8001", To: "127.0.0.1:8003"},
+		AddedTriggers:   []string{"added"},
+		RemovedTriggers: []string{"removed"},
+		ChangedTriggers: []string{"changed"},
+		Capture:         &ValueChange{From: "off", To: "10.0.0.0/24"},
+	}
+	diff := DiffConfigs(from, to)
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Error diffing configs:\ngot  %+v\nwant %+v", diff, expected)
+	}
+	if !DiffConfigs(to, to).IsEmpty() {
+		t.Error("Error diffing configs: expected no change between identical configs")
+	}
+}
@@ -0,0 +1,98 @@
+package wire
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the events streamed by the proxy to the
+subscribed controllers.
+*/
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// Event kinds.
+const (
+	// EventClientConnected is sent when a client connects to the proxy.
+	EventClientConnected = "client-connected"
+	// EventNodeDialed is sent when the proxy connects to a node for a client.
+	EventNodeDialed = "node-dialed"
+	// EventBytesForwarded is sent when the proxy forwards data between a
+	// client and a node.
+	EventBytesForwarded = "bytes-forwarded"
+	// EventResponseNode is sent when the proxy starts forwarding the
+	// responses of a node to a client.
+	EventResponseNode = "response-node"
+	// EventConfigApplied is sent when a config is applied.
+	EventConfigApplied = "config-applied"
+	// EventConfigRejected is sent when a message changing the config is
+	// rejected.
+	EventConfigRejected = "config-rejected"
+	// EventSessionClosed is sent when the connection of a client is closed.
+	EventSessionClosed = "session-closed"
+)
+
+// Directions of the forwarded bytes.
+const (
+	// DirectionToNode is the direction of the data sent by a client.
+	DirectionToNode = "to-node"
+	// DirectionToClient is the direction of the data sent by a node.
+	DirectionToClient = "to-client"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// An Event is something that happened on the proxy. Only the fields relevant
+// to its kind are set.
+type Event struct {
+	Time          time.Time    `json:"time"`
+	Kind          string       `json:"kind"`
+	SessionID     uint64       `json:"sessionId,omitempty"`
+	ClientAddr    string       `json:"clientAddr,omitempty"`
+	NodeAddr      string       `json:"nodeAddr,omitempty"`
+	Direction     string       `json:"direction,omitempty"`
+	Bytes         int          `json:"bytes,omitempty"`
+	ConfigVersion uint64       `json:"configVersion,omitempty"`
+	Source        string       `json:"source,omitempty"`
+	Errors        []FieldError `json:"errors,omitempty"`
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// String returns a one-line description of the event.
+func (e Event) String() string {
+	var b strings.Builder
+	b.WriteString(e.Time.Format("15:04:05.000") + " " + e.Kind)
+	if e.SessionID != 0 {
+		fmt.Fprintf(&b, " session=%d", e.SessionID)
+	}
+	if e.ClientAddr != "" {
+		b.WriteString(" client=" + e.ClientAddr)
+	}
+	if e.NodeAddr != "" {
+		b.WriteString(" node=" + e.NodeAddr)
+	}
+	if e.Bytes != 0 {
+		fmt.Fprintf(&b, " %s=%d", e.Direction, e.Bytes)
+	}
+	if e.ConfigVersion != 0 {
+		fmt.Fprintf(&b, " version=%d", e.ConfigVersion)
+	}
+	if e.Source != "" {
+		b.WriteString(" source=" + e.Source)
+	}
+	for _, fieldErr := range e.Errors {
+		b.WriteString(" error=\"" + fieldErr.String() + "\"")
+	}
+	return b.String()
+}
@@ -0,0 +1,71 @@
+package wire
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the framing of the messages exchanged between
+the controller and the proxy. A frame is a JSON document followed by a newline.
+*/
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// DEFAULT_MAX_FRAME_SIZE is the default maximum size of a frame, in bytes.
+const DEFAULT_MAX_FRAME_SIZE = 1 << 20
+
+//------------------------------------------------------------------------------
+// Errors
+//------------------------------------------------------------------------------
+
+// ErrFrameTooLarge is returned when a frame exceeds the maximum size.
+var ErrFrameTooLarge = errors.New("frame too large")
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// ReadFrame reads a frame and returns it without its trailing newline.
+// A frame terminated by the end of the stream instead of a newline is
+// accepted, since the first controllers closed the connection after their
+// message. io.EOF is returned if the stream ends before any data.
+// If the frame exceeds maxSize bytes, the rest of the frame is discarded, so
+// that the next frame can be read, and ErrFrameTooLarge is returned.
+func ReadFrame(r *bufio.Reader, maxSize int) ([]byte, error) {
+	var frame []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(frame)+len(chunk) > maxSize+1 || (err != nil && len(frame)+len(chunk) > maxSize) {
+			for errors.Is(err, bufio.ErrBufferFull) {
+				_, err = r.ReadSlice('\n')
+			}
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrFrameTooLarge, maxSize)
+		}
+		frame = append(frame, chunk...)
+		switch {
+		case err == nil:
+			return frame[:len(frame)-1], nil
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF) && len(frame) > 0:
+			return frame, nil
+		default:
+			return nil, err
+		}
+	}
+}
+
+// WriteFrame writes the data as a frame.
+// The data must not contain any newline, which is the case of the JSON
+// documents encoded by this package.
+func WriteFrame(w io.Writer, data []byte) error {
+	_, err := w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,77 @@
+package wire
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the framing of the messages.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestReadFrames(t *testing.T) {
+	// frames larger than the buffer of the reader must be read entirely
+	large := strings.Repeat("a", 5000)
+	r := bufio.NewReaderSize(strings.NewReader("first\n"+large+"\nlast"), 16)
+	for _, expected := range []string{"first", large, "last"} {
+		frame, err := ReadFrame(r, DEFAULT_MAX_FRAME_SIZE)
+		if err != nil {
+			t.Fatal("Error reading frame:", err)
+		}
+		if string(frame) != expected {
+			t.Errorf("Error reading frame: got %d bytes, want %d", len(frame), len(expected))
+		}
+	}
+	_, err := ReadFrame(r, DEFAULT_MAX_FRAME_SIZE)
+	if !errors.Is(err, io.EOF) {
+		t.Error("Error reading past the last frame: expected io.EOF, got", err)
+	}
+}
+
+func TestReadFrameTooLarge(t *testing.T) {
+	for _, data := range []string{"12345\n", "123456\n", "123456"} {
+		r := bufio.NewReaderSize(strings.NewReader(data), 16)
+		frame, err := ReadFrame(r, 5)
+		if data == "12345\n" {
+			if err != nil || string(frame) != "12345" {
+				t.Errorf("Error reading frame of the maximum size: got %q, %v", frame, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrFrameTooLarge) {
+			t.Errorf("Error reading %q: expected ErrFrameTooLarge, got %v", data, err)
+		}
+	}
+	// the frame following an oversized frame can still be read
+	r := bufio.NewReaderSize(strings.NewReader(strings.Repeat("a", 100)+"\nnext\n"), 16)
+	_, err := ReadFrame(r, 5)
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatal("Error reading oversized frame: expected ErrFrameTooLarge, got", err)
+	}
+	frame, err := ReadFrame(r, 5)
+	if err != nil || string(frame) != "next" {
+		t.Errorf("Error reading frame after oversized frame: got %q, %v", frame, err)
+	}
+}
+
+func TestWriteFrame(t *testing.T) {
+	var buffer bytes.Buffer
+	err := WriteFrame(&buffer, []byte(`{"version":2}`))
+	if err != nil {
+		t.Fatal("Error writing frame:", err)
+	}
+	frame, err := ReadFrame(bufio.NewReader(&buffer), DEFAULT_MAX_FRAME_SIZE)
+	if err != nil || string(frame) != `{"version":2}` {
+		t.Errorf("Error reading written frame: got %q, %v", frame, err)
+	}
+}
@@ -0,0 +1,3 @@
+module semester-project/wire
+
+go 1.20
@@ -0,0 +1,280 @@
+package wire
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the messages exchanged between the controller
+and the proxy, and their encoding.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+//------------------------------------------------------------------------------
+// Constants
+//------------------------------------------------------------------------------
+
+// SchemaVersion is the version of the wire schema implemented by this package.
+// Version 1 is the bare config object sent by the first controllers.
+const SchemaVersion = 2
+
+// Reply statuses.
+const (
+	// StatusOK is the status of a reply to a message that was applied.
+	StatusOK = "ok"
+	// StatusRejected is the status of a reply to a message that was not
+	// applied.
+	StatusRejected = "rejected"
+)
+
+// Message types.
+const (
+	// TypeSetConfig replaces the configuration of the proxy.
+	// Its payload is a Config.
+	TypeSetConfig = "set-config"
+	// TypeSavePreset saves a config as a named preset.
+	// Its payload is a PresetPayload.
+	TypeSavePreset = "save-preset"
+	// TypeApplyPreset replaces the configuration of the proxy by a preset.
+	// Its payload is a PresetPayload.
+	TypeApplyPreset = "apply-preset"
+	// TypeDeletePreset deletes a preset.
+	// Its payload is a PresetPayload.
+	TypeDeletePreset = "delete-preset"
+	// TypeListPresets lists the presets.
+	// It has no payload, the payload of the reply is a map from preset names
+	// to configs.
+	TypeListPresets = "list-presets"
+	// TypeWatch subscribes to the events of the proxy.
+	// It has no payload. The proxy acknowledges it with an empty reply, then
+	// sends a reply carrying an Event as payload for every event, with the ID
+	// of the message, until the session ends.
+	TypeWatch = "watch"
+	// TypeListSessions lists the live client sessions.
+	// It has no payload, the payload of the reply is a list of
+	// ClientSession.
+	TypeListSessions = "list-sessions"
+	// TypeKillSession closes a client session.
+	// Its payload is a SessionPayload.
+	TypeKillSession = "kill-session"
+	// TypePrepareConfig validates a config and keeps it until the rollout is
+	// committed or aborted.
+	// Its payload is a RolloutPayload with a config.
+	TypePrepareConfig = "prepare-config"
+	// TypeCommitConfig applies the config prepared by a rollout.
+	// Its payload is a RolloutPayload.
+	TypeCommitConfig = "commit-config"
+	// TypeAbortConfig drops the config prepared by a rollout.
+	// Its payload is a RolloutPayload.
+	TypeAbortConfig = "abort-config"
+	// TypeAudit reads the audit log of the config changes.
+	// Its payload is an AuditQuery, the payload of the reply is a list of
+	// AuditEntry, oldest first.
+	TypeAudit = "audit"
+	// TypeGetConfig reads the active config.
+	// It has no payload, the payload of the reply is an ActiveConfig.
+	TypeGetConfig = "get-config"
+	// TypeDiffConfig validates a config without applying it.
+	// Its payload is a Config, the payload of the reply is the ConfigDiff
+	// from the active config to the given config. Like set-config, it is
+	// rejected if the config is invalid.
+	TypeDiffConfig = "diff-config"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A Message is a message sent by the controller to the proxy.
+// The ID is chosen by the controller and copied in the reply, so that the
+// replies of a session can be matched with their message. Auth is only set
+// on signed messages.
+type Message struct {
+	Version int             `json:"version"`
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Auth    *Auth           `json:"auth,omitempty"`
+}
+
+// A Reply is the answer of the proxy to a message.
+// On success, ConfigVersion is the version of the active config of the proxy
+// and the report only contains warnings. On rejection, the report contains the
+// reasons. The payload depends on the type of the message.
+type Reply struct {
+	Version       int    `json:"version"`
+	ID            string `json:"id,omitempty"`
+	Status        string `json:"status"`
+	ConfigVersion uint64 `json:"configVersion,omitempty"`
+	ValidationReport
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// A PresetPayload is the payload of the preset messages.
+// Config is only used by save-preset: if it is not set, the active config of
+// the proxy is saved.
+type PresetPayload struct {
+	Name   string  `json:"name"`
+	Config *Config `json:"config,omitempty"`
+}
+
+// A SessionPayload is the payload of the messages about a client session.
+type SessionPayload struct {
+	ID uint64 `json:"id"`
+}
+
+// An AuditQuery is the payload of the audit messages. Only the last Limit
+// entries are returned, or all of them if Limit is 0.
+type AuditQuery struct {
+	Limit int `json:"limit,omitempty"`
+}
+
+// A RolloutPayload is the payload of the rollout messages. The ID is chosen
+// by the controller and is the same on all the proxies of the rollout.
+// Config is only used by prepare-config.
+type RolloutPayload struct {
+	ID     string  `json:"id"`
+	Config *Config `json:"config,omitempty"`
+}
+
+//------------------------------------------------------------------------------
+// Errors
+//------------------------------------------------------------------------------
+
+// ErrUnsupportedVersion is returned when a message uses a schema version that
+// is not supported.
+var ErrUnsupportedVersion = errors.New("unsupported schema version")
+
+// ErrUnknownType is returned when a message has an unknown type.
+var ErrUnknownType = errors.New("unknown message type")
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// NewMessage creates a message of the given type with the given payload.
+func NewMessage(messageType string, payload interface{}) (Message, error) {
+	message := Message{
+		Version: SchemaVersion,
+		Type:    messageType,
+	}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return Message{}, err
+		}
+		message.Payload = data
+	}
+	return message, nil
+}
+
+// EncodeMessage encodes the message.
+func EncodeMessage(message Message) ([]byte, error) {
+	return json.Marshal(message)
+}
+
+// DecodeMessage decodes a message.
+// A version 1 message, i.e. a bare config object, is decoded as a set-config
+// message.
+func DecodeMessage(data []byte) (Message, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return Message{}, err
+	}
+	// version 1 messages do not carry a version
+	if _, ok := fields["version"]; !ok {
+		return Message{
+			Version: 1,
+			Type:    TypeSetConfig,
+			Payload: json.RawMessage(data),
+		}, nil
+	}
+	var message Message
+	err = json.Unmarshal(data, &message)
+	if err != nil {
+		return Message{}, err
+	}
+	if message.Version < 1 || message.Version > SchemaVersion {
+		return Message{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, message.Version)
+	}
+	if message.Type == "" {
+		return Message{}, fmt.Errorf("%w: missing type", ErrUnknownType)
+	}
+	return message, nil
+}
+
+// DecodePayload decodes the payload of the message into v.
+func (m *Message) DecodePayload(v interface{}) error {
+	if len(m.Payload) == 0 {
+		return errors.New("missing payload for message " + m.Type)
+	}
+	return json.Unmarshal(m.Payload, v)
+}
+
+// NewReply creates a successful reply carrying the version of the active
+// config and the warnings of the given validation report.
+func NewReply(configVersion uint64, report ValidationReport) Reply {
+	return Reply{
+		Version:       SchemaVersion,
+		Status:        StatusOK,
+		ConfigVersion: configVersion,
+		ValidationReport: ValidationReport{
+			Warnings: report.Warnings,
+		},
+	}
+}
+
+// NewRejection creates a reply rejecting a message for the reasons given by
+// the validation report.
+func NewRejection(report ValidationReport) Reply {
+	return Reply{
+		Version:          SchemaVersion,
+		Status:           StatusRejected,
+		ValidationReport: report,
+	}
+}
+
+// Succeeded returns true if the message was applied by the proxy.
+func (r *Reply) Succeeded() bool {
+	return r.Status == StatusOK
+}
+
+// SetPayload sets the payload of the reply.
+func (r *Reply) SetPayload(payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	r.Payload = data
+	return nil
+}
+
+// DecodePayload decodes the payload of the reply into v.
+func (r *Reply) DecodePayload(v interface{}) error {
+	if len(r.Payload) == 0 {
+		return errors.New("missing payload in reply")
+	}
+	return json.Unmarshal(r.Payload, v)
+}
+
+// EncodeReply encodes the reply.
+func EncodeReply(reply Reply) ([]byte, error) {
+	return json.Marshal(reply)
+}
+
+// DecodeReply decodes a reply.
+func DecodeReply(data []byte) (Reply, error) {
+	var reply Reply
+	err := json.Unmarshal(data, &reply)
+	if err != nil {
+		return Reply{}, err
+	}
+	if reply.Version > SchemaVersion {
+		return Reply{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, reply.Version)
+	}
+	return reply, nil
+}
@@ -0,0 +1,59 @@
+package wire
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the status of the proxy, as reported to the
+controller and to the admin API.
+*/
+
+import "time"
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// An ActiveConfig is the config applied by the proxy, with its version.
+type ActiveConfig struct {
+	ConfigVersion uint64 `json:"configVersion"`
+	Config        Config `json:"config"`
+}
+
+// An Origin describes who applied a config. The source is e.g. the address of
+// the controller or the name of the trigger. The identity is the authenticated
+// identity of the sender, if any.
+type Origin struct {
+	Source   string `json:"source"`
+	Identity string `json:"identity,omitempty"`
+}
+
+// A HistoryEntry records a config applied by the proxy.
+type HistoryEntry struct {
+	ConfigVersion uint64    `json:"configVersion"`
+	Time          time.Time `json:"time"`
+	Origin
+	Config Config `json:"config"`
+}
+
+// An AuditEntry records a change of the config of the proxy.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	Origin
+	PreviousVersion uint64     `json:"previousVersion"`
+	ConfigVersion   uint64     `json:"configVersion"`
+	Diff            ConfigDiff `json:"diff"`
+}
+
+// A ClientSession is a client connection handled by the proxy.
+// BytesToNodes counts the bytes sent by the client, which are sent to every
+// node. BytesToClient counts the bytes sent by the response node.
+type ClientSession struct {
+	ID               uint64    `json:"id"`
+	ClientAddr       string    `json:"clientAddr"`
+	Nodes            []string  `json:"nodes"`
+	ResponseNodeAddr string    `json:"responseNodeAddr"`
+	ConfigVersion    uint64    `json:"configVersion"`
+	StartTime        time.Time `json:"startTime"`
+	BytesToNodes     uint64    `json:"bytesToNodes"`
+	BytesToClient    uint64    `json:"bytesToClient"`
+}
@@ -0,0 +1,169 @@
+package wire
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the code to validate the proxy configuration.
+It is shared by the proxy and the controller.
+*/
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+//------------------------------------------------------------------------------
+// Types
+//------------------------------------------------------------------------------
+
+// A FieldError describes a problem found on a single field of a config.
+// Field is the path of the field in the JSON representation of the config,
+// e.g. "nodes[1].addr". It is empty if the problem concerns the whole config.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// A ValidationReport is the result of the validation of a config.
+// Errors make the config invalid, warnings do not.
+type ValidationReport struct {
+	Errors   []FieldError `json:"errors,omitempty"`
+	Warnings []FieldError `json:"warnings,omitempty"`
+}
+
+//------------------------------------------------------------------------------
+// Private methods
+//------------------------------------------------------------------------------
+
+// addError adds an error on the given field to the report.
+func (r *ValidationReport) addError(field string, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// addWarning adds a warning on the given field to the report.
+func (r *ValidationReport) addWarning(field string, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// checkAddr checks that the address is a valid host:port pair.
+func checkAddr(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("missing host in address %q", addr)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("invalid port %q in address %q", port, addr)
+	}
+	return nil
+}
+
+// validate checks the config and adds the problems found to the report.
+// The prefix is prepended to the path of the fields.
+func (c *Config) validate(prefix string, report *ValidationReport) {
+	// check that the nodes array is set
+	if c.Nodes == nil {
+		report.addError(prefix+"nodes", "not set")
+	} else if len(c.Nodes) == 0 {
+		report.addWarning(prefix+"nodes", "no destination node: client connections will be closed")
+	}
+	// check the address of each node
+	seen := make(map[string]int)
+	for i, node := range c.Nodes {
+		field := fmt.Sprintf("%snodes[%d].addr", prefix, i)
+		if err := checkAddr(node.Addr); err != nil {
+			report.addError(field, "malformed address: %v", err)
+			continue
+		}
+		if j, ok := seen[node.Addr]; ok {
+			report.addError(field, "duplicate address %s (already used by nodes[%d])", node.Addr, j)
+			continue
+		}
+		seen[node.Addr] = i
+	}
+	// check that if the response node is set, it is in the nodes array
+	if c.ResponseNodeAddr != "" {
+		if _, ok := seen[c.ResponseNodeAddr]; !ok {
+			report.addError(prefix+"responseNodeAddr", "response node %s is not in nodes", c.ResponseNodeAddr)
+		}
+	} else if len(c.Nodes) > 0 {
+		report.addWarning(prefix+"responseNodeAddr", "response node not set: responses will be dropped")
+	}
+	// check the triggers
+	names := make(map[string]int)
+	for i, trigger := range c.Triggers {
+		field := fmt.Sprintf("%striggers[%d]", prefix, i)
+		if trigger.Name == "" {
+			report.addError(field+".name", "not set")
+		} else if j, ok := names[trigger.Name]; ok {
+			report.addError(field+".name", "duplicate name %s (already used by triggers[%d])", trigger.Name, j)
+		} else {
+			names[trigger.Name] = i
+		}
+		trigger.Condition.validate(field+".condition.", seen, report)
+		trigger.Target.validate(field+".target.", report)
+	}
+	// check the clients of the capture
+	if c.Capture != nil {
+		for i, client := range c.Capture.Clients {
+			if net.ParseIP(client) == nil {
+				if _, _, err := net.ParseCIDR(client); err != nil {
+					report.addError(fmt.Sprintf("%scapture.clients[%d]", prefix, i), "%q is neither an IP address nor a CIDR prefix", client)
+				}
+			}
+		}
+	}
+}
+
+// validate checks the condition and adds the problems found to the report.
+// The nodes are the addresses of the nodes of the config of the trigger.
+func (c *Condition) validate(prefix string, nodes map[string]int, report *ValidationReport) {
+	switch c.Kind {
+	case ConditionTxIncluded, ConditionBlockHeight:
+		if c.Chain != ChainQuorum && c.Chain != ChainAlgorand {
+			report.addError(prefix+"chain", "unknown chain %q (expected %s or %s)", c.Chain, ChainQuorum, ChainAlgorand)
+		}
+		if _, ok := nodes[c.NodeAddr]; !ok {
+			report.addError(prefix+"nodeAddr", "node %q is not in nodes", c.NodeAddr)
+		}
+		if c.Kind == ConditionTxIncluded && c.TxID == "" {
+			report.addError(prefix+"txId", "not set")
+		}
+		if c.Kind == ConditionBlockHeight && c.Height == 0 {
+			report.addError(prefix+"height", "not set")
+		}
+	case ConditionClientQuery:
+		if c.Address == "" {
+			report.addError(prefix+"address", "not set")
+		}
+	default:
+		report.addError(prefix+"kind", "unknown condition %q", c.Kind)
+	}
+}
+
+//------------------------------------------------------------------------------
+// Public methods
+//------------------------------------------------------------------------------
+
+// Validate checks the config and returns a report of all the problems found.
+func (c *Config) Validate() ValidationReport {
+	var report ValidationReport
+	c.validate("", &report)
+	return report
+}
+
+// OK returns true if the report contains no error.
+func (r *ValidationReport) OK() bool {
+	return len(r.Errors) == 0
+}
+
+func (e FieldError) String() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
@@ -0,0 +1,104 @@
+package wire
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the validation of the config.
+*/
+
+import (
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestValidateTriggers(t *testing.T) {
+	config := Config{
+		Nodes:            []Node{{Addr: "127.0.0.1:8001"}, {Addr: "127.0.0.1:8002"}},
+		ResponseNodeAddr: "127.0.0.1:8001",
+		Triggers: []Trigger{
+			{
+				Name: "switch",
+				Condition: Condition{
+					Kind:     ConditionBlockHeight,
+					Chain:    ChainQuorum,
+					NodeAddr: "127.0.0.1:8002",
+					Height:   10,
+				},
+				Target: Config{
+					Nodes:            []Node{{Addr: "127.0.0.1:8002"}},
+					ResponseNodeAddr: "127.0.0.1:8002",
+				},
+			},
+		},
+	}
+	if report := config.Validate(); !report.OK() {
+		t.Error("Error validating valid triggers:", report.Errors)
+	}
+}
+
+func TestValidateInvalidTriggers(t *testing.T) {
+	config := Config{
+		Nodes:            []Node{{Addr: "127.0.0.1:8001"}},
+		ResponseNodeAddr: "127.0.0.1:8001",
+		Triggers: []Trigger{
+			{
+				Name:      "a",
+				Condition: Condition{Kind: ConditionTxIncluded, Chain: ChainQuorum, NodeAddr: "127.0.0.1:8009"},
+				Target:    Config{Nodes: []Node{}},
+			},
+			{
+				Name:      "a",
+				Condition: Condition{Kind: ConditionClientQuery, Address: "0xbob"},
+				Target:    Config{Nodes: []Node{}, ResponseNodeAddr: "127.0.0.1:8001"},
+			},
+		},
+	}
+	report := config.Validate()
+	fields := []string{
+		"triggers[0].condition.nodeAddr",
+		"triggers[0].condition.txId",
+		"triggers[1].name",
+		"triggers[1].target.responseNodeAddr",
+	}
+	if len(report.Errors) != len(fields) {
+		t.Fatalf("Error validating invalid triggers: expected %d errors, got %v", len(fields), report.Errors)
+	}
+	for i, field := range fields {
+		if report.Errors[i].Field != field {
+			t.Errorf("Error validating invalid triggers: expected error on %s, got %s", field, report.Errors[i])
+		}
+	}
+}
+
+func TestValidateCapture(t *testing.T) {
+	config := Config{
+		Nodes:            []Node{{Addr: "127.0.0.1:8001"}},
+		ResponseNodeAddr: "127.0.0.1:8001",
+		Capture:          &Capture{Clients: []string{"10.0.0.1", "192.168.0.0/16", "victim"}},
+	}
+	report := config.Validate()
+	if len(report.Errors) != 1 || report.Errors[0].Field != "capture.clients[2]" {
+		t.Fatal("Error validating capture: expected an error on capture.clients[2], got", report.Errors)
+	}
+	tests := map[string]bool{
+		"10.0.0.1:5000":    true,
+		"10.0.0.2:5000":    false,
+		"192.168.1.7:5000": true,
+		"[::1]:5000":       false,
+	}
+	for clientAddr, expected := range tests {
+		if config.Capture.CapturesClient(clientAddr) != expected {
+			t.Errorf("Error matching client %s: expected %v", clientAddr, expected)
+		}
+	}
+	if !(&Capture{}).CapturesClient("[::1]:5000") {
+		t.Error("Error matching client: an empty profile should capture all the clients")
+	}
+	var off *Capture
+	if off.CapturesClient("10.0.0.1:5000") {
+		t.Error("Error matching client: a nil capture should capture no client")
+	}
+}
@@ -0,0 +1,205 @@
+package wire
+
+/*
+Author: Bastien Faivre
+Project: EPFL Master Semester Project
+Description: This file contains the tests for the wire schema.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+// Helpers
+//------------------------------------------------------------------------------
+
+// expectedConfig is the config encoded in the testdata fixtures.
+var expectedConfig = Config{
+	Nodes: []Node{
+		{Addr: "127.0.0.1:8001"},
+		{Addr: "127.0.0.1:8002"},
+	},
+	ResponseNodeAddr: "127.0.0.1:8001",
+}
+
+// readFixture reads a fixture from the testdata directory.
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal("Error reading fixture:", err)
+	}
+	return bytes.TrimSpace(data)
+}
+
+//------------------------------------------------------------------------------
+// Tests
+//------------------------------------------------------------------------------
+
+func TestDecodeV1Message(t *testing.T) {
+	message, err := DecodeMessage(readFixture(t, "v1-set-config.json"))
+	if err != nil {
+		t.Fatal("Error decoding v1 message:", err)
+	}
+	if message.Version != 1 || message.Type != TypeSetConfig {
+		t.Errorf("Error decoding v1 message: got version %d and type %q", message.Version, message.Type)
+	}
+	var config Config
+	err = message.DecodePayload(&config)
+	if err != nil {
+		t.Fatal("Error decoding v1 payload:", err)
+	}
+	if !reflect.DeepEqual(config, expectedConfig) {
+		t.Error("Error decoding v1 payload: got", config)
+	}
+}
+
+func TestDecodeV2Message(t *testing.T) {
+	message, err := DecodeMessage(readFixture(t, "v2-set-config.json"))
+	if err != nil {
+		t.Fatal("Error decoding v2 message:", err)
+	}
+	if message.Version != SchemaVersion || message.Type != TypeSetConfig {
+		t.Errorf("Error decoding v2 message: got version %d and type %q", message.Version, message.Type)
+	}
+	var config Config
+	err = message.DecodePayload(&config)
+	if err != nil {
+		t.Fatal("Error decoding v2 payload:", err)
+	}
+	if !reflect.DeepEqual(config, expectedConfig) {
+		t.Error("Error decoding v2 payload: got", config)
+	}
+}
+
+func TestEncodeMatchesFixture(t *testing.T) {
+	message, err := NewMessage(TypeSetConfig, expectedConfig)
+	if err != nil {
+		t.Fatal("Error creating message:", err)
+	}
+	data, err := EncodeMessage(message)
+	if err != nil {
+		t.Fatal("Error encoding message:", err)
+	}
+	if fixture := readFixture(t, "v2-set-config.json"); !bytes.Equal(data, fixture) {
+		t.Errorf("Error encoding message:\ngot  %s\nwant %s", data, fixture)
+	}
+}
+
+func TestDecodeUnsupportedVersion(t *testing.T) {
+	_, err := DecodeMessage([]byte(`{"version":99,"type":"set-config"}`))
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Error("Error decoding future message: expected ErrUnsupportedVersion, got", err)
+	}
+}
+
+func TestDecodeReplyWithoutStatus(t *testing.T) {
+	reply, err := DecodeReply([]byte(`{"version":2,"warnings":[{"field":"responseNodeAddr","message":"not set"}]}`))
+	if err != nil {
+		t.Fatal("Error decoding reply:", err)
+	}
+	if reply.Version != 2 || len(reply.Warnings) != 1 {
+		t.Error("Error decoding reply: got", reply)
+	}
+	if reply.Succeeded() {
+		t.Error("Error decoding reply: reply without status succeeded")
+	}
+}
+
+func TestReplyStatus(t *testing.T) {
+	report := ValidationReport{
+		Errors: []FieldError{{Field: "nodes", Message: "not set"}},
+	}
+	for _, reply := range []Reply{NewReply(3, ValidationReport{}), NewRejection(report)} {
+		data, err := EncodeReply(reply)
+		if err != nil {
+			t.Fatal("Error encoding reply:", err)
+		}
+		decoded, err := DecodeReply(data)
+		if err != nil {
+			t.Fatal("Error decoding reply:", err)
+		}
+		if !reflect.DeepEqual(decoded, reply) {
+			t.Errorf("Error decoding reply: got %v, want %v", decoded, reply)
+		}
+	}
+	rejection := NewRejection(report)
+	if rejection.Succeeded() {
+		t.Error("Error creating rejection: rejection succeeded")
+	}
+}
+
+func TestSignedMessage(t *testing.T) {
+	key := []byte("secret")
+	message, err := NewMessage(TypeSetConfig, expectedConfig)
+	if err != nil {
+		t.Fatal("Error creating message:", err)
+	}
+	message.ID = "1"
+	err = message.Sign("team-a", key)
+	if err != nil {
+		t.Fatal("Error signing message:", err)
+	}
+	// the signature survives the encoding
+	data, err := EncodeMessage(message)
+	if err != nil {
+		t.Fatal("Error encoding message:", err)
+	}
+	decoded, err := DecodeMessage(data)
+	if err != nil {
+		t.Fatal("Error decoding message:", err)
+	}
+	if err := decoded.VerifySignature(key); err != nil {
+		t.Error("Error verifying signed message:", err)
+	}
+	if err := decoded.VerifySignature([]byte("other")); !errors.Is(err, ErrBadSignature) {
+		t.Error("Error verifying message with another key: expected ErrBadSignature, got", err)
+	}
+	decoded.Type = TypeDeletePreset
+	if err := decoded.VerifySignature(key); !errors.Is(err, ErrBadSignature) {
+		t.Error("Error verifying tampered message: expected ErrBadSignature, got", err)
+	}
+	unsigned, _ := NewMessage(TypeListPresets, nil)
+	if err := unsigned.VerifySignature(key); !errors.Is(err, ErrUnsigned) {
+		t.Error("Error verifying unsigned message: expected ErrUnsigned, got", err)
+	}
+}
+
+func TestSignedRequest(t *testing.T) {
+	key := []byte("secret")
+	body := []byte(`{"nodes": []}`)
+	message := NewRequestMessage("PUT", "/config", body)
+	err := message.Sign(`team "a", b`, key)
+	if err != nil {
+		t.Fatal("Error signing request:", err)
+	}
+	// the authentication survives the header
+	auth, err := ParseAuthHeader(message.Auth.Header())
+	if err != nil {
+		t.Fatal("Error parsing header:", err)
+	}
+	if !reflect.DeepEqual(auth, message.Auth) {
+		t.Error("Error parsing header: got", auth, "expected", message.Auth)
+	}
+	received := NewRequestMessage("PUT", "/config", body)
+	received.Auth = auth
+	if err := received.VerifySignature(key); err != nil {
+		t.Error("Error verifying signed request:", err)
+	}
+	tampered := NewRequestMessage("PUT", "/config", []byte(`{"nodes":[]}`))
+	tampered.Auth = auth
+	if err := tampered.VerifySignature(key); !errors.Is(err, ErrBadSignature) {
+		t.Error("Error verifying tampered request: expected ErrBadSignature, got", err)
+	}
+	if _, err := ParseAuthHeader("Basic dGVhbS1hOnNlY3JldA=="); !errors.Is(err, ErrUnsigned) {
+		t.Error("Error parsing basic authentication: expected ErrUnsigned, got", err)
+	}
+	if _, err := ParseAuthHeader(HTTP_AUTH_SCHEME + ` identity="a", nonce=x`); !errors.Is(err, ErrMalformedAuthHeader) {
+		t.Error("Error parsing malformed header: expected ErrMalformedAuthHeader, got", err)
+	}
+}